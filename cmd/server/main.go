@@ -21,6 +21,13 @@ func main() {
 		log.Fatalf("Error loading config: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:]); err != nil {
+			log.Fatal("Migration error:", err)
+		}
+		return
+	}
+
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -31,8 +38,10 @@ func main() {
 	}
 	defer appInstance.DBCloser()
 
-	if err := migration.RunMigrations(appInstance.PGRepo.DB()); err != nil {
-		log.Fatal("Migration error:", err)
+	if cfg.AutoMigrate {
+		if err := migration.RunMigrations(appInstance.PGRepo.DB()); err != nil {
+			log.Fatal("Migration error:", err)
+		}
 	}
 
 	server := &http.Server{
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"smolink/internal/config"
+	"smolink/internal/migration"
+	"smolink/pkg/database"
+)
+
+const migrateUsage = "usage: smolink migrate up [N] | down [N] | version | force V | goto V"
+
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	pgDB, err := database.NewPostgresDB(cfg.PostgresDSN)
+	if err != nil {
+		return err
+	}
+	defer pgDB.Close()
+
+	m, err := migration.NewMigrator(pgDB.Pool)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "up":
+		if len(args) > 1 {
+			var n int
+			if n, err = parseCount(args[1]); err == nil {
+				err = m.Steps(n)
+			}
+		} else {
+			err = m.Up()
+		}
+	case "down":
+		// Default to a single step; rolling back everything must be explicit.
+		n := 1
+		if len(args) > 1 {
+			n, err = parseCount(args[1])
+		}
+		if err == nil {
+			err = m.Steps(-n)
+		}
+	case "force":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		var v int
+		if v, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		err = m.Force(v)
+	case "goto":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		var v uint64
+		if v, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		err = m.Goto(uint(v))
+	case "version":
+	default:
+		return errors.New(migrateUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil {
+		return err
+	}
+	latest, err := migration.LatestVersion()
+	if err != nil {
+		return err
+	}
+	log.Printf("Schema version: %d (dirty: %t, latest: %d)", version, dirty, latest)
+	return nil
+}
+
+func parseCount(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid step count %q", arg)
+	}
+	return n, nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"smolink/internal/model"
+)
+
+// backend is implemented by the HTTP client and by the offline mode that runs
+// the service layer directly against the datastores.
+type backend interface {
+	CreateLink(ctx context.Context, url, customCode string) (*model.URL, error)
+	GetLink(ctx context.Context, code string) (*model.URL, error)
+	// ListLinks lists links newest first; a positive before only lists links
+	// with smaller IDs.
+	ListLinks(ctx context.Context, limit, offset, before int) ([]model.URL, int, error)
+	SetLinkStatus(ctx context.Context, code, status string) (*model.URL, error)
+	DeleteLink(ctx context.Context, code string) error
+	LinkStats(ctx context.Context, code string, days int) (*model.URLStats, error)
+
+	ListAPIKeys(ctx context.Context) ([]model.APIKey, error)
+	CreateAPIKey(ctx context.Context, name string, workspaceID *int) (*model.APIKey, string, error)
+	RevokeAPIKey(ctx context.Context, id int) error
+
+	Close() error
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/routes"
+)
+
+type httpBackend struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func newHTTPBackend(baseURL, token string) *httpBackend {
+	return &httpBackend{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (b *httpBackend) do(ctx context.Context, method, path string, body, dest interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+routes.APIPrefix+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &errors.APIError{Status: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Code == "" {
+			return fmt.Errorf("request failed with status %d", resp.StatusCode)
+		}
+		return apiErr
+	}
+
+	if dest == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+func (b *httpBackend) CreateLink(ctx context.Context, originalURL, customCode string) (*model.URL, error) {
+	var resp struct {
+		ShortCode string `json:"shortCode"`
+	}
+	payload := map[string]string{"url": originalURL, "customCode": customCode}
+	if err := b.do(ctx, http.MethodPost, routes.ShortenURLPath, payload, &resp); err != nil {
+		return nil, err
+	}
+	return b.GetLink(ctx, resp.ShortCode)
+}
+
+func (b *httpBackend) GetLink(ctx context.Context, code string) (*model.URL, error) {
+	var link model.URL
+	err := b.do(ctx, http.MethodGet, adminLinkPath(code), nil, &link)
+	return &link, err
+}
+
+func (b *httpBackend) ListLinks(ctx context.Context, limit, offset, before int) ([]model.URL, int, error) {
+	var resp struct {
+		Links []model.URL `json:"links"`
+		Total int         `json:"total"`
+	}
+	query := url.Values{"limit": {fmt.Sprint(limit)}, "offset": {fmt.Sprint(offset)}}
+	if before > 0 {
+		query.Set("before", fmt.Sprint(before))
+	}
+	err := b.do(ctx, http.MethodGet, routes.AdminPrefix+routes.ShortenURLPath+"?"+query.Encode(), nil, &resp)
+	return resp.Links, resp.Total, err
+}
+
+func (b *httpBackend) SetLinkStatus(ctx context.Context, code, status string) (*model.URL, error) {
+	action := "/enable"
+	if status == model.URLStatusDisabled {
+		action = "/disable"
+	}
+
+	var link model.URL
+	err := b.do(ctx, http.MethodPost, adminLinkPath(code)+action, nil, &link)
+	return &link, err
+}
+
+func (b *httpBackend) DeleteLink(ctx context.Context, code string) error {
+	return b.do(ctx, http.MethodDelete, adminLinkPath(code), nil, nil)
+}
+
+func (b *httpBackend) LinkStats(ctx context.Context, code string, days int) (*model.URLStats, error) {
+	var stats model.URLStats
+	err := b.do(ctx, http.MethodGet, fmt.Sprintf("%s/stats?days=%d", adminLinkPath(code), days), nil, &stats)
+	return &stats, err
+}
+
+func (b *httpBackend) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	var resp struct {
+		Keys []model.APIKey `json:"keys"`
+	}
+	err := b.do(ctx, http.MethodGet, routes.AdminPrefix+routes.APIKeysPath, nil, &resp)
+	return resp.Keys, err
+}
+
+func (b *httpBackend) CreateAPIKey(ctx context.Context, name string, workspaceID *int) (*model.APIKey, string, error) {
+	var resp struct {
+		Key   model.APIKey `json:"key"`
+		Token string       `json:"token"`
+	}
+	payload := map[string]interface{}{"name": name, "workspaceId": workspaceID}
+	err := b.do(ctx, http.MethodPost, routes.AdminPrefix+routes.APIKeysPath, payload, &resp)
+	return &resp.Key, resp.Token, err
+}
+
+func (b *httpBackend) RevokeAPIKey(ctx context.Context, id int) error {
+	return b.do(ctx, http.MethodDelete, fmt.Sprintf("%s%s/%d", routes.AdminPrefix, routes.APIKeysPath, id), nil, nil)
+}
+
+func (b *httpBackend) Close() error {
+	return nil
+}
+
+func adminLinkPath(code string) string {
+	return routes.AdminPrefix + routes.ShortenURLPath + "/" + url.PathEscape(code)
+}
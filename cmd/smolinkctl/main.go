@@ -0,0 +1,306 @@
+// Command smolinkctl manages links from the terminal, either through the HTTP
+// API or, with -offline, directly against the service's datastores.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"smolink/internal/config"
+	"smolink/internal/model"
+)
+
+const usage = `usage: smolinkctl [flags] <command> [args]
+
+Commands:
+  create <url> [custom-code]     shorten a URL
+  inspect <code>                 show a single link
+  list [-limit N] [-offset N] [-before ID]
+                                 list links, newest first
+  disable <code>                 stop a link from redirecting
+  enable <code>                  re-enable a disabled link
+  delete <code>                  permanently delete a link and its analytics
+  export [-format csv|json] [-out FILE]
+                                 export every link
+  stats <code> [-days N]         print click statistics
+  keys list                      list API keys
+  keys create -workspace ID|none <name>
+                                 create an API key and print its token once;
+                                 keys act as admins of their workspace, and
+                                 "none" makes one outside any workspace that
+                                 can manage every link without a workspace
+  keys revoke <id>               revoke an API key
+
+Flags:
+`
+
+const exportPageSize = 500
+
+func main() {
+	log.SetFlags(0)
+
+	flags := flag.NewFlagSet("smolinkctl", flag.ExitOnError)
+	server := flags.String("server", envOr("SMOLINK_SERVER", "http://localhost:8080"), "smolink API base URL")
+	token := flags.String("token", os.Getenv("SMOLINK_TOKEN"), "API key or admin token")
+	offline := flags.Bool("offline", false, "talk directly to Postgres and Redis using the server environment (POSTGRES_DSN, REDIS_ADDR, ...)")
+	format := flags.String("o", formatTable, "output format: table or json")
+	timeout := flags.Duration("timeout", time.Minute, "overall command timeout")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *format != formatTable && *format != formatJSON {
+		log.Fatalf("unknown output format %q", *format)
+	}
+
+	var b backend
+	if *offline {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			log.Fatalf("Error loading config: %v", err)
+		}
+		ob, err := newOfflineBackend(cfg)
+		if err != nil {
+			log.Fatalf("Offline mode unavailable: %v", err)
+		}
+		b = ob
+	} else {
+		b = newHTTPBackend(*server, *token)
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	p := &printer{out: os.Stdout, format: *format}
+	if err := run(ctx, b, p, flags.Args()); err != nil {
+		if errors.Is(err, errUsage) {
+			flags.Usage()
+			os.Exit(2)
+		}
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+var errUsage = errors.New("invalid usage")
+
+func run(ctx context.Context, b backend, p *printer, args []string) error {
+	cmd, args := args[0], args[1:]
+
+	switch cmd {
+	case "create":
+		if len(args) < 1 || len(args) > 2 {
+			return errUsage
+		}
+		customCode := ""
+		if len(args) == 2 {
+			customCode = args[1]
+		}
+		link, err := b.CreateLink(ctx, args[0], customCode)
+		if err != nil {
+			return err
+		}
+		return p.link(link)
+
+	case "inspect":
+		if len(args) != 1 {
+			return errUsage
+		}
+		link, err := b.GetLink(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return p.link(link)
+
+	case "list":
+		fs := flag.NewFlagSet("list", flag.ExitOnError)
+		limit := fs.Int("limit", 50, "number of links to show")
+		offset := fs.Int("offset", 0, "number of links to skip")
+		before := fs.Int("before", 0, "only list links with a smaller ID")
+		_ = fs.Parse(args)
+
+		links, total, err := b.ListLinks(ctx, *limit, *offset, *before)
+		if err != nil {
+			return err
+		}
+		if err := p.links(links); err != nil {
+			return err
+		}
+		if p.format == formatTable {
+			fmt.Fprintf(p.out, "\nShowing %d of %d links\n", len(links), total)
+		}
+		return nil
+
+	case "disable", "enable":
+		if len(args) != 1 {
+			return errUsage
+		}
+		status := model.URLStatusActive
+		if cmd == "disable" {
+			status = model.URLStatusDisabled
+		}
+		link, err := b.SetLinkStatus(ctx, args[0], status)
+		if err != nil {
+			return err
+		}
+		return p.link(link)
+
+	case "delete":
+		if len(args) != 1 {
+			return errUsage
+		}
+		if err := b.DeleteLink(ctx, args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(p.out, "Deleted %s\n", args[0])
+		return nil
+
+	case "export":
+		fs := flag.NewFlagSet("export", flag.ExitOnError)
+		exportFormat := fs.String("format", formatCSV, "export format: csv or json")
+		outPath := fs.String("out", "", "write to FILE instead of stdout")
+		_ = fs.Parse(args)
+		return export(ctx, b, p.out, *exportFormat, *outPath)
+
+	case "stats":
+		fs := flag.NewFlagSet("stats", flag.ExitOnError)
+		days := fs.Int("days", 30, "number of days to aggregate")
+		_ = fs.Parse(args)
+		if fs.NArg() != 1 {
+			return errUsage
+		}
+		stats, err := b.LinkStats(ctx, fs.Arg(0), *days)
+		if err != nil {
+			return err
+		}
+		return p.stats(stats)
+
+	case "keys":
+		return runKeys(ctx, b, p, args)
+	}
+
+	return errUsage
+}
+
+func runKeys(ctx context.Context, b backend, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		keys, err := b.ListAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+		return p.apiKeys(keys)
+
+	case "create":
+		fs := flag.NewFlagSet("keys create", flag.ExitOnError)
+		workspace := fs.String("workspace", "", `workspace ID the key acts in, or "none"`)
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 || *workspace == "" {
+			return errUsage
+		}
+		workspaceID, err := parseWorkspace(*workspace)
+		if err != nil {
+			return err
+		}
+		key, token, err := b.CreateAPIKey(ctx, fs.Arg(0), workspaceID)
+		if err != nil {
+			return err
+		}
+		if p.format == formatJSON {
+			return p.json(map[string]interface{}{"key": key, "token": token})
+		}
+		if err := p.apiKeys([]model.APIKey{*key}); err != nil {
+			return err
+		}
+		fmt.Fprintf(p.out, "\nToken (shown only once): %s\n", token)
+		return nil
+
+	case "revoke":
+		if len(args) != 2 {
+			return errUsage
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid key id %q", args[1])
+		}
+		if err := b.RevokeAPIKey(ctx, id); err != nil {
+			return err
+		}
+		fmt.Fprintf(p.out, "Revoked key %d\n", id)
+		return nil
+	}
+
+	return errUsage
+}
+
+func export(ctx context.Context, b backend, stdout io.Writer, format, outPath string) error {
+	if format != formatCSV && format != formatJSON {
+		return fmt.Errorf("unknown export format %q", format)
+	}
+
+	// Page by ID rather than offset, so links created during the export
+	// neither shift rows into the next page nor get exported twice.
+	var links []model.URL
+	for before := 0; ; {
+		page, _, err := b.ListLinks(ctx, exportPageSize, 0, before)
+		if err != nil {
+			return err
+		}
+		links = append(links, page...)
+		if len(page) < exportPageSize {
+			break
+		}
+		before = page[len(page)-1].ID
+	}
+
+	out := stdout
+	if outPath != "" {
+		f, err := os.Create(outPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if format == formatJSON {
+		return (&printer{out: out}).json(links)
+	}
+	return exportCSV(out, links)
+}
+
+// parseWorkspace reads a workspace ID, or "none" for no workspace.
+func parseWorkspace(value string) (*int, error) {
+	if value == "none" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid workspace %q", value)
+	}
+	return &id, nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"smolink/internal/errors"
+	"smolink/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend serves links newest first from memory. onList runs after every
+// ListLinks call, e.g. to create links mid-export.
+type fakeBackend struct {
+	links   []model.URL
+	nextID  int
+	onList  func(*fakeBackend)
+	created []*int
+}
+
+func newFakeBackend(count int) *fakeBackend {
+	b := &fakeBackend{}
+	for i := 0; i < count; i++ {
+		b.add(fmt.Sprintf("https://example.com/%d", i))
+	}
+	return b
+}
+
+func (b *fakeBackend) add(url string) {
+	b.nextID++
+	b.links = append(b.links, model.URL{ID: b.nextID, ShortCode: fmt.Sprintf("c%d", b.nextID), OriginalURL: url, Status: model.URLStatusActive})
+}
+
+func (b *fakeBackend) CreateLink(_ context.Context, url, customCode string) (*model.URL, error) {
+	b.add(url)
+	return &b.links[len(b.links)-1], nil
+}
+
+func (b *fakeBackend) GetLink(_ context.Context, code string) (*model.URL, error) {
+	for _, link := range b.links {
+		if link.ShortCode == code {
+			return &link, nil
+		}
+	}
+	return nil, errors.ErrShortCodeNotFound
+}
+
+func (b *fakeBackend) ListLinks(_ context.Context, limit, offset, before int) ([]model.URL, int, error) {
+	var matching []model.URL
+	for i := len(b.links) - 1; i >= 0; i-- {
+		if before <= 0 || b.links[i].ID < before {
+			matching = append(matching, b.links[i])
+		}
+	}
+	if offset > len(matching) {
+		offset = len(matching)
+	}
+	page := matching[offset:]
+	if len(page) > limit {
+		page = page[:limit]
+	}
+	page = append([]model.URL(nil), page...)
+	if b.onList != nil {
+		b.onList(b)
+	}
+	return page, len(b.links), nil
+}
+
+func (b *fakeBackend) SetLinkStatus(ctx context.Context, code, status string) (*model.URL, error) {
+	for i := range b.links {
+		if b.links[i].ShortCode == code {
+			b.links[i].Status = status
+			return &b.links[i], nil
+		}
+	}
+	return nil, errors.ErrShortCodeNotFound
+}
+
+func (b *fakeBackend) DeleteLink(context.Context, string) error { return nil }
+
+func (b *fakeBackend) LinkStats(_ context.Context, code string, days int) (*model.URLStats, error) {
+	return &model.URLStats{ShortCode: code}, nil
+}
+
+func (b *fakeBackend) ListAPIKeys(context.Context) ([]model.APIKey, error) { return nil, nil }
+
+func (b *fakeBackend) CreateAPIKey(_ context.Context, name string, workspaceID *int) (*model.APIKey, string, error) {
+	b.created = append(b.created, workspaceID)
+	return &model.APIKey{ID: len(b.created), Name: name, Prefix: "smk_abcdef", WorkspaceID: workspaceID}, "smk_token", nil
+}
+
+func (b *fakeBackend) RevokeAPIKey(context.Context, int) error { return nil }
+
+func (b *fakeBackend) Close() error { return nil }
+
+func TestRunRejectsInvalidUsage(t *testing.T) {
+	tests := [][]string{
+		{"create"},
+		{"create", "https://example.com", "code", "extra"},
+		{"inspect"},
+		{"disable"},
+		{"delete", "a", "b"},
+		{"stats"},
+		{"keys"},
+		{"keys", "create", "ci-bot"},
+		{"keys", "create", "-workspace", "1"},
+		{"keys", "revoke"},
+		{"keys", "rotate"},
+		{"unknown"},
+	}
+	for _, args := range tests {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			p := &printer{out: &bytes.Buffer{}, format: formatTable}
+			assert.ErrorIs(t, run(context.Background(), newFakeBackend(1), p, args), errUsage)
+		})
+	}
+}
+
+func TestRunKeysCreateWorkspace(t *testing.T) {
+	tests := []struct {
+		workspace string
+		want      *int
+		wantErr   bool
+	}{
+		{workspace: "3", want: intPtr(3)},
+		{workspace: "none", want: nil},
+		{workspace: "0", wantErr: true},
+		{workspace: "brand", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.workspace, func(t *testing.T) {
+			b := newFakeBackend(0)
+			out := &bytes.Buffer{}
+			err := run(context.Background(), b, &printer{out: out, format: formatTable}, []string{"keys", "create", "-workspace", tt.workspace, "ci-bot"})
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Empty(t, b.created)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, b.created, 1)
+			assert.Equal(t, tt.want, b.created[0])
+			assert.Contains(t, out.String(), "Token (shown only once): smk_token")
+		})
+	}
+}
+
+func TestRunDisableAndEnable(t *testing.T) {
+	b := newFakeBackend(1)
+	p := &printer{out: &bytes.Buffer{}, format: formatJSON}
+
+	require.NoError(t, run(context.Background(), b, p, []string{"disable", "c1"}))
+	assert.Equal(t, model.URLStatusDisabled, b.links[0].Status)
+	require.NoError(t, run(context.Background(), b, p, []string{"enable", "c1"}))
+	assert.Equal(t, model.URLStatusActive, b.links[0].Status)
+}
+
+func TestExportPagesByID(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+	}{
+		{name: "empty", count: 0},
+		{name: "single page", count: 10},
+		{name: "exact pages", count: 2 * exportPageSize},
+		{name: "partial last page", count: 2*exportPageSize + 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newFakeBackend(tt.count)
+			// Links created during the export must not shift later pages
+			b.onList = func(b *fakeBackend) { b.add("https://example.com/new") }
+
+			out := &bytes.Buffer{}
+			require.NoError(t, export(context.Background(), b, out, formatJSON, ""))
+			var links []model.URL
+			require.NoError(t, json.Unmarshal(out.Bytes(), &links))
+
+			ids := make([]int, 0, len(links))
+			for _, link := range links {
+				ids = append(ids, link.ID)
+			}
+			require.True(t, sort.SliceIsSorted(ids, func(i, j int) bool { return ids[i] > ids[j] }), "links must be newest first without duplicates")
+			seen := map[int]bool{}
+			for _, id := range ids {
+				assert.False(t, seen[id], "link %d exported twice", id)
+				seen[id] = true
+			}
+			for id := 1; id <= tt.count; id++ {
+				assert.True(t, seen[id], "link %d missing", id)
+			}
+		})
+	}
+}
+
+func TestExportRejectsUnknownFormat(t *testing.T) {
+	assert.Error(t, export(context.Background(), newFakeBackend(1), &bytes.Buffer{}, "xml", ""))
+}
+
+func TestPrinterLinks(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 0, 0, time.Local)
+	links := []model.URL{
+		{ID: 1, ShortCode: "promo", OriginalURL: "https://example.com", Status: model.URLStatusActive, ClickCount: 12, CreatedAt: created},
+		{ID: 2, ShortCode: "old", OriginalURL: "https://example.org", Status: model.URLStatusDisabled, CreatedAt: created},
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{format: formatTable, want: []string{
+			"CODE   STATUS    CLICKS  CREATED           DESTINATION",
+			"promo  active    12      2026-01-02 03:04  https://example.com",
+			"old    disabled  0       2026-01-02 03:04  https://example.org",
+		}},
+		{format: formatJSON, want: []string{`"short_code": "promo"`, `"click_count": 12`, `"status": "disabled"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			require.NoError(t, (&printer{out: out, format: tt.format}).links(links))
+			for _, want := range tt.want {
+				assert.Contains(t, out.String(), want)
+			}
+		})
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	links := []model.URL{
+		{ID: 7, ShortCode: "promo", OriginalURL: "https://example.com/?a=1,b=2", Status: model.URLStatusActive, ClickCount: 3, CreatedAt: created},
+	}
+
+	out := &bytes.Buffer{}
+	require.NoError(t, exportCSV(out, links))
+	assert.Equal(t, "id,short_code,original_url,status,click_count,created_at\n"+
+		`7,promo,"https://example.com/?a=1,b=2",active,3,2026-01-02T03:04:05Z`+"\n", out.String())
+}
+
+func TestHTTPBackend(t *testing.T) {
+	var requests []*http.Request
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+
+		switch {
+		case r.URL.Path == "/api/v1/admin/links" && r.Method == http.MethodGet:
+			fmt.Fprint(w, `{"links":[{"id":4,"short_code":"promo"}],"total":9}`)
+		case r.URL.Path == "/api/v1/admin/api-keys" && r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"key":{"id":2,"name":"ci-bot"},"token":"smk_token"}`)
+		case r.URL.Path == "/api/v1/admin/links/missing":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":"NOT_FOUND","message":"Short code does not exist"}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	b := newHTTPBackend(server.URL+"/", "secret")
+	ctx := context.Background()
+
+	links, total, err := b.ListLinks(ctx, 50, 0, 12)
+	require.NoError(t, err)
+	assert.Equal(t, 9, total)
+	require.Len(t, links, 1)
+	assert.Equal(t, "promo", links[0].ShortCode)
+	assert.Equal(t, "Bearer secret", requests[0].Header.Get("Authorization"))
+	assert.Equal(t, "50", requests[0].URL.Query().Get("limit"))
+	assert.Equal(t, "12", requests[0].URL.Query().Get("before"))
+
+	_, token, err := b.CreateAPIKey(ctx, "ci-bot", intPtr(3))
+	require.NoError(t, err)
+	assert.Equal(t, "smk_token", token)
+	assert.Equal(t, map[string]interface{}{"name": "ci-bot", "workspaceId": float64(3)}, bodies[1])
+
+	_, err = b.GetLink(ctx, "missing")
+	var apiErr *errors.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.Status)
+	assert.Equal(t, "NOT_FOUND", apiErr.Code)
+
+	err = b.DeleteLink(ctx, "boom")
+	assert.EqualError(t, err, "request failed with status 500")
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	"smolink/internal/config"
+	"smolink/internal/model"
+	"smolink/internal/repository"
+	"smolink/internal/service"
+	"smolink/internal/shortcode"
+	"smolink/pkg/database"
+)
+
+// offlineAccess treats direct database access like the admin token.
+var offlineAccess = service.Access{Admin: true, Actor: "smolinkctl"}
+
+// offlineBackend runs the service layer in-process against the same Postgres
+// and Redis the server uses, for when the HTTP API is unreachable.
+type offlineBackend struct {
+	urls    *service.URLService
+	keys    *service.APIKeyService
+	domains *service.DomainService
+	close   func() error
+}
+
+func newOfflineBackend(cfg *config.Config) (*offlineBackend, error) {
+	pgDB, err := database.NewPostgresDB(cfg.PostgresDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	redisDB, err := database.NewRedisDB(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
+	if err != nil {
+		pgDB.Close()
+		return nil, err
+	}
+
+	pgRepo := repository.NewPostgresRepository(pgDB.Pool)
+	generators, err := shortcode.NewRegistry(cfg.CodeGeneratorOptions(), pgRepo)
+	if err != nil {
+		pgDB.Close()
+		_ = redisDB.Close()
+		return nil, err
+	}
+	// No local tier: the CLI only needs to evict and broadcast invalidations
+	redisRepo := repository.NewRedisRepository(redisDB.Client)
+	urlCache := repository.NewTieredCache(redisRepo, 0, 0)
+
+	// There is no router here, so only the RESERVED_CODES from config are
+	// reserved on top of the charset, length and blocked-term checks.
+	validator := shortcode.NewValidator(cfg.CodeValidatorOptions())
+	domains := service.NewDomainService(pgRepo, net.DefaultResolver, cfg.DomainCacheTTL)
+	signer, err := cfg.SigningKeySet()
+	if err != nil {
+		pgDB.Close()
+		_ = redisDB.Close()
+		return nil, err
+	}
+
+	return &offlineBackend{
+		urls:    service.NewURLService(pgRepo, urlCache, generators, validator, domains, signer, service.NewUsageService(pgRepo, redisRepo, cfg), cfg),
+		keys:    service.NewAPIKeyService(pgRepo),
+		domains: domains,
+		close: func() error {
+			pgDB.Close()
+			return redisDB.Close()
+		},
+	}, nil
+}
+
+func (b *offlineBackend) CreateLink(ctx context.Context, originalURL, customCode string) (*model.URL, error) {
+	link, _, err := b.urls.ShortenURL(ctx, service.ShortenRequest{URL: originalURL, CustomCode: customCode, Access: offlineAccess})
+	if err != nil {
+		return nil, err
+	}
+	return b.urls.GetURL(ctx, offlineAccess, service.LinkRef{Code: link.ShortCode})
+}
+
+func (b *offlineBackend) GetLink(ctx context.Context, code string) (*model.URL, error) {
+	return b.urls.GetURL(ctx, offlineAccess, service.LinkRef{Code: code})
+}
+
+func (b *offlineBackend) ListLinks(ctx context.Context, limit, offset, before int) ([]model.URL, int, error) {
+	return b.urls.ListURLs(ctx, offlineAccess, limit, offset, before)
+}
+
+func (b *offlineBackend) SetLinkStatus(ctx context.Context, code, status string) (*model.URL, error) {
+	return b.urls.SetStatus(ctx, offlineAccess, service.LinkRef{Code: code}, status)
+}
+
+func (b *offlineBackend) DeleteLink(ctx context.Context, code string) error {
+	return b.urls.DeleteURL(ctx, offlineAccess, service.LinkRef{Code: code})
+}
+
+func (b *offlineBackend) LinkStats(ctx context.Context, code string, days int) (*model.URLStats, error) {
+	return b.urls.GetStats(ctx, offlineAccess, service.LinkRef{Code: code}, days)
+}
+
+func (b *offlineBackend) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	return b.keys.ListKeys(ctx, offlineAccess)
+}
+
+func (b *offlineBackend) CreateAPIKey(ctx context.Context, name string, workspaceID *int) (*model.APIKey, string, error) {
+	if workspaceID != nil {
+		if err := b.domains.CheckWorkspace(ctx, *workspaceID); err != nil {
+			return nil, "", err
+		}
+	}
+	return b.keys.CreateKey(ctx, name, workspaceID)
+}
+
+func (b *offlineBackend) RevokeAPIKey(ctx context.Context, id int) error {
+	return b.keys.RevokeKey(ctx, offlineAccess, id)
+}
+
+func (b *offlineBackend) Close() error {
+	return b.close()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"smolink/internal/model"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+type printer struct {
+	out    io.Writer
+	format string
+}
+
+func (p *printer) json(v interface{}) error {
+	enc := json.NewEncoder(p.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (p *printer) table(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	writeRow := func(cols []string) {
+		for i, col := range cols {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, col)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	writeRow(header)
+	for _, row := range rows {
+		writeRow(row)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) links(links []model.URL) error {
+	if p.format == formatJSON {
+		return p.json(links)
+	}
+
+	rows := make([][]string, 0, len(links))
+	for _, link := range links {
+		rows = append(rows, linkRow(link))
+	}
+	return p.table(linkHeader, rows)
+}
+
+func (p *printer) link(link *model.URL) error {
+	if p.format == formatJSON {
+		return p.json(link)
+	}
+	return p.table(linkHeader, [][]string{linkRow(*link)})
+}
+
+func (p *printer) stats(stats *model.URLStats) error {
+	if p.format == formatJSON {
+		return p.json(stats)
+	}
+
+	lastAccessed := "-"
+	if stats.LastAccessedAt != nil {
+		lastAccessed = formatTime(*stats.LastAccessedAt)
+	}
+	if err := p.table(
+		[]string{"CODE", "CLICKS", "UNIQUE VISITORS", "LAST ACCESSED"},
+		[][]string{{stats.ShortCode, strconv.Itoa(stats.TotalClicks), strconv.Itoa(stats.UniqueVisitors), lastAccessed}},
+	); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(p.out)
+	daily := make([][]string, 0, len(stats.DailyClicks))
+	for _, day := range stats.DailyClicks {
+		daily = append(daily, []string{day.Date, strconv.Itoa(day.Clicks)})
+	}
+	if err := p.table([]string{"DATE", "CLICKS"}, daily); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(p.out)
+	agents := make([][]string, 0, len(stats.TopUserAgents))
+	for _, ua := range stats.TopUserAgents {
+		agents = append(agents, []string{strconv.Itoa(ua.Clicks), ua.UserAgent})
+	}
+	return p.table([]string{"CLICKS", "USER AGENT"}, agents)
+}
+
+func (p *printer) apiKeys(keys []model.APIKey) error {
+	if p.format == formatJSON {
+		return p.json(keys)
+	}
+
+	rows := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		lastUsed, revoked := "-", "-"
+		if key.LastUsedAt != nil {
+			lastUsed = formatTime(*key.LastUsedAt)
+		}
+		if key.RevokedAt != nil {
+			revoked = formatTime(*key.RevokedAt)
+		}
+		rows = append(rows, []string{strconv.Itoa(key.ID), key.Name, key.Prefix + "…", formatTime(key.CreatedAt), lastUsed, revoked})
+	}
+	return p.table([]string{"ID", "NAME", "PREFIX", "CREATED", "LAST USED", "REVOKED"}, rows)
+}
+
+var linkHeader = []string{"CODE", "STATUS", "CLICKS", "CREATED", "DESTINATION"}
+
+func linkRow(link model.URL) []string {
+	return []string{link.ShortCode, link.Status, strconv.Itoa(link.ClickCount), formatTime(link.CreatedAt), link.OriginalURL}
+}
+
+func formatTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// exportCSV writes one row per link in a stable, spreadsheet-friendly layout.
+func exportCSV(out io.Writer, links []model.URL) error {
+	w := csv.NewWriter(out)
+	_ = w.Write([]string{"id", "short_code", "original_url", "status", "click_count", "created_at"})
+	for _, link := range links {
+		_ = w.Write([]string{
+			strconv.Itoa(link.ID),
+			link.ShortCode,
+			link.OriginalURL,
+			link.Status,
+			strconv.Itoa(link.ClickCount),
+			link.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -1,14 +1,21 @@
 package app
 
 import (
+	"context"
+	"net"
 	"net/http"
 
+	"smolink/internal/auth"
 	"smolink/internal/config"
 	"smolink/internal/controller"
+	"smolink/internal/health"
+	"smolink/internal/migration"
 	"smolink/internal/repository"
 	"smolink/internal/routes"
 	"smolink/internal/service"
+	"smolink/internal/shortcode"
 	"smolink/pkg/database"
+	"smolink/pkg/metrics"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,8 +24,14 @@ type App struct {
 	Router        *gin.Engine
 	PGRepo        *repository.PostgresRepository
 	RedisRepo     *repository.RedisRepository
+	URLCache      *repository.TieredCache
 	URLService    *service.URLService
+	DomainService *service.DomainService
+	APIKeyService *service.APIKeyService
+	UserService   *service.UserService
+	UsageService  *service.UsageService
 	URLController *controller.URLController
+	HealthChecker *health.Checker
 	DBCloser      func() error
 }
 
@@ -35,15 +48,50 @@ func NewApp(cfg *config.Config, includeRootRoutes bool) (*App, error) {
 
 	pgRepo := repository.NewPostgresRepository(pgDB.Pool)
 	redisRepo := repository.NewRedisRepository(redisClient.Client)
-	urlService := service.NewURLService(pgRepo, redisRepo)
-	urlController := controller.NewURLController(urlService)
+	urlCache := repository.NewTieredCache(redisRepo, cfg.LocalCacheSize, cfg.LocalCacheTTL)
+	generators, err := shortcode.NewRegistry(cfg.CodeGeneratorOptions(), pgRepo)
+	if err != nil {
+		return nil, err
+	}
+	validator := shortcode.NewValidator(cfg.CodeValidatorOptions())
+	signer, err := cfg.SigningKeySet()
+	if err != nil {
+		return nil, err
+	}
+	domainService := service.NewDomainService(pgRepo, net.DefaultResolver, cfg.DomainCacheTTL)
+	usageService := service.NewUsageService(pgRepo, redisRepo, cfg)
+	urlService := service.NewURLService(pgRepo, urlCache, generators, validator, domainService, signer, usageService, cfg)
+	apiKeyService := service.NewAPIKeyService(pgRepo)
+	userService := service.NewUserService(pgRepo, redisRepo, cfg.Mailer(), cfg)
+	ssoService := service.NewSSOService(cfg.OIDCProvider(), pgRepo, redisRepo, userService, cfg)
+	urlController := controller.NewURLController(urlService, domainService, service.NewIdempotencyService(redisRepo, cfg), cfg)
+	adminController := controller.NewAdminController(urlService, apiKeyService, domainService, cfg)
+	domainController := controller.NewDomainController(domainService)
+	userController := controller.NewUserController(userService, ssoService)
+	usageController := controller.NewUsageController(usageService)
+	authenticator := auth.NewAuthenticator(cfg.AdminToken, apiKeyService, userService)
+
+	healthChecker := health.NewChecker(cfg.HealthCheckTimeout,
+		health.Check{Name: "postgres", Critical: true, Probe: pgRepo.Ping},
+		health.Check{Name: "redis", Critical: false, Probe: redisRepo.Ping},
+		health.Check{Name: "migrations", Critical: true, Probe: func(ctx context.Context) error {
+			return migration.CheckVersion(ctx, pgDB.Pool)
+		}},
+	)
+	healthController := controller.NewHealthController(healthChecker)
+
+	metricsRegistry := metrics.NewRegistry()
+	registerCodeMetrics(metricsRegistry, generators.Random())
 
 	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
 
-	routes.SetupRoutes(router, urlController)
+	routes.SetupRoutes(router, urlController, healthController, adminController, domainController, userController, usageController, authenticator, usageService, metricsRegistry)
 
 	if includeRootRoutes {
-		router.GET("/", func(c *gin.Context) {
+		urlController.SetHome(func(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{
 				"message": "Ah, you don reach home. Welcome to the smolink service. We dey for you!",
 			})
@@ -62,15 +110,46 @@ func NewApp(cfg *config.Config, includeRootRoutes bool) (*App, error) {
 		})
 	}
 
+	// Routes are registered before the first request, so the validator is
+	// still private to this goroutine here.
+	validator.Reserve(routes.ReservedWords(router)...)
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	go urlCache.Listen(backgroundCtx)
+	go generators.RefreshLoop(backgroundCtx, cfg.CodeUtilizationInterval)
+	go usageService.SaveLoop(backgroundCtx, cfg.UsageSaveInterval)
+
 	return &App{
 		Router:        router,
 		PGRepo:        pgRepo,
 		RedisRepo:     redisRepo,
+		URLCache:      urlCache,
 		URLService:    urlService,
+		DomainService: domainService,
+		APIKeyService: apiKeyService,
+		UserService:   userService,
+		UsageService:  usageService,
 		URLController: urlController,
+		HealthChecker: healthChecker,
 		DBCloser: func() error {
+			stopBackground()
 			pgDB.Close()
-			return nil
+			return redisClient.Close()
 		},
 	}, nil
 }
+
+func registerCodeMetrics(registry *metrics.Registry, generator *shortcode.Adaptive) {
+	registry.Gauge("smolink_shortcode_length", "Current length of generated random short codes.", func() float64 {
+		return float64(generator.Stats().Length)
+	})
+	registry.Gauge("smolink_shortcode_keyspace_utilization", "Fraction of the current-length keyspace already in use.", func() float64 {
+		return generator.Stats().Utilization
+	})
+	registry.Counter("smolink_shortcode_collisions_total", "Generated short codes rejected because they already existed.", func() float64 {
+		return float64(generator.Stats().Collisions)
+	})
+	registry.Counter("smolink_shortcode_length_growths_total", "Times the generated short code length was increased.", func() float64 {
+		return float64(generator.Stats().Growths)
+	})
+}
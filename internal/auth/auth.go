@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"slices"
+	"strconv"
+	"strings"
+
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PrincipalAdmin  = "admin"
+	PrincipalAPIKey = "api_key"
+	PrincipalUser   = "user"
+
+	// WorkspaceHeader picks which of a user's workspaces a session request
+	// acts on; without it the oldest membership is used.
+	WorkspaceHeader = "X-Workspace-ID"
+
+	principalContextKey = "principal"
+)
+
+// Principal identifies who is calling a protected route. Role is the
+// principal's role in WorkspaceID: API keys act as admins of their workspace.
+type Principal struct {
+	Kind        string `json:"kind"`
+	ID          int    `json:"id,omitempty"`
+	Name        string `json:"name"`
+	WorkspaceID *int   `json:"workspace_id,omitempty"`
+	Role        string `json:"role,omitempty"`
+}
+
+// Access is what the principal may touch; nil principals get no workspace.
+func (p *Principal) Access() service.Access {
+	if p == nil {
+		return service.Access{}
+	}
+	return service.Access{Admin: p.Kind == PrincipalAdmin, WorkspaceID: p.WorkspaceID, Role: p.Role, Actor: p.String()}
+}
+
+// String identifies the principal in link history, e.g. "api_key:12" or
+// "user:3".
+func (p *Principal) String() string {
+	if p.Kind == PrincipalAdmin {
+		return PrincipalAdmin
+	}
+	return p.Kind + ":" + strconv.Itoa(p.ID)
+}
+
+type Authenticator struct {
+	adminToken string
+	keys       *service.APIKeyService
+	users      *service.UserService
+}
+
+func NewAuthenticator(adminToken string, keys *service.APIKeyService, users *service.UserService) *Authenticator {
+	return &Authenticator{adminToken: adminToken, keys: keys, users: users}
+}
+
+// RequireAuth accepts the configured admin token, an active API key or a user
+// session as a bearer token.
+func (a *Authenticator) RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := BearerToken(c)
+		if token == "" {
+			abort(c, errors.ErrUnauthorized)
+			return
+		}
+
+		principal, err := a.authenticate(c, token)
+		if err != nil {
+			abort(c, err)
+			return
+		}
+		c.Set(principalContextKey, principal)
+		c.Next()
+	}
+}
+
+// OptionalAuth lets anonymous requests through but still rejects invalid
+// tokens, so public routes can grant more to authenticated callers.
+func (a *Authenticator) OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := BearerToken(c)
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		principal, err := a.authenticate(c, token)
+		if err != nil {
+			abort(c, err)
+			return
+		}
+		c.Set(principalContextKey, principal)
+		c.Next()
+	}
+}
+
+// RequireAdmin only admits the admin token. It must run after RequireAuth.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if principal := PrincipalFrom(c); principal == nil || principal.Kind != PrincipalAdmin {
+			abort(c, errors.ErrForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole admits the admin token and principals holding at least role in
+// their workspace. It must run after RequireAuth.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := PrincipalFrom(c)
+		if principal == nil {
+			abort(c, errors.ErrUnauthorized)
+			return
+		}
+		if principal.Kind != PrincipalAdmin && !model.RoleAtLeast(principal.Role, role) {
+			abort(c, errors.ErrForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRoleIfAuthenticated is RequireRole for public routes: anonymous
+// callers pass, everyone else needs role.
+func RequireRoleIfAuthenticated(role string) gin.HandlerFunc {
+	require := RequireRole(role)
+	return func(c *gin.Context) {
+		if PrincipalFrom(c) == nil {
+			c.Next()
+			return
+		}
+		require(c)
+	}
+}
+
+// MeterRequests counts the request against the caller's API request quota.
+// It must run after RequireAuth or OptionalAuth; anonymous callers and the
+// admin token are not metered.
+func MeterRequests(usage *service.UsageService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if principal := PrincipalFrom(c); principal != nil {
+			if err := usage.Reserve(c, principal.WorkspaceID, model.MetricAPIRequests, 1); err != nil {
+				abort(c, err)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func (a *Authenticator) authenticate(c *gin.Context, token string) (*Principal, error) {
+	if a.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) == 1 {
+		return &Principal{Kind: PrincipalAdmin, Name: PrincipalAdmin}, nil
+	}
+
+	if strings.HasPrefix(token, service.SessionPrefix) {
+		return a.authenticateUser(c, token)
+	}
+
+	key, err := a.keys.Authenticate(c, token)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Kind: PrincipalAPIKey, ID: key.ID, Name: key.Name, WorkspaceID: key.WorkspaceID, Role: model.RoleAdmin}, nil
+}
+
+// authenticateUser acts on the workspace named by WorkspaceHeader, or the user's
+// oldest membership. Users who belong to no workspace get no role.
+func (a *Authenticator) authenticateUser(c *gin.Context, token string) (*Principal, error) {
+	user, err := a.users.Authenticate(c, token)
+	if err != nil {
+		return nil, err
+	}
+	memberships, err := a.users.Memberships(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{Kind: PrincipalUser, ID: user.ID, Name: user.Email}
+	if header := c.GetHeader(WorkspaceHeader); header != "" {
+		workspaceID, err := strconv.Atoi(header)
+		if err != nil {
+			return nil, errors.ErrForbidden
+		}
+		index := slices.IndexFunc(memberships, func(m model.Membership) bool { return m.WorkspaceID == workspaceID })
+		if index < 0 {
+			return nil, errors.ErrForbidden
+		}
+		memberships = memberships[index:]
+	}
+	if len(memberships) > 0 {
+		principal.WorkspaceID = &memberships[0].WorkspaceID
+		principal.Role = memberships[0].Role
+	}
+	return principal, nil
+}
+
+// PrincipalFrom returns the authenticated caller, or nil on public routes.
+func PrincipalFrom(c *gin.Context) *Principal {
+	if value, ok := c.Get(principalContextKey); ok {
+		if principal, ok := value.(*Principal); ok {
+			return principal
+		}
+	}
+	return nil
+}
+
+// BearerToken returns the request's bearer token, or "" without one.
+func BearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func abort(c *gin.Context, err error) {
+	apiErr := errors.ExtractAPIError(err)
+	c.AbortWithStatusJSON(apiErr.Status, apiErr)
+}
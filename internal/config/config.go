@@ -3,13 +3,27 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"smolink/internal/mail"
+	"smolink/internal/model"
+	"smolink/internal/oidc"
+	"smolink/internal/shortcode"
+	"smolink/internal/signing"
+	"smolink/pkg/utils"
 
 	"github.com/joho/godotenv"
 )
 
+// maxShortCodeLength is the width of the urls.short_code column.
+const maxShortCodeLength = 20
+
 type Config struct {
 	Environment     string
 	ServerPort      string
@@ -19,6 +33,76 @@ type Config struct {
 	RedisPassword   string
 	WebhookEndpoint string
 	ClickThreshold  int
+	AdminToken      string
+	PublicBaseURL   string
+	// TrustedProxies lists the IPs and CIDR ranges of the reverse proxies
+	// whose X-Forwarded-For and X-Forwarded-Proto headers are believed.
+	TrustedProxies []string
+
+	HealthCheckTimeout time.Duration
+	AutoMigrate        bool
+
+	CacheTTL         time.Duration
+	NegativeCacheTTL time.Duration
+	LocalCacheSize   int
+	LocalCacheTTL    time.Duration
+
+	CodeStrategy  string
+	CodeAlphabet  string
+	CodeLength    int
+	CodeSalt      string
+	CodeSyllables int
+
+	CodeMaxLength            int
+	CodeUtilizationThreshold float64
+	CodeUtilizationInterval  time.Duration
+
+	CustomCodeCharset   string
+	CustomCodeMinLength int
+	CustomCodeMaxLength int
+	ReservedCodes       []string
+	BlockedCodeTerms    []string
+
+	DomainCacheTTL time.Duration
+
+	RedirectCacheMaxAge time.Duration
+	ReferrerPolicy      string
+
+	// SigningKeys maps key IDs to secrets for signed links; SigningKeyID
+	// picks the one new signatures use.
+	SigningKeys      map[string]string
+	SigningKeyID     string
+	SignedLinkMaxTTL time.Duration
+
+	SessionTTL       time.Duration
+	PasswordResetTTL time.Duration
+	// PasswordResetURL is where reset emails link to, with the token
+	// appended as ?token=; without it the email carries the bare token.
+	PasswordResetURL string
+
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+
+	// OIDC single sign-on is enabled when OIDCIssuer is set.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
+	OIDCGroupsClaim  string
+	OIDCGroupRoles   []model.GroupRole
+
+	// Monthly quotas of workspaces that do not set their own; 0 is unlimited.
+	QuotaLinksCreated   int
+	QuotaAPIRequests    int
+	QuotaClicksRecorded int
+	UsageSaveInterval   time.Duration
+
+	// IdempotencyKeyTTL is how long responses are kept for retries under the
+	// same Idempotency-Key.
+	IdempotencyKeyTTL time.Duration
 }
 
 func LoadConfig() (*Config, error) {
@@ -42,6 +126,47 @@ func LoadConfig() (*Config, error) {
 		return fallback
 	}
 
+	// Helper to get float env vars
+	getEnvFloat := func(key string, fallback float64) float64 {
+		if value, exists := os.LookupEnv(key); exists {
+			if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+				return floatValue
+			}
+		}
+		return fallback
+	}
+
+	// Helper to get boolean env vars
+	getEnvBool := func(key string, fallback bool) bool {
+		if value, exists := os.LookupEnv(key); exists {
+			if boolValue, err := strconv.ParseBool(value); err == nil {
+				return boolValue
+			}
+		}
+		return fallback
+	}
+
+	// Helper to get duration env vars such as "2s" or "500ms"
+	getEnvDuration := func(key string, fallback time.Duration) time.Duration {
+		if value, exists := os.LookupEnv(key); exists {
+			if d, err := time.ParseDuration(value); err == nil {
+				return d
+			}
+		}
+		return fallback
+	}
+
+	// Helper to get comma-separated env vars
+	getEnvList := func(key string) []string {
+		var list []string
+		for _, item := range strings.Split(getEnv(key, ""), ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+
 	port := getEnv("PORT", getEnv("SERVER_PORT", "8080"))
 	if !strings.HasPrefix(port, ":") {
 		port = ":" + port
@@ -56,6 +181,92 @@ func LoadConfig() (*Config, error) {
 		RedisDB:         getEnvInt("REDIS_DB", 0),
 		WebhookEndpoint: getEnv("WEBHOOK_ENDPOINT", ""),
 		ClickThreshold:  getEnvInt("CLICK_THRESHOLD", 10), // Default 10 clicks
+		AdminToken:      getEnv("ADMIN_TOKEN", ""),
+		PublicBaseURL:   strings.TrimSuffix(getEnv("PUBLIC_BASE_URL", ""), "/"),
+		TrustedProxies:  getEnvList("TRUSTED_PROXIES"),
+
+		HealthCheckTimeout: getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+		AutoMigrate:        getEnvBool("AUTO_MIGRATE", true),
+
+		CacheTTL:         getEnvDuration("CACHE_TTL", 24*time.Hour),
+		NegativeCacheTTL: getEnvDuration("NEGATIVE_CACHE_TTL", time.Minute),
+		LocalCacheSize:   getEnvInt("LOCAL_CACHE_SIZE", 10000),
+		LocalCacheTTL:    getEnvDuration("LOCAL_CACHE_TTL", 30*time.Second),
+
+		CodeStrategy:  getEnv("CODE_STRATEGY", "random"),
+		CodeAlphabet:  getEnv("CODE_ALPHABET", utils.Base62Alphabet),
+		CodeLength:    getEnvInt("CODE_LENGTH", 6),
+		CodeSalt:      getEnv("CODE_SALT", ""),
+		CodeSyllables: getEnvInt("CODE_SYLLABLES", 4),
+
+		CodeMaxLength:            getEnvInt("CODE_MAX_LENGTH", 12),
+		CodeUtilizationThreshold: getEnvFloat("CODE_UTILIZATION_THRESHOLD", 0.01),
+		CodeUtilizationInterval:  getEnvDuration("CODE_UTILIZATION_INTERVAL", time.Minute),
+
+		CustomCodeCharset:   getEnv("CUSTOM_CODE_CHARSET", utils.Base62Alphabet+"-_"),
+		CustomCodeMinLength: getEnvInt("CUSTOM_CODE_MIN_LENGTH", 3),
+		CustomCodeMaxLength: getEnvInt("CUSTOM_CODE_MAX_LENGTH", maxShortCodeLength),
+		ReservedCodes:       getEnvList("RESERVED_CODES"),
+		BlockedCodeTerms:    getEnvList("BLOCKED_CODE_TERMS"),
+
+		DomainCacheTTL: getEnvDuration("DOMAIN_CACHE_TTL", time.Minute),
+
+		RedirectCacheMaxAge: getEnvDuration("REDIRECT_CACHE_MAX_AGE", 24*time.Hour),
+		ReferrerPolicy:      getEnv("REFERRER_POLICY", ""),
+
+		SigningKeys:      map[string]string{},
+		SigningKeyID:     getEnv("LINK_SIGNING_KEY_ID", ""),
+		SignedLinkMaxTTL: getEnvDuration("SIGNED_LINK_MAX_TTL", 30*24*time.Hour),
+
+		SessionTTL:       getEnvDuration("SESSION_TTL", 24*time.Hour),
+		PasswordResetTTL: getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		PasswordResetURL: getEnv("PASSWORD_RESET_URL", ""),
+
+		SMTPAddr:     getEnv("SMTP_ADDR", ""),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		MailFrom:     getEnv("MAIL_FROM", "smolink <no-reply@localhost>"),
+
+		OIDCIssuer:       strings.TrimSuffix(getEnv("OIDC_ISSUER", ""), "/"),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:       getEnvList("OIDC_SCOPES"),
+		OIDCGroupsClaim:  getEnv("OIDC_GROUPS_CLAIM", "groups"),
+
+		QuotaLinksCreated:   getEnvInt("QUOTA_LINKS_CREATED", 0),
+		QuotaAPIRequests:    getEnvInt("QUOTA_API_REQUESTS", 0),
+		QuotaClicksRecorded: getEnvInt("QUOTA_CLICKS_RECORDED", 0),
+		UsageSaveInterval:   getEnvDuration("USAGE_SAVE_INTERVAL", time.Minute),
+
+		IdempotencyKeyTTL: getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+	}
+	if len(config.OIDCScopes) == 0 {
+		config.OIDCScopes = []string{"openid", "email", "profile"}
+	}
+
+	// OIDC_GROUP_ROLES lists group=workspaceID:role entries
+	for _, entry := range getEnvList("OIDC_GROUP_ROLES") {
+		group, grant, _ := strings.Cut(entry, "=")
+		workspace, role, _ := strings.Cut(grant, ":")
+		workspaceID, err := strconv.Atoi(workspace)
+		if group == "" || err != nil || !model.ValidRole(role) {
+			return nil, fmt.Errorf("invalid OIDC_GROUP_ROLES entry %q: want group=workspaceID:role", entry)
+		}
+		config.OIDCGroupRoles = append(config.OIDCGroupRoles, model.GroupRole{Group: group, WorkspaceID: workspaceID, Role: role})
+	}
+
+	// LINK_SIGNING_KEYS lists id:secret pairs; the first signs unless
+	// LINK_SIGNING_KEY_ID names another
+	for _, entry := range getEnvList("LINK_SIGNING_KEYS") {
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || len(secret) < signing.MinKeyLength {
+			return nil, fmt.Errorf("invalid LINK_SIGNING_KEYS entry for %q: want id:secret with a secret of at least %d bytes", id, signing.MinKeyLength)
+		}
+		config.SigningKeys[id] = secret
+		if config.SigningKeyID == "" {
+			config.SigningKeyID = id
+		}
 	}
 
 	// Validate required configuration
@@ -67,5 +278,156 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("invalid SERVER_PORT: must begin with ':' (got %s)", config.ServerPort)
 	}
 
+	if config.PublicBaseURL != "" {
+		if u, err := url.Parse(config.PublicBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid PUBLIC_BASE_URL: must be an absolute URL such as https://s.example.com (got %s)", config.PublicBaseURL)
+		}
+	}
+
+	for _, proxy := range config.TrustedProxies {
+		if _, err := parseProxy(proxy); err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: want an IP or CIDR range", proxy)
+		}
+	}
+
+	if config.ReferrerPolicy != "" && !model.ValidReferrerPolicy(config.ReferrerPolicy) {
+		return nil, fmt.Errorf("invalid REFERRER_POLICY: %s", config.ReferrerPolicy)
+	}
+
+	if len(config.SigningKeys) > 0 {
+		if _, ok := config.SigningKeys[config.SigningKeyID]; !ok {
+			return nil, fmt.Errorf("invalid LINK_SIGNING_KEY_ID: %s is not in LINK_SIGNING_KEYS", config.SigningKeyID)
+		}
+	}
+
+	if config.OIDCIssuer != "" {
+		if config.OIDCClientID == "" || config.OIDCRedirectURL == "" {
+			return nil, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required with OIDC_ISSUER")
+		}
+		if u, err := url.Parse(config.OIDCIssuer); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid OIDC_ISSUER: must be an absolute URL (got %s)", config.OIDCIssuer)
+		}
+	}
+
+	if config.SessionTTL <= 0 || config.PasswordResetTTL <= 0 {
+		return nil, errors.New("SESSION_TTL and PASSWORD_RESET_TTL must be positive")
+	}
+
+	if config.QuotaLinksCreated < 0 || config.QuotaAPIRequests < 0 || config.QuotaClicksRecorded < 0 {
+		return nil, errors.New("QUOTA_LINKS_CREATED, QUOTA_API_REQUESTS and QUOTA_CLICKS_RECORDED must not be negative")
+	}
+
+	if config.UsageSaveInterval <= 0 {
+		return nil, errors.New("USAGE_SAVE_INTERVAL must be positive")
+	}
+
+	if config.IdempotencyKeyTTL <= 0 {
+		return nil, errors.New("IDEMPOTENCY_KEY_TTL must be positive")
+	}
+
+	if config.CodeMaxLength > maxShortCodeLength {
+		return nil, fmt.Errorf("invalid CODE_MAX_LENGTH: must be at most %d (got %d)", maxShortCodeLength, config.CodeMaxLength)
+	}
+	// Pronounceable codes take two characters per syllable
+	if config.CodeSyllables < 1 || 2*config.CodeSyllables > maxShortCodeLength {
+		return nil, fmt.Errorf("invalid CODE_SYLLABLES: must lie within 1-%d (got %d)", maxShortCodeLength/2, config.CodeSyllables)
+	}
+	if config.CodeLength < 1 || config.CodeLength > config.CodeMaxLength {
+		return nil, fmt.Errorf("invalid CODE_LENGTH: must lie within 1-%d, the CODE_MAX_LENGTH (got %d)", config.CodeMaxLength, config.CodeLength)
+	}
+
+	if config.CustomCodeMinLength < 1 || config.CustomCodeMinLength > config.CustomCodeMaxLength || config.CustomCodeMaxLength > maxShortCodeLength {
+		return nil, fmt.Errorf("invalid custom code length range %d-%d: must lie within 1-%d",
+			config.CustomCodeMinLength, config.CustomCodeMaxLength, maxShortCodeLength)
+	}
+
 	return config, nil
 }
+
+func (c *Config) CodeGeneratorOptions() shortcode.Options {
+	return shortcode.Options{
+		DefaultStrategy:      c.CodeStrategy,
+		Alphabet:             c.CodeAlphabet,
+		Length:               c.CodeLength,
+		MaxLength:            c.CodeMaxLength,
+		UtilizationThreshold: c.CodeUtilizationThreshold,
+		Salt:                 c.CodeSalt,
+		Syllables:            c.CodeSyllables,
+	}
+}
+
+// TrustedProxyPrefixes returns TrustedProxies as address ranges.
+func (c *Config) TrustedProxyPrefixes() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, proxy := range c.TrustedProxies {
+		if prefix, err := parseProxy(proxy); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// parseProxy reads an IP as the range holding only that address.
+func parseProxy(proxy string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(proxy); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(proxy)
+	return prefix.Masked(), err
+}
+
+// SigningKeySet returns nil when no signing keys are configured.
+func (c *Config) SigningKeySet() (*signing.KeySet, error) {
+	if len(c.SigningKeys) == 0 {
+		return nil, nil
+	}
+	return signing.NewKeySet(c.SigningKeys, c.SigningKeyID)
+}
+
+// OIDCProvider returns nil when single sign-on is not configured.
+func (c *Config) OIDCProvider() *oidc.Provider {
+	if c.OIDCIssuer == "" {
+		return nil
+	}
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       c.OIDCIssuer,
+		ClientID:     c.OIDCClientID,
+		ClientSecret: c.OIDCClientSecret,
+		RedirectURL:  c.OIDCRedirectURL,
+		Scopes:       c.OIDCScopes,
+	}, &http.Client{Timeout: 10 * time.Second})
+}
+
+// Mailer sends through SMTP_ADDR, or only logs messages when it is unset.
+func (c *Config) Mailer() mail.Mailer {
+	if c.SMTPAddr == "" {
+		return mail.LogMailer{}
+	}
+	return mail.NewSMTPMailer(c.SMTPAddr, c.SMTPUsername, c.SMTPPassword, c.MailFrom)
+}
+
+func (c *Config) CodeValidatorOptions() shortcode.ValidatorOptions {
+	return shortcode.ValidatorOptions{
+		Charset:      c.CustomCodeCharset,
+		MinLength:    c.CustomCodeMinLength,
+		MaxLength:    c.CustomCodeMaxLength,
+		Reserved:     c.ReservedCodes,
+		BlockedTerms: c.BlockedCodeTerms,
+	}
+}
+
+// DefaultQuotas leaves the quotas configured as 0 unlimited.
+func (c *Config) DefaultQuotas() model.Quotas {
+	limit := func(n int) *int64 {
+		if n == 0 {
+			return nil
+		}
+		v := int64(n)
+		return &v
+	}
+	return model.Quotas{
+		LinksCreated:   limit(c.QuotaLinksCreated),
+		APIRequests:    limit(c.QuotaAPIRequests),
+		ClicksRecorded: limit(c.QuotaClicksRecorded),
+	}
+}
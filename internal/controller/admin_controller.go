@@ -0,0 +1,294 @@
+package controller
+
+import (
+	"net/http"
+	"smolink/internal/auth"
+	"smolink/internal/config"
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/service"
+	"smolink/internal/signing"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize  = 50
+	maxPageSize      = 500
+	defaultStatsDays = 30
+)
+
+type AdminController struct {
+	urlService    *service.URLService
+	apiKeyService *service.APIKeyService
+	domainService *service.DomainService
+	links         shortLinks
+}
+
+func NewAdminController(urlService *service.URLService, apiKeyService *service.APIKeyService, domainService *service.DomainService, cfg *config.Config) *AdminController {
+	return &AdminController{
+		urlService:    urlService,
+		apiKeyService: apiKeyService,
+		domainService: domainService,
+		links:         newShortLinks(cfg),
+	}
+}
+
+func respondError(c *gin.Context, err error) {
+	apiErr := errors.ExtractAPIError(err)
+	c.JSON(apiErr.Status, apiErr)
+}
+
+func queryInt(c *gin.Context, key string, fallback, max int) int {
+	value, err := strconv.Atoi(c.Query(key))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	if max > 0 && value > max {
+		return max
+	}
+	return value
+}
+
+func access(c *gin.Context) service.Access {
+	return auth.PrincipalFrom(c).Access()
+}
+
+// linkRef names the link in the path, on the domain given by ?domain= if any.
+func linkRef(c *gin.Context) service.LinkRef {
+	return service.LinkRef{Domain: c.Query("domain"), Code: c.Param("code")}
+}
+
+func (ac *AdminController) ListLinks(c *gin.Context) {
+	limit := queryInt(c, "limit", defaultPageSize, maxPageSize)
+	offset := queryInt(c, "offset", 0, 0)
+	// before pages by ID, which unlike offset is not shifted by new links
+	before := queryInt(c, "before", 0, 0)
+
+	links, total, err := ac.urlService.ListURLs(c, access(c), limit, offset, before)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"links": links, "total": total, "limit": limit, "offset": offset})
+}
+
+func (ac *AdminController) GetLink(c *gin.Context) {
+	link, err := ac.urlService.GetURL(c, access(c), linkRef(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+func (ac *AdminController) UpdateLink(c *gin.Context) {
+	type linkPatch struct {
+		URL            *string `json:"url"`
+		RedirectType   *int    `json:"redirectType"`
+		ReferrerPolicy *string `json:"referrerPolicy"`
+		ForwardPath    *bool   `json:"forwardPath"`
+
+		// An empty string clears activeFrom, activeUntil and inactiveUrl
+		ActiveFrom  *string                       `json:"activeFrom"`
+		ActiveUntil *string                       `json:"activeUntil"`
+		InactiveURL *string                       `json:"inactiveUrl"`
+		Schedule    *[]model.ScheduledDestination `json:"schedule"`
+
+		RequireSignature *bool `json:"requireSignature"`
+	}
+	var payload linkPatch
+
+	if err := c.ShouldBindJSON(&payload); err != nil || payload == (linkPatch{}) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	activeFrom, err := optionalTime(payload.ActiveFrom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	activeUntil, err := optionalTime(payload.ActiveUntil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	link, err := ac.urlService.UpdateLink(c, access(c), linkRef(c), model.LinkUpdate{
+		OriginalURL:    payload.URL,
+		RedirectType:   payload.RedirectType,
+		ReferrerPolicy: payload.ReferrerPolicy,
+		ForwardPath:    payload.ForwardPath,
+		ActiveFrom:     activeFrom,
+		ActiveUntil:    activeUntil,
+		InactiveURL:    payload.InactiveURL,
+		Schedule:       payload.Schedule,
+
+		RequireSignature: payload.RequireSignature,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+// optionalTime parses an RFC 3339 time, mapping "" to the zero time that
+// clears a setting.
+func optionalTime(value *string) (*time.Time, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if *value == "" {
+		return &time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, *value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (ac *AdminController) DisableLink(c *gin.Context) {
+	ac.setStatus(c, model.URLStatusDisabled)
+}
+
+func (ac *AdminController) EnableLink(c *gin.Context) {
+	ac.setStatus(c, model.URLStatusActive)
+}
+
+func (ac *AdminController) setStatus(c *gin.Context, status string) {
+	link, err := ac.urlService.SetStatus(c, access(c), linkRef(c), status)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+func (ac *AdminController) DeleteLink(c *gin.Context) {
+	if err := ac.urlService.DeleteURL(c, access(c), linkRef(c)); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (ac *AdminController) GetLinkStats(c *gin.Context) {
+	days := queryInt(c, "days", defaultStatsDays, 365)
+
+	stats, err := ac.urlService.GetStats(c, access(c), linkRef(c), days)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// SignLink issues a URL that resolves a link requiring signatures until expiresAt.
+func (ac *AdminController) SignLink(c *gin.Context) {
+	var payload struct {
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil || payload.ExpiresAt.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	ref := linkRef(c)
+	query, err := ac.urlService.SignLink(c, access(c), ref, payload.ExpiresAt)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"url":       ac.links.shortURL(c, ref.Domain, ref.Code) + "?" + query.Encode(),
+		"expiresAt": payload.ExpiresAt,
+		"keyId":     query.Get(signing.ParamKeyID),
+	})
+}
+
+func (ac *AdminController) GetLinkHistory(c *gin.Context) {
+	revisions, err := ac.urlService.History(c, access(c), linkRef(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+func (ac *AdminController) RollbackLink(c *gin.Context) {
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		respondError(c, errors.ErrRevisionNotFound)
+		return
+	}
+
+	link, err := ac.urlService.Rollback(c, access(c), linkRef(c), revision)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+func (ac *AdminController) GetCodeStats(c *gin.Context) {
+	c.JSON(http.StatusOK, ac.urlService.CodeStats())
+}
+
+func (ac *AdminController) ListAPIKeys(c *gin.Context) {
+	keys, err := ac.apiKeyService.ListKeys(c, access(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+func (ac *AdminController) CreateAPIKey(c *gin.Context) {
+	var payload struct {
+		Name        string `json:"name"`
+		WorkspaceID *int   `json:"workspaceId"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil || payload.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	// Only admins choose the workspace; keys made with a key share its workspace
+	principal := auth.PrincipalFrom(c)
+	workspaceID := principal.WorkspaceID
+	if principal.Kind == auth.PrincipalAdmin && payload.WorkspaceID != nil {
+		if err := ac.domainService.CheckWorkspace(c, *payload.WorkspaceID); err != nil {
+			respondError(c, err)
+			return
+		}
+		workspaceID = payload.WorkspaceID
+	}
+
+	key, token, err := ac.apiKeyService.CreateKey(c, payload.Name, workspaceID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"key": key, "token": token})
+}
+
+func (ac *AdminController) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errors.ErrAPIKeyNotFound)
+		return
+	}
+
+	if err := ac.apiKeyService.RevokeKey(c, access(c), id); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"net/http"
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DomainController struct {
+	domainService *service.DomainService
+}
+
+func NewDomainController(domainService *service.DomainService) *DomainController {
+	return &DomainController{domainService: domainService}
+}
+
+func (dc *DomainController) ListWorkspaces(c *gin.Context) {
+	workspaces, err := dc.domainService.ListWorkspaces(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"workspaces": workspaces})
+}
+
+func (dc *DomainController) CreateWorkspace(c *gin.Context) {
+	var payload struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil || payload.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	workspace, err := dc.domainService.CreateWorkspace(c, payload.Name)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, workspace)
+}
+
+func (dc *DomainController) GetWorkspace(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errors.ErrWorkspaceNotFound)
+		return
+	}
+
+	workspace, err := dc.domainService.GetWorkspace(c, access(c), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, workspace)
+}
+
+// UpdateWorkspace changes the given settings; 0 restores the instance default.
+func (dc *DomainController) UpdateWorkspace(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errors.ErrWorkspaceNotFound)
+		return
+	}
+
+	var payload struct {
+		Name         *string `json:"name"`
+		CodeLength   *int    `json:"codeLength"`
+		RedirectType *int    `json:"redirectType"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil || (payload.Name != nil && *payload.Name == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	workspace, err := dc.domainService.UpdateWorkspace(c, access(c), id, model.WorkspaceUpdate{
+		Name:         payload.Name,
+		CodeLength:   payload.CodeLength,
+		RedirectType: payload.RedirectType,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, workspace)
+}
+
+func (dc *DomainController) ListDomains(c *gin.Context) {
+	domains, err := dc.domainService.ListDomains(c, access(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"domains": domains})
+}
+
+func (dc *DomainController) CreateDomain(c *gin.Context) {
+	var payload struct {
+		WorkspaceID     *int    `json:"workspaceId"`
+		Hostname        string  `json:"hostname"`
+		RootRedirectURL *string `json:"rootRedirectUrl"`
+		NotFoundURL     *string `json:"notFoundUrl"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	domain, err := dc.domainService.CreateDomain(c, access(c), service.CreateDomainRequest{
+		WorkspaceID:     payload.WorkspaceID,
+		Hostname:        payload.Hostname,
+		RootRedirectURL: payload.RootRedirectURL,
+		NotFoundURL:     payload.NotFoundURL,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, domain)
+}
+
+func (dc *DomainController) GetDomain(c *gin.Context) {
+	id, ok := domainID(c)
+	if !ok {
+		return
+	}
+
+	domain, err := dc.domainService.GetDomain(c, access(c), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, domain)
+}
+
+// UpdateDomain replaces the root redirect and 404 pages; omitted pages are cleared.
+func (dc *DomainController) UpdateDomain(c *gin.Context) {
+	id, ok := domainID(c)
+	if !ok {
+		return
+	}
+
+	var payload struct {
+		RootRedirectURL *string `json:"rootRedirectUrl"`
+		NotFoundURL     *string `json:"notFoundUrl"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	domain, err := dc.domainService.UpdatePages(c, access(c), id, payload.RootRedirectURL, payload.NotFoundURL)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, domain)
+}
+
+func (dc *DomainController) VerifyDomain(c *gin.Context) {
+	id, ok := domainID(c)
+	if !ok {
+		return
+	}
+
+	domain, err := dc.domainService.VerifyDomain(c, access(c), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, domain)
+}
+
+func (dc *DomainController) DeleteDomain(c *gin.Context) {
+	id, ok := domainID(c)
+	if !ok {
+		return
+	}
+
+	if err := dc.domainService.DeleteDomain(c, access(c), id); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func domainID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errors.ErrDomainNotFound)
+		return 0, false
+	}
+	return id, true
+}
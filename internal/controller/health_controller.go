@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"net/http"
+	"smolink/internal/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController struct {
+	checker *health.Checker
+}
+
+func NewHealthController(checker *health.Checker) *HealthController {
+	return &HealthController{checker: checker}
+}
+
+// Live only tells the orchestrator the process is up; it never touches dependencies.
+func (hc *HealthController) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// Ready reports each dependency. Degraded instances keep receiving traffic
+// because redirects fall back to Postgres when Redis is unavailable.
+func (hc *HealthController) Ready(c *gin.Context) {
+	report := hc.checker.Run(c.Request.Context())
+
+	status := http.StatusOK
+	if report.Status == health.StatusUnhealthy {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.JSON(status, report)
+}
@@ -1,25 +1,85 @@
 package controller
 
 import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"smolink/internal/auth"
+	"smolink/internal/config"
 	"smolink/internal/errors"
+	"smolink/internal/model"
 	"smolink/internal/service"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	defaultSuggestions = 5
+	maxSuggestions     = 20
+
+	// IdempotencyKeyHeader makes retries of POST /links safe: a retry with
+	// the same key and body gets the original response back, marked by
+	// IdempotentReplayedHeader.
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	jsonContentType = "application/json; charset=utf-8"
+)
+
 type URLController struct {
-	service *service.URLService
+	service        *service.URLService
+	domains        *service.DomainService
+	idempotency    *service.IdempotencyService
+	links          shortLinks
+	cacheMaxAge    time.Duration
+	referrerPolicy string
+	home           gin.HandlerFunc
 }
 
-func NewURLController(service *service.URLService) *URLController {
-	return &URLController{service: service}
+// NewURLController builds short URLs from cfg.PublicBaseURL, or from the
+// request's own scheme and host when it is empty; see shortLinks.
+func NewURLController(service *service.URLService, domains *service.DomainService, idempotency *service.IdempotencyService, cfg *config.Config) *URLController {
+	return &URLController{
+		service:        service,
+		domains:        domains,
+		idempotency:    idempotency,
+		links:          newShortLinks(cfg),
+		cacheMaxAge:    cfg.RedirectCacheMaxAge,
+		referrerPolicy: cfg.ReferrerPolicy,
+	}
+}
+
+// SetHome serves "/" on hosts without a domain root redirect.
+func (uc *URLController) SetHome(handler gin.HandlerFunc) {
+	uc.home = handler
 }
 
 func (uc *URLController) ShortenURL(c *gin.Context) {
 	var payload struct {
-		URL        string `json:"url"`
-		CustomCode string `json:"customCode"`
+		URL        string     `json:"url"`
+		CustomCode string     `json:"customCode"`
+		Strategy   string     `json:"strategy"`
+		ExpiresAt  *time.Time `json:"expiresAt"`
+		Domain     string     `json:"domain"`
+
+		RedirectType   int    `json:"redirectType"`
+		ReferrerPolicy string `json:"referrerPolicy"`
+		ForwardPath    bool   `json:"forwardPath"`
+
+		ActiveFrom  *time.Time                   `json:"activeFrom"`
+		ActiveUntil *time.Time                   `json:"activeUntil"`
+		InactiveURL string                       `json:"inactiveUrl"`
+		Schedule    []model.ScheduledDestination `json:"schedule"`
+		MaxUses     int                          `json:"maxUses"`
+
+		RequireSignature bool `json:"requireSignature"`
+		ReuseExisting    bool `json:"reuseExisting"`
 	}
 
 	if err := c.ShouldBindJSON(&payload); err != nil {
@@ -27,27 +87,220 @@ func (uc *URLController) ShortenURL(c *gin.Context) {
 		return
 	}
 
-	result, err := uc.service.ShortenURL(c, payload.URL, payload.CustomCode)
+	claim, err := uc.idempotency.Begin(c, idempotencyScope(c), c.GetHeader(IdempotencyKeyHeader), payload)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if claim != nil && claim.Replay != nil {
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Data(claim.Replay.Status, jsonContentType, claim.Replay.Body)
+		return
+	}
+
+	result, created, err := uc.service.ShortenURL(c, service.ShortenRequest{
+		URL:        payload.URL,
+		CustomCode: payload.CustomCode,
+		Strategy:   payload.Strategy,
+		ExpiresAt:  payload.ExpiresAt,
+		Domain:     payload.Domain,
+		Access:     auth.PrincipalFrom(c).Access(),
+
+		RedirectType:   payload.RedirectType,
+		ReferrerPolicy: payload.ReferrerPolicy,
+		ForwardPath:    payload.ForwardPath,
+
+		ActiveFrom:  payload.ActiveFrom,
+		ActiveUntil: payload.ActiveUntil,
+		InactiveURL: payload.InactiveURL,
+		Schedule:    payload.Schedule,
+		MaxUses:     payload.MaxUses,
+
+		RequireSignature: payload.RequireSignature,
+		ReuseExisting:    payload.ReuseExisting,
+	})
+	if err != nil {
+		apiErr := errors.ExtractAPIError(err)
+		uc.respondIdempotent(c, claim, apiErr.Status, apiErr)
+		return
+	}
+
+	// Reused links answer 200 rather than 201
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	uc.respondIdempotent(c, claim, status, gin.H{
+		"shortCode":   result.ShortCode,
+		"shortUrl":    uc.links.shortURL(c, payload.Domain, result.ShortCode),
+		"originalUrl": result.OriginalURL,
+	})
+}
+
+// respondIdempotent keeps the response for retries of a request made with an
+// Idempotency-Key before sending it.
+func (uc *URLController) respondIdempotent(c *gin.Context, claim *service.IdempotentRequest, status int, body interface{}) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		status = http.StatusInternalServerError
+		raw, _ = json.Marshal(errors.ErrInternal)
+	}
+	uc.idempotency.Finish(context.WithoutCancel(c), claim, status, raw)
+	c.Data(status, jsonContentType, raw)
+}
+
+// idempotencyScope keeps callers' idempotency keys apart: per principal and
+// workspace, or per client IP for anonymous callers.
+func idempotencyScope(c *gin.Context) string {
+	principal := auth.PrincipalFrom(c)
+	if principal == nil {
+		return "anonymous:" + c.ClientIP()
+	}
+	if principal.WorkspaceID != nil {
+		return principal.String() + ":" + strconv.Itoa(*principal.WorkspaceID)
+	}
+	return principal.String()
+}
+
+// shortLinks builds the short URLs handed back to clients.
+type shortLinks struct {
+	publicBaseURL  string
+	trustedProxies []netip.Prefix
+}
+
+func newShortLinks(cfg *config.Config) shortLinks {
+	return shortLinks{publicBaseURL: cfg.PublicBaseURL, trustedProxies: cfg.TrustedProxyPrefixes()}
+}
+
+// shortURL links into the default namespace through publicBaseURL, or the
+// request's host without one, and into a custom domain's namespace through
+// that domain, on the same scheme.
+func (l shortLinks) shortURL(c *gin.Context, domain, code string) string {
+	scheme, host := l.scheme(c), c.Request.Host
+	if base, err := url.Parse(l.publicBaseURL); err == nil && l.publicBaseURL != "" {
+		if domain == "" {
+			return l.publicBaseURL + "/" + url.PathEscape(code)
+		}
+		scheme = base.Scheme
+	}
+	if domain != "" {
+		host = strings.ToLower(domain)
+	}
+	return scheme + "://" + host + "/" + url.PathEscape(code)
+}
+
+// scheme is the one the client used: https when the request came over TLS,
+// or through a trusted proxy that says so in X-Forwarded-Proto. Anyone else
+// could claim https with the header.
+func (l shortLinks) scheme(c *gin.Context) string {
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	if c.GetHeader("X-Forwarded-Proto") == "https" {
+		if remote, err := netip.ParseAddr(c.RemoteIP()); err == nil {
+			for _, proxy := range l.trustedProxies {
+				if proxy.Contains(remote.Unmap()) {
+					return "https"
+				}
+			}
+		}
+	}
+	return "http"
+}
+
+func (uc *URLController) CheckAvailability(c *gin.Context) {
+	suggest, _ := strconv.ParseBool(c.Query("suggest"))
+
+	result, err := uc.service.CheckAvailability(c, service.AvailabilityRequest{
+		Code:    c.Param("code"),
+		Suggest: suggest,
+		URL:     c.Query("url"),
+		Title:   c.Query("title"),
+		Limit:   queryInt(c, "limit", defaultSuggestions, maxSuggestions),
+		Domain:  c.Query("domain"),
+		Access:  auth.PrincipalFrom(c).Access(),
+	})
 	if err != nil {
 		apiErr := errors.ExtractAPIError(err)
 		c.JSON(apiErr.Status, apiErr)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"shortCode": result.ShortCode, "originalUrl": result.OriginalURL})
+	c.JSON(http.StatusOK, result)
 }
 
 func (uc *URLController) ResolveURL(c *gin.Context) {
-	code := c.Param("code")
-	ip := c.ClientIP()
-	ua := c.Request.UserAgent()
-
-	original, err := uc.service.ResolveURL(c, code, ip, ua)
+	link, err := uc.service.ResolveURL(c, service.ResolveRequest{
+		Host:          c.Request.Host,
+		Code:          c.Param("code"),
+		Path:          c.Param("rest"),
+		Query:         c.Request.URL.RawQuery,
+		IP:            c.ClientIP(),
+		UserAgent:     c.Request.UserAgent(),
+		SkipAnalytics: c.Request.Method == http.MethodHead,
+	})
+	if stderrors.Is(err, errors.ErrShortCodeNotFound) {
+		if domain, _ := uc.domains.ForHost(c, c.Request.Host); domain != nil && domain.NotFoundURL != nil {
+			c.Redirect(http.StatusFound, *domain.NotFoundURL)
+			return
+		}
+	}
 	if err != nil {
 		apiErr := errors.ExtractAPIError(err)
 		c.JSON(apiErr.Status, apiErr)
 		return
 	}
 
-	c.Redirect(http.StatusFound, original)
+	policy := link.ReferrerPolicy
+	if policy == "" {
+		policy = uc.referrerPolicy
+	}
+	if policy != "" {
+		c.Header("Referrer-Policy", policy)
+	}
+	uc.setCacheHeaders(c, link, time.Now())
+	// HEAD did not take a use, so it must not reveal where one would lead
+	if link.MaxUses > 0 && c.Request.Method == http.MethodHead {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Redirect(link.RedirectType, link.OriginalURL)
+}
+
+// setCacheHeaders lets clients cache permanent redirects for up to
+// cacheMaxAge, but never past the link's next expiry, window or schedule
+// transition. Temporary redirects and limited-use links must reach the server
+// on every visit so clicks and uses are counted and destination changes apply
+// immediately, and signed links so every visit presents a valid signature.
+func (uc *URLController) setCacheHeaders(c *gin.Context, link *model.LinkRecord, now time.Time) {
+	if !model.PermanentRedirect(link.RedirectType) || link.MaxUses > 0 || link.RequireSignature || uc.cacheMaxAge <= 0 {
+		c.Header("Cache-Control", "private, no-cache")
+		c.Header("Expires", time.Unix(0, 0).UTC().Format(http.TimeFormat))
+		return
+	}
+
+	ttl := uc.cacheMaxAge
+	if next := link.NextTransition(now); next != nil && next.Sub(now) < ttl {
+		ttl = next.Sub(now)
+	}
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(ttl/time.Second)))
+	c.Header("Expires", now.Add(ttl).UTC().Format(http.TimeFormat))
+}
+
+// Home redirects the root of a custom domain to its configured page.
+func (uc *URLController) Home(c *gin.Context) {
+	domain, err := uc.domains.ForHost(c, c.Request.Host)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if domain != nil && domain.RootRedirectURL != nil {
+		c.Redirect(http.StatusFound, *domain.RootRedirectURL)
+		return
+	}
+	if uc.home != nil {
+		uc.home(c)
+		return
+	}
+	respondError(c, errors.ErrShortCodeNotFound)
 }
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"net/http"
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UsageController struct {
+	usageService *service.UsageService
+}
+
+func NewUsageController(usageService *service.UsageService) *UsageController {
+	return &UsageController{usageService: usageService}
+}
+
+// GetUsage reports the caller's workspace usage this month. The admin token
+// has no workspace of its own and names one with ?workspace=.
+func (uc *UsageController) GetUsage(c *gin.Context) {
+	workspaceID := access(c).WorkspaceID
+	if query := c.Query("workspace"); query != "" {
+		id, err := strconv.Atoi(query)
+		if err != nil {
+			respondError(c, errors.ErrWorkspaceNotFound)
+			return
+		}
+		workspaceID = &id
+	}
+	if workspaceID == nil {
+		respondError(c, errors.ErrWorkspaceNotFound.WithDetails("pass ?workspace= to pick a workspace"))
+		return
+	}
+
+	usage, err := uc.usageService.Usage(c, access(c), *workspaceID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+// SetQuotas replaces a workspace's quotas; omitted ones use the instance
+// defaults.
+func (uc *UsageController) SetQuotas(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errors.ErrWorkspaceNotFound)
+		return
+	}
+
+	var payload struct {
+		LinksCreated   *int64 `json:"linksCreated"`
+		APIRequests    *int64 `json:"apiRequests"`
+		ClicksRecorded *int64 `json:"clicksRecorded"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	workspace, err := uc.usageService.SetQuotas(c, id, model.Quotas{
+		LinksCreated:   payload.LinksCreated,
+		APIRequests:    payload.APIRequests,
+		ClicksRecorded: payload.ClicksRecorded,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, workspace)
+}
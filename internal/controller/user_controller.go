@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"net/http"
+	"smolink/internal/auth"
+	"smolink/internal/errors"
+	"smolink/internal/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UserController struct {
+	userService *service.UserService
+	ssoService  *service.SSOService
+}
+
+func NewUserController(userService *service.UserService, ssoService *service.SSOService) *UserController {
+	return &UserController{userService: userService, ssoService: ssoService}
+}
+
+func (uc *UserController) Login(c *gin.Context) {
+	var payload struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil || payload.Email == "" || payload.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	session, err := uc.userService.Login(c, payload.Email, payload.Password)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	respondSession(c, session)
+}
+
+// SSOLogin sends the browser to the identity provider.
+func (uc *UserController) SSOLogin(c *gin.Context) {
+	authURL, err := uc.ssoService.Begin(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// SSOCallback is where the identity provider sends the browser back to.
+func (uc *UserController) SSOCallback(c *gin.Context) {
+	if reason := c.Query("error"); reason != "" {
+		respondError(c, errors.ErrSSOFailed.WithDetails(reason))
+		return
+	}
+
+	session, err := uc.ssoService.Complete(c, c.Query("state"), c.Query("code"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	respondSession(c, session)
+}
+
+func respondSession(c *gin.Context, session *service.Session) {
+	c.JSON(http.StatusOK, gin.H{
+		"token":     session.Token,
+		"expiresAt": session.ExpiresAt,
+		"user":      session.User,
+	})
+}
+
+// Logout ends the session the request was made with. Other tokens have no
+// session to end.
+func (uc *UserController) Logout(c *gin.Context) {
+	if auth.PrincipalFrom(c).Kind == auth.PrincipalUser {
+		if err := uc.userService.Logout(c, auth.BearerToken(c)); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Me describes the caller, and for users every workspace they belong to.
+func (uc *UserController) Me(c *gin.Context) {
+	principal := auth.PrincipalFrom(c)
+	if principal.Kind != auth.PrincipalUser {
+		c.JSON(http.StatusOK, gin.H{"principal": principal})
+		return
+	}
+
+	memberships, err := uc.userService.Memberships(c, principal.ID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"principal": principal, "memberships": memberships})
+}
+
+// ForgotPassword always answers 202 so it cannot be used to probe for emails.
+func (uc *UserController) ForgotPassword(c *gin.Context) {
+	var payload struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil || payload.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	if err := uc.userService.RequestPasswordReset(c, payload.Email); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+func (uc *UserController) ResetPassword(c *gin.Context) {
+	var payload struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil || payload.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	if err := uc.userService.ResetPassword(c, payload.Token, payload.Password); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (uc *UserController) CreateUser(c *gin.Context) {
+	var payload struct {
+		Email       string `json:"email"`
+		Name        string `json:"name"`
+		Password    string `json:"password"`
+		WorkspaceID *int   `json:"workspaceId"`
+		Role        string `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	user, err := uc.userService.CreateUser(c, service.CreateUserRequest{
+		Email:       payload.Email,
+		Name:        payload.Name,
+		Password:    payload.Password,
+		WorkspaceID: payload.WorkspaceID,
+		Role:        payload.Role,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, user)
+}
+
+func (uc *UserController) ListMembers(c *gin.Context) {
+	workspaceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errors.ErrWorkspaceNotFound)
+		return
+	}
+
+	members, err := uc.userService.ListMembers(c, access(c), workspaceID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+func (uc *UserController) SetMember(c *gin.Context) {
+	workspaceID, userID, ok := memberParams(c)
+	if !ok {
+		return
+	}
+
+	var payload struct {
+		Role string `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	membership, err := uc.userService.SetMember(c, access(c), workspaceID, userID, payload.Role)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, membership)
+}
+
+func (uc *UserController) RemoveMember(c *gin.Context) {
+	workspaceID, userID, ok := memberParams(c)
+	if !ok {
+		return
+	}
+
+	if err := uc.userService.RemoveMember(c, access(c), workspaceID, userID); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func memberParams(c *gin.Context) (workspaceID, userID int, ok bool) {
+	workspaceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, errors.ErrWorkspaceNotFound)
+		return 0, 0, false
+	}
+	userID, err = strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		respondError(c, errors.ErrUserNotFound)
+		return 0, 0, false
+	}
+	return workspaceID, userID, true
+}
@@ -17,9 +17,11 @@ func (e *APIError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Code, e.Message)
 }
 
+// WithDetails returns a copy carrying details, leaving the shared error values untouched.
 func (e *APIError) WithDetails(details string) *APIError {
-	e.Details = details
-	return e
+	clone := *e
+	clone.Details = details
+	return &clone
 }
 
 func NewAPIError(status int, code, message string) *APIError {
@@ -31,10 +33,60 @@ func NewAPIError(status int, code, message string) *APIError {
 }
 
 var (
-	ErrInvalidURL        = NewAPIError(http.StatusBadRequest, "INVALID_URL", "The provided URL is invalid")
-	ErrCodeInUse         = NewAPIError(http.StatusConflict, "CODE_IN_USE", "The custom short code is already in use")
-	ErrShortCodeNotFound = NewAPIError(http.StatusNotFound, "NOT_FOUND", "Short code does not exist")
-	ErrInternal          = NewAPIError(http.StatusInternalServerError, "INTERNAL_ERROR", "Something went wrong")
+	ErrInvalidURL         = NewAPIError(http.StatusBadRequest, "INVALID_URL", "The provided URL is invalid")
+	ErrCodeInUse          = NewAPIError(http.StatusConflict, "CODE_IN_USE", "The custom short code is already in use")
+	ErrCodeTooShort       = NewAPIError(http.StatusBadRequest, "CODE_TOO_SHORT", "The custom short code is too short")
+	ErrCodeTooLong        = NewAPIError(http.StatusBadRequest, "CODE_TOO_LONG", "The custom short code is too long")
+	ErrCodeInvalidChars   = NewAPIError(http.StatusBadRequest, "CODE_INVALID_CHARACTERS", "The custom short code contains characters that are not allowed")
+	ErrCodeReserved       = NewAPIError(http.StatusBadRequest, "CODE_RESERVED", "The custom short code is reserved")
+	ErrCodeOffensive      = NewAPIError(http.StatusBadRequest, "CODE_OFFENSIVE", "The custom short code contains a blocked term")
+	ErrShortCodeNotFound  = NewAPIError(http.StatusNotFound, "NOT_FOUND", "Short code does not exist")
+	ErrInvalidStrategy    = NewAPIError(http.StatusBadRequest, "INVALID_STRATEGY", "Unknown short code strategy")
+	ErrInvalidExpiry      = NewAPIError(http.StatusBadRequest, "INVALID_EXPIRY", "The expiry time must be in the future")
+	ErrInvalidRedirect    = NewAPIError(http.StatusBadRequest, "INVALID_REDIRECT_TYPE", "The redirect type must be 301, 302, 307 or 308")
+	ErrInvalidForward     = NewAPIError(http.StatusBadRequest, "INVALID_FORWARD_PATH", "The forwarded path or query string is not allowed")
+	ErrInvalidReferrer    = NewAPIError(http.StatusBadRequest, "INVALID_REFERRER_POLICY", "Unknown Referrer-Policy value")
+	ErrLinkDisabled       = NewAPIError(http.StatusGone, "LINK_DISABLED", "This short link has been disabled")
+	ErrLinkExpired        = NewAPIError(http.StatusGone, "LINK_EXPIRED", "This short link has expired")
+	ErrLinkUsedUp         = NewAPIError(http.StatusGone, "LINK_USED_UP", "This short link has already been used")
+	ErrInvalidSignature   = NewAPIError(http.StatusForbidden, "INVALID_SIGNATURE", "This short link needs a valid signed URL")
+	ErrSignatureExpired   = NewAPIError(http.StatusGone, "SIGNATURE_EXPIRED", "This signed short link has expired")
+	ErrSigningDisabled    = NewAPIError(http.StatusBadRequest, "SIGNING_NOT_CONFIGURED", "Signed links need LINK_SIGNING_KEYS to be configured")
+	ErrLinkNotSigned      = NewAPIError(http.StatusConflict, "LINK_NOT_SIGNED", "The link does not require signed URLs")
+	ErrLinkNotActive      = NewAPIError(http.StatusNotFound, "LINK_NOT_ACTIVE", "This short link is not active right now")
+	ErrInvalidMaxUses     = NewAPIError(http.StatusBadRequest, "INVALID_MAX_USES", "maxUses must be a positive number")
+	ErrReuseWithSettings  = NewAPIError(http.StatusBadRequest, "INVALID_REUSE", "reuseExisting cannot be combined with per-link settings")
+	ErrInvalidSchedule    = NewAPIError(http.StatusBadRequest, "INVALID_SCHEDULE", "The activation window or scheduled destinations are invalid")
+	ErrRevisionNotFound   = NewAPIError(http.StatusNotFound, "REVISION_NOT_FOUND", "The link has no such revision")
+	ErrAPIKeyNotFound     = NewAPIError(http.StatusNotFound, "NOT_FOUND", "API key does not exist")
+	ErrUnauthorized       = NewAPIError(http.StatusUnauthorized, "UNAUTHORIZED", "A valid API key or session is required")
+	ErrInvalidCredentials = NewAPIError(http.StatusUnauthorized, "INVALID_CREDENTIALS", "The email or password is incorrect")
+	ErrInvalidEmail       = NewAPIError(http.StatusBadRequest, "INVALID_EMAIL", "The provided email address is invalid")
+	ErrEmailTaken         = NewAPIError(http.StatusConflict, "EMAIL_TAKEN", "A user with this email already exists")
+	ErrWeakPassword       = NewAPIError(http.StatusBadRequest, "WEAK_PASSWORD", "Passwords must be 8 to 72 bytes long")
+	ErrInvalidResetToken  = NewAPIError(http.StatusBadRequest, "INVALID_RESET_TOKEN", "The password reset token is invalid or has expired")
+	ErrInvalidRole        = NewAPIError(http.StatusBadRequest, "INVALID_ROLE", "The role must be owner, admin, editor or viewer")
+	ErrSSODisabled        = NewAPIError(http.StatusNotFound, "SSO_NOT_CONFIGURED", "Single sign-on is not configured")
+	ErrSSOUnavailable     = NewAPIError(http.StatusBadGateway, "SSO_UNAVAILABLE", "The identity provider could not be reached")
+	ErrSSOFailed          = NewAPIError(http.StatusUnauthorized, "SSO_FAILED", "Single sign-on did not complete")
+	ErrInvalidSSOState    = NewAPIError(http.StatusBadRequest, "INVALID_SSO_STATE", "The sign-on attempt is unknown or has expired")
+	ErrUserNotFound       = NewAPIError(http.StatusNotFound, "NOT_FOUND", "User does not exist")
+	ErrMemberNotFound     = NewAPIError(http.StatusNotFound, "NOT_FOUND", "The user is not a member of this workspace")
+	ErrForbidden          = NewAPIError(http.StatusForbidden, "FORBIDDEN", "You do not have access to this resource")
+	ErrWorkspaceNotFound  = NewAPIError(http.StatusNotFound, "NOT_FOUND", "Workspace does not exist")
+	ErrQuotaExceeded      = NewAPIError(http.StatusForbidden, "QUOTA_EXCEEDED", "The workspace has used up its monthly quota")
+	ErrInvalidQuota       = NewAPIError(http.StatusBadRequest, "INVALID_QUOTA", "Quotas must be positive numbers")
+	ErrInvalidCodeLength  = NewAPIError(http.StatusBadRequest, "INVALID_CODE_LENGTH", "The code length must be between 4 and 20")
+	ErrDomainNotFound     = NewAPIError(http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain does not exist")
+	ErrInvalidDomain      = NewAPIError(http.StatusBadRequest, "INVALID_DOMAIN", "The provided hostname is invalid")
+	ErrDomainTaken        = NewAPIError(http.StatusConflict, "DOMAIN_TAKEN", "The domain is already registered")
+	ErrDomainNotVerified  = NewAPIError(http.StatusConflict, "DOMAIN_NOT_VERIFIED", "The domain has not been verified yet")
+	ErrDomainUnverifiable = NewAPIError(http.StatusUnprocessableEntity, "DOMAIN_VERIFICATION_FAILED", "The verification TXT record was not found")
+	ErrBadIdempotencyKey  = NewAPIError(http.StatusBadRequest, "INVALID_IDEMPOTENCY_KEY", "The Idempotency-Key must be at most 255 characters")
+	ErrIdempotencyReused  = NewAPIError(http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED", "The Idempotency-Key was already used for a different request")
+	ErrRequestInFlight    = NewAPIError(http.StatusConflict, "IDEMPOTENCY_KEY_IN_USE", "A request with this Idempotency-Key is still in progress")
+	ErrUnavailable        = NewAPIError(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "The service is temporarily unavailable")
+	ErrInternal           = NewAPIError(http.StatusInternalServerError, "INTERNAL_ERROR", "Something went wrong")
 )
 
 // IsAPIError helps to unwrap and detect custom errors
@@ -0,0 +1,110 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusHealthy   = "healthy"
+	StatusDegraded  = "degraded"
+	StatusUnhealthy = "unhealthy"
+
+	ComponentUp   = "up"
+	ComponentDown = "down"
+)
+
+// Check is a single dependency probe. Non-critical checks only degrade the
+// overall status when they fail, critical ones make the service unhealthy.
+type Check struct {
+	Name     string
+	Critical bool
+	Probe    func(ctx context.Context) error
+}
+
+type ComponentReport struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status     string                     `json:"status"`
+	CheckedAt  time.Time                  `json:"checkedAt"`
+	Components map[string]ComponentReport `json:"components"`
+}
+
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: timeout}
+}
+
+// Run executes every check concurrently, each bounded by the checker timeout.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{
+		Status:     StatusHealthy,
+		CheckedAt:  time.Now().UTC(),
+		Components: make(map[string]ComponentReport, len(c.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			component := c.runCheck(ctx, check)
+
+			mu.Lock()
+			report.Components[check.Name] = component
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	for _, component := range report.Components {
+		if component.Status == ComponentUp {
+			continue
+		}
+		if component.Critical {
+			report.Status = StatusUnhealthy
+			break
+		}
+		report.Status = StatusDegraded
+	}
+
+	return report
+}
+
+func (c *Checker) runCheck(ctx context.Context, check Check) ComponentReport {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() { errCh <- check.Probe(ctx) }()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	component := ComponentReport{
+		Status:    ComponentUp,
+		Critical:  check.Critical,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		component.Status = ComponentDown
+		component.Error = err.Error()
+	}
+	return component
+}
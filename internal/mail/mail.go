@@ -0,0 +1,111 @@
+// Package mail sends the service's transactional email, such as password
+// reset links, through a pluggable Mailer.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// MemoryMailer keeps every message instead of sending it, for tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the most recent message sent to the address, if any.
+func (m *MemoryMailer) Last(to string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if strings.EqualFold(m.messages[i].To, to) {
+			return m.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
+
+// LogMailer is used when no SMTP server is configured. It only logs who a
+// message was for, since bodies carry secrets such as reset tokens.
+type LogMailer struct{}
+
+func (LogMailer) Send(_ context.Context, msg Message) error {
+	log.Printf("mail not sent, SMTP is not configured: %q to %s", msg.Subject, msg.To)
+	return nil
+}
+
+// SMTPMailer sends plain-text mail through an SMTP relay, authenticating with
+// PLAIN when a username is set.
+type SMTPMailer struct {
+	addr     string
+	from     string
+	envelope string
+	auth     smtp.Auth
+}
+
+// NewSMTPMailer sends from the given From header, which may include a display
+// name such as "smolink <no-reply@example.com>".
+func NewSMTPMailer(addr, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{addr: addr, from: from, envelope: from}
+	if parsed, err := netmail.ParseAddress(from); err == nil {
+		m.envelope = parsed.Address
+	}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(_ context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("mail headers must not contain line breaks")
+	}
+	body := "From: " + m.from + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + msg.Subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + strings.ReplaceAll(msg.Body, "\n", "\r\n")
+	return smtp.SendMail(m.addr, m.auth, m.envelope, []string{msg.To}, []byte(body))
+}
@@ -1,41 +1,166 @@
 package migration
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 
+	"smolink/migrations"
+
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres" // Changed to postgres
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	pgxmigrate "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
+// Migrator wraps golang-migrate with the embedded migrations and the
+// application's existing connection pool, so connection params are never lost.
+type Migrator struct {
+	m *migrate.Migrate
+}
+
+func newSource() (source.Driver, error) {
+	src, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedded migrations: %w", err)
+	}
+	return src, nil
+}
+
+func NewMigrator(db *pgxpool.Pool) (*Migrator, error) {
+	src, err := newSource()
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := pgxmigrate.WithInstance(stdlib.OpenDBFromPool(db), &pgxmigrate.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration driver: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, "pgx5", driver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrate instance: %w", err)
+	}
+	return &Migrator{m: m}, nil
+}
+
+func (mg *Migrator) Up() error {
+	return ignoreNoChange(mg.m.Up())
+}
+
+// Steps applies n migrations forward, or -n migrations backward when negative.
+func (mg *Migrator) Steps(n int) error {
+	return ignoreNoChange(mg.m.Steps(n))
+}
+
+func (mg *Migrator) Goto(version uint) error {
+	return ignoreNoChange(mg.m.Migrate(version))
+}
+
+// Force sets the recorded version without running migrations, clearing the dirty flag.
+func (mg *Migrator) Force(version int) error {
+	return mg.m.Force(version)
+}
+
+func (mg *Migrator) Version() (uint, bool, error) {
+	version, dirty, err := mg.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+func (mg *Migrator) Close() error {
+	srcErr, dbErr := mg.m.Close()
+	return errors.Join(srcErr, dbErr)
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
 func RunMigrations(db *pgxpool.Pool) error {
 	log.Println("📦 Running database migrations...")
 
-	// Get connection string from pool config
-	connConfig := db.Config().ConnConfig
-	connString := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		connConfig.User,
-		connConfig.Password,
-		connConfig.Host,
-		connConfig.Port,
-		connConfig.Database,
-		connConfig.RuntimeParams["sslmode"],
-	)
-
-	m, err := migrate.New(
-		"file://migrations",
-		connString,
-	)
+	m, err := NewMigrator(db)
 	if err != nil {
-		return fmt.Errorf("failed to create migrate instance: %w", err)
+		return err
 	}
+	defer m.Close()
 
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+	if err := m.Up(); err != nil {
 		return fmt.Errorf("migration failed: %w", err)
 	}
 
 	log.Println("✅ Database migration completed.")
 	return nil
 }
+
+// LatestVersion returns the highest migration version embedded in the binary.
+func LatestVersion() (uint, error) {
+	src, err := newSource()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read migrations: %w", err)
+		}
+		version = next
+	}
+}
+
+// CurrentVersion returns the version recorded by golang-migrate in the database.
+func CurrentVersion(ctx context.Context, db *pgxpool.Pool) (uint, bool, error) {
+	var version int64
+	var dirty bool
+	err := db.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, errors.New("no migrations have been applied")
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return uint(version), dirty, nil
+}
+
+// CheckVersion reports an error unless the database schema is clean and at the
+// latest embedded migration.
+func CheckVersion(ctx context.Context, db *pgxpool.Pool) error {
+	latest, err := LatestVersion()
+	if err != nil {
+		return err
+	}
+
+	current, dirty, err := CurrentVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("schema version %d is dirty", current)
+	}
+	if current != latest {
+		return fmt.Errorf("schema version %d does not match expected version %d", current, latest)
+	}
+	return nil
+}
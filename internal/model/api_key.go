@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+type APIKey struct {
+	ID          int        `json:"id"`
+	WorkspaceID *int       `json:"workspace_id,omitempty"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	KeyHash     string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
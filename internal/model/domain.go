@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// DomainVerificationPrefix is the TXT record name prepended to a hostname.
+const DomainVerificationPrefix = "_smolink-challenge."
+
+// Domain is a custom short domain with its own code namespace.
+type Domain struct {
+	ID                int        `json:"id"`
+	WorkspaceID       int        `json:"workspace_id"`
+	Hostname          string     `json:"hostname"`
+	VerificationToken string     `json:"verification_token"`
+	VerifiedAt        *time.Time `json:"verified_at,omitempty"`
+	RootRedirectURL   *string    `json:"root_redirect_url,omitempty"`
+	NotFoundURL       *string    `json:"not_found_url,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+func (d *Domain) Verified() bool {
+	return d.VerifiedAt != nil
+}
+
+// VerificationRecord is the TXT record that proves ownership of the domain.
+func (d *Domain) VerificationRecord() string {
+	return DomainVerificationPrefix + d.Hostname
+}
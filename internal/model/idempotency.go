@@ -0,0 +1,8 @@
+package model
+
+// IdempotentResponse is a response kept under an idempotency key and replayed
+// to retries of the same request.
+type IdempotentResponse struct {
+	Status int
+	Body   []byte
+}
@@ -1,13 +1,227 @@
 package model
 
-import "time"
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	URLStatusActive   = "active"
+	URLStatusDisabled = "disabled"
+
+	DefaultRedirectType = http.StatusFound
+)
+
+// RedirectTypes are the status codes a link may redirect with.
+var RedirectTypes = []int{
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+}
+
+// ReferrerPolicies are the values accepted for the Referrer-Policy header.
+var ReferrerPolicies = []string{
+	"no-referrer",
+	"no-referrer-when-downgrade",
+	"origin",
+	"origin-when-cross-origin",
+	"same-origin",
+	"strict-origin",
+	"strict-origin-when-cross-origin",
+	"unsafe-url",
+}
+
+func ValidRedirectType(status int) bool {
+	return slices.Contains(RedirectTypes, status)
+}
+
+func ValidReferrerPolicy(policy string) bool {
+	return slices.Contains(ReferrerPolicies, policy)
+}
+
+// PermanentRedirect reports whether clients may cache the redirect itself.
+func PermanentRedirect(status int) bool {
+	return status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+}
 
 type URL struct {
-	ID          int       `json:"id"`
-	ShortCode   string    `json:"short_code"`
-	OriginalURL string    `json:"original_url"`
-	ClickCount  int       `json:"click_count"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID               int                    `json:"id"`
+	WorkspaceID      *int                   `json:"workspace_id,omitempty"`
+	DomainID         *int                   `json:"domain_id,omitempty"`
+	ShortCode        string                 `json:"short_code"`
+	OriginalURL      string                 `json:"original_url"`
+	ClickCount       int                    `json:"click_count"`
+	Status           string                 `json:"status"`
+	ExpiresAt        *time.Time             `json:"expires_at,omitempty"`
+	RedirectType     int                    `json:"redirect_type"`
+	ReferrerPolicy   *string                `json:"referrer_policy,omitempty"`
+	ForwardPath      bool                   `json:"forward_path"`
+	ActiveFrom       *time.Time             `json:"active_from,omitempty"`
+	ActiveUntil      *time.Time             `json:"active_until,omitempty"`
+	InactiveURL      *string                `json:"inactive_url,omitempty"`
+	Schedule         []ScheduledDestination `json:"schedule,omitempty"`
+	MaxUses          *int                   `json:"max_uses,omitempty"`
+	UseCount         int                    `json:"use_count"`
+	RequireSignature bool                   `json:"require_signature"`
+	CreatedAt        time.Time              `json:"created_at"`
+}
+
+// ScheduledDestination switches a link to URL once At has passed.
+type ScheduledDestination struct {
+	URL string    `json:"url"`
+	At  time.Time `json:"at"`
+}
+
+// Kinds of link revision.
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionRollback = "rollback"
+	RevisionStatus   = "status"
+)
+
+// URLRevision snapshots a link's destination and settings after a change.
+// Rollbacks record the revision they restored in RestoredFrom.
+type URLRevision struct {
+	Revision         int                    `json:"revision"`
+	Change           string                 `json:"change"`
+	RestoredFrom     *int                   `json:"restored_from,omitempty"`
+	ChangedBy        *string                `json:"changed_by,omitempty"`
+	OriginalURL      string                 `json:"original_url"`
+	RedirectType     int                    `json:"redirect_type"`
+	ReferrerPolicy   *string                `json:"referrer_policy,omitempty"`
+	ForwardPath      bool                   `json:"forward_path"`
+	ActiveFrom       *time.Time             `json:"active_from,omitempty"`
+	ActiveUntil      *time.Time             `json:"active_until,omitempty"`
+	InactiveURL      *string                `json:"inactive_url,omitempty"`
+	Schedule         []ScheduledDestination `json:"schedule,omitempty"`
+	RequireSignature bool                   `json:"require_signature"`
+	MaxUses          *int                   `json:"max_uses,omitempty"`
+	Status           string                 `json:"status"`
+	CreatedAt        time.Time              `json:"created_at"`
+}
+
+// MaxScheduledDestinations bounds a link's schedule, which every cached record
+// carries.
+const MaxScheduledDestinations = 50
+
+// LinkUpdate holds the settings to change on a link; nil fields are kept.
+// An empty ReferrerPolicy or InactiveURL and a zero ActiveFrom or ActiveUntil
+// clear the setting, and a non-nil Schedule replaces the whole schedule.
+type LinkUpdate struct {
+	OriginalURL      *string
+	RedirectType     *int
+	ReferrerPolicy   *string
+	ForwardPath      *bool
+	ActiveFrom       *time.Time
+	ActiveUntil      *time.Time
+	InactiveURL      *string
+	Schedule         *[]ScheduledDestination
+	RequireSignature *bool
+}
+
+// LinkRecord is the subset of a URL needed to serve a redirect. It is what the
+// caches hold, so redirects never need Postgres on a cache hit.
+type LinkRecord struct {
+	ID             int
+	WorkspaceID    *int
+	OriginalURL    string
+	Status         string
+	ExpiresAt      *time.Time
+	RedirectType   int
+	ReferrerPolicy string
+	ForwardPath    bool
+	ActiveFrom     *time.Time
+	ActiveUntil    *time.Time
+	InactiveURL    string
+	Schedule       []ScheduledDestination
+
+	// MaxUses limits how often the link resolves; 0 means no limit. Uses
+	// are counted in Postgres, never in the caches.
+	MaxUses int
+
+	// RequireSignature only lets signed, unexpired URLs resolve the link.
+	RequireSignature bool
+}
+
+func (u *URL) Record() *LinkRecord {
+	record := &LinkRecord{
+		ID:           u.ID,
+		WorkspaceID:  u.WorkspaceID,
+		OriginalURL:  u.OriginalURL,
+		Status:       u.Status,
+		ExpiresAt:    u.ExpiresAt,
+		RedirectType: u.RedirectType,
+		ForwardPath:  u.ForwardPath,
+		ActiveFrom:   u.ActiveFrom,
+		ActiveUntil:  u.ActiveUntil,
+		Schedule:     u.Schedule,
+
+		RequireSignature: u.RequireSignature,
+	}
+	if u.ReferrerPolicy != nil {
+		record.ReferrerPolicy = *u.ReferrerPolicy
+	}
+	if u.InactiveURL != nil {
+		record.InactiveURL = *u.InactiveURL
+	}
+	if u.MaxUses != nil {
+		record.MaxUses = *u.MaxUses
+	}
+	return record
+}
+
+func (r *LinkRecord) Expired(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(*r.ExpiresAt)
+}
+
+// Active reports whether now falls inside the link's activation window.
+func (r *LinkRecord) Active(now time.Time) bool {
+	if r.ActiveFrom != nil && now.Before(*r.ActiveFrom) {
+		return false
+	}
+	return r.ActiveUntil == nil || now.Before(*r.ActiveUntil)
+}
+
+// Destination is where the link points at now: the latest scheduled
+// destination that has taken effect, or OriginalURL before the first one.
+func (r *LinkRecord) Destination(now time.Time) string {
+	destination, latest := r.OriginalURL, time.Time{}
+	for _, change := range r.Schedule {
+		if !now.Before(change.At) && !change.At.Before(latest) {
+			destination, latest = change.URL, change.At
+		}
+	}
+	return destination
+}
+
+// NextTransition returns when the link next changes how it resolves, through
+// its window, expiry or schedule, or nil if it never does.
+func (r *LinkRecord) NextTransition(now time.Time) *time.Time {
+	var next *time.Time
+	consider := func(t time.Time) {
+		if t.After(now) && (next == nil || t.Before(*next)) {
+			next = &t
+		}
+	}
+	for _, t := range []*time.Time{r.ActiveFrom, r.ActiveUntil, r.ExpiresAt} {
+		if t != nil {
+			consider(*t)
+		}
+	}
+	for _, change := range r.Schedule {
+		consider(change.At)
+	}
+	return next
+}
+
+type CodeAvailability struct {
+	Code        string   `json:"code"`
+	Available   bool     `json:"available"`
+	Reason      string   `json:"reason,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
 }
 
 type URLAnalytics struct {
@@ -17,3 +231,22 @@ type URLAnalytics struct {
 	UserAgent  string    `json:"user_agent"`
 	AccessedAt time.Time `json:"accessed_at"`
 }
+
+type DailyClicks struct {
+	Date   string `json:"date"`
+	Clicks int    `json:"clicks"`
+}
+
+type UserAgentCount struct {
+	UserAgent string `json:"user_agent"`
+	Clicks    int    `json:"clicks"`
+}
+
+type URLStats struct {
+	ShortCode      string           `json:"short_code"`
+	TotalClicks    int              `json:"total_clicks"`
+	UniqueVisitors int              `json:"unique_visitors"`
+	LastAccessedAt *time.Time       `json:"last_accessed_at,omitempty"`
+	DailyClicks    []DailyClicks    `json:"daily_clicks"`
+	TopUserAgents  []UserAgentCount `json:"top_user_agents"`
+}
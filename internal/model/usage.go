@@ -0,0 +1,64 @@
+package model
+
+import "time"
+
+// Usage metrics, counted per workspace and calendar month in UTC.
+const (
+	MetricLinksCreated   = "links_created"
+	MetricAPIRequests    = "api_requests"
+	MetricClicksRecorded = "clicks_recorded"
+)
+
+var UsageMetrics = []string{MetricLinksCreated, MetricAPIRequests, MetricClicksRecorded}
+
+// UsagePeriodLayout formats the month a usage period covers, e.g. "2026-10".
+const UsagePeriodLayout = "2006-01"
+
+// Quotas caps a workspace's monthly usage of each metric; nil is unlimited.
+type Quotas struct {
+	LinksCreated   *int64 `json:"links_created,omitempty"`
+	APIRequests    *int64 `json:"api_requests,omitempty"`
+	ClicksRecorded *int64 `json:"clicks_recorded,omitempty"`
+}
+
+// Limit returns the quota of metric, or nil if it is unlimited.
+func (q Quotas) Limit(metric string) *int64 {
+	switch metric {
+	case MetricLinksCreated:
+		return q.LinksCreated
+	case MetricAPIRequests:
+		return q.APIRequests
+	case MetricClicksRecorded:
+		return q.ClicksRecorded
+	}
+	return nil
+}
+
+// Or fills the quotas q leaves unset from defaults.
+func (q Quotas) Or(defaults Quotas) Quotas {
+	if q.LinksCreated == nil {
+		q.LinksCreated = defaults.LinksCreated
+	}
+	if q.APIRequests == nil {
+		q.APIRequests = defaults.APIRequests
+	}
+	if q.ClicksRecorded == nil {
+		q.ClicksRecorded = defaults.ClicksRecorded
+	}
+	return q
+}
+
+// MetricUsage is how much of a metric a workspace used this period.
+type MetricUsage struct {
+	Metric string `json:"metric"`
+	Used   int64  `json:"used"`
+	Limit  *int64 `json:"limit,omitempty"`
+}
+
+// Usage reports a workspace's usage in the current period.
+type Usage struct {
+	WorkspaceID int           `json:"workspace_id"`
+	Period      string        `json:"period"`
+	ResetsAt    time.Time     `json:"resets_at"`
+	Metrics     []MetricUsage `json:"metrics"`
+}
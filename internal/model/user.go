@@ -0,0 +1,54 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// Workspace roles, from most to least privileged.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var roleRanks = []string{RoleViewer, RoleEditor, RoleAdmin, RoleOwner}
+
+func ValidRole(role string) bool {
+	return slices.Contains(roleRanks, role)
+}
+
+// RoleAtLeast reports whether role grants everything required does. Unknown
+// roles grant nothing.
+func RoleAtLeast(role, required string) bool {
+	have := slices.Index(roleRanks, role)
+	return have >= 0 && have >= slices.Index(roleRanks, required)
+}
+
+// User is a person who logs in with an email and password. Users without a
+// password can only get one through the password reset flow.
+type User struct {
+	ID           int       `json:"id"`
+	Email        string    `json:"email"`
+	Name         string    `json:"name"`
+	PasswordHash *string   `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Membership grants a user a role in a workspace.
+type Membership struct {
+	UserID      int       `json:"user_id"`
+	WorkspaceID int       `json:"workspace_id"`
+	Role        string    `json:"role"`
+	Email       string    `json:"email,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GroupRole grants members of an identity provider group a role in a
+// workspace when they log in through single sign-on.
+type GroupRole struct {
+	Group       string
+	WorkspaceID int
+	Role        string
+}
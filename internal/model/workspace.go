@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Bounds for a workspace's random code length.
+const (
+	MinWorkspaceCodeLength = 4
+	MaxWorkspaceCodeLength = 20
+)
+
+// Workspace isolates a team's links, API keys, domains and members from
+// other workspaces. CodeLength and RedirectType override the instance
+// defaults for links created in it, and Quotas the instance's quotas.
+type Workspace struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	CodeLength   *int      `json:"code_length,omitempty"`
+	RedirectType *int      `json:"redirect_type,omitempty"`
+	Quotas       Quotas    `json:"quotas"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// WorkspaceUpdate changes a workspace's name and settings. Nil fields are
+// left alone and zero settings fall back to the instance defaults.
+type WorkspaceUpdate struct {
+	Name         *string
+	CodeLength   *int
+	RedirectType *int
+}
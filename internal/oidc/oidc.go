@@ -0,0 +1,342 @@
+// Package oidc is a minimal OpenID Connect relying party: discovery, the
+// authorization code flow with PKCE, and RS256 ID token verification.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockSkew is how far the provider's clock may run ahead of or behind ours.
+const clockSkew = time.Minute
+
+var (
+	ErrInvalidToken = errors.New("invalid ID token")
+	ErrExchange     = errors.New("authorization code exchange failed")
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Provider talks to one OpenID provider. Its endpoints are discovered on first
+// use, so the service starts even while the provider is unreachable.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]*rsa.PublicKey
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &Provider{cfg: cfg, client: client}
+}
+
+// AuthRequest holds the secrets of one login attempt, kept by the caller until
+// the provider redirects back.
+type AuthRequest struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+func NewAuthRequest() (*AuthRequest, error) {
+	values := make([]string, 3)
+	for i := range values {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	return &AuthRequest{State: values[0], Nonce: values[1], CodeVerifier: values[2]}, nil
+}
+
+// AuthCodeURL is where to send the browser to log in.
+func (p *Provider) AuthCodeURL(ctx context.Context, req *AuthRequest) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	endpoint, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(req.CodeVerifier))
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", req.State)
+	query.Set("nonce", req.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of
+// the ID token that came with it.
+func (p *Provider) Exchange(ctx context.Context, code string, req *AuthRequest) (*Claims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {req.CodeVerifier},
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.do(httpReq, &tokens); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrExchange)
+	}
+	return p.Verify(ctx, tokens.IDToken, req.Nonce, time.Now())
+}
+
+// Verify checks an ID token's signature, issuer, audience, expiry and nonce.
+func (p *Provider) Verify(ctx context.Context, rawToken, nonce string, now time.Time) (*Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], &claims.raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	switch {
+	case claims.Issuer != p.cfg.Issuer:
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidToken, claims.Issuer)
+	case !slices.Contains(claims.Audience, p.cfg.ClientID):
+		return nil, fmt.Errorf("%w: not issued for this client", ErrInvalidToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	case time.Unix(claims.Expiry, 0).Before(now.Add(-clockSkew)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var d discovery
+	if err := p.do(req, &d); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: provider claims issuer %q", d.Issuer)
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// key returns the provider's signing key, refetching the key set when kid is
+// unknown so key rotations are picked up.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.do(req, &set); err != nil {
+		return nil, fmt.Errorf("oidc keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+func (p *Provider) do(req *http.Request, dest any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d: %s", req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, dest)
+}
+
+func decodeSegment(segment string, dest any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dest)
+}
+
+// Claims are the ID token claims smolink uses. Strings reads any other claim.
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	Expiry        int64    `json:"exp"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+
+	raw map[string]json.RawMessage
+}
+
+// Strings returns a claim holding a string or a list of strings, such as a
+// groups claim, or nil when it is missing or of another type.
+func (c *Claims) Strings(name string) []string {
+	raw, ok := c.raw[name]
+	if !ok {
+		return nil
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		return list
+	}
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return []string{single}
+	}
+	return nil
+}
+
+// audience accepts both forms of the aud claim: a string or a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"smolink/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const apiKeyColumns = "id, workspace_id, name, prefix, key_hash, created_at, last_used_at, revoked_at"
+
+func scanAPIKey(row pgx.Row) (*model.APIKey, error) {
+	var key model.APIKey
+	if err := row.Scan(&key.ID, &key.WorkspaceID, &key.Name, &key.Prefix, &key.KeyHash, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *PostgresRepository) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	return r.db.QueryRow(ctx,
+		"INSERT INTO api_keys (workspace_id, name, prefix, key_hash) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		key.WorkspaceID, key.Name, key.Prefix, key.KeyHash,
+	).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (r *PostgresRepository) ListAPIKeys(ctx context.Context, scope WorkspaceScope) ([]model.APIKey, error) {
+	filter, args := inWorkspace(scope)
+	rows, err := r.db.Query(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE "+filter+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// GetActiveAPIKeyByHash only returns keys that have not been revoked.
+func (r *PostgresRepository) GetActiveAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	return scanAPIKey(r.db.QueryRow(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL", keyHash))
+}
+
+func (r *PostgresRepository) RevokeAPIKey(ctx context.Context, scope WorkspaceScope, id int) error {
+	filter, args := inWorkspace(scope, id)
+	tag, err := r.db.Exec(ctx, "UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL AND "+filter, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r *PostgresRepository) TouchAPIKey(ctx context.Context, id int) error {
+	_, err := r.db.Exec(ctx, "UPDATE api_keys SET last_used_at = now() WHERE id = $1", id)
+	return err
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"smolink/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const domainColumns = "id, workspace_id, hostname, verification_token, verified_at, root_redirect_url, not_found_url, created_at"
+
+func scanDomain(row pgx.Row) (*model.Domain, error) {
+	var d model.Domain
+	if err := row.Scan(&d.ID, &d.WorkspaceID, &d.Hostname, &d.VerificationToken, &d.VerifiedAt, &d.RootRedirectURL, &d.NotFoundURL, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// CreateDomain returns ErrDuplicateHostname when the hostname is registered.
+func (r *PostgresRepository) CreateDomain(ctx context.Context, domain *model.Domain) error {
+	err := r.db.QueryRow(ctx,
+		"INSERT INTO domains (workspace_id, hostname, verification_token, root_redirect_url, not_found_url) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
+		domain.WorkspaceID, domain.Hostname, domain.VerificationToken, domain.RootRedirectURL, domain.NotFoundURL,
+	).Scan(&domain.ID, &domain.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicateHostname
+	}
+	return err
+}
+
+func (r *PostgresRepository) GetDomain(ctx context.Context, scope WorkspaceScope, id int) (*model.Domain, error) {
+	filter, args := inWorkspace(scope, id)
+	return scanDomain(r.db.QueryRow(ctx, "SELECT "+domainColumns+" FROM domains WHERE id = $1 AND "+filter, args...))
+}
+
+func (r *PostgresRepository) GetDomainByHostname(ctx context.Context, hostname string) (*model.Domain, error) {
+	return scanDomain(r.db.QueryRow(ctx, "SELECT "+domainColumns+" FROM domains WHERE hostname = $1", hostname))
+}
+
+func (r *PostgresRepository) ListVerifiedDomains(ctx context.Context) ([]model.Domain, error) {
+	rows, err := r.db.Query(ctx, "SELECT "+domainColumns+" FROM domains WHERE verified_at IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := []model.Domain{}
+	for rows.Next() {
+		domain, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, *domain)
+	}
+	return domains, rows.Err()
+}
+
+func (r *PostgresRepository) ListDomains(ctx context.Context, scope WorkspaceScope) ([]model.Domain, error) {
+	filter, args := inWorkspace(scope)
+	rows, err := r.db.Query(ctx, "SELECT "+domainColumns+" FROM domains WHERE "+filter+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := []model.Domain{}
+	for rows.Next() {
+		domain, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, *domain)
+	}
+	return domains, rows.Err()
+}
+
+func (r *PostgresRepository) UpdateDomainPages(ctx context.Context, id int, rootRedirectURL, notFoundURL *string) (*model.Domain, error) {
+	return scanDomain(r.db.QueryRow(ctx,
+		"UPDATE domains SET root_redirect_url = $2, not_found_url = $3 WHERE id = $1 RETURNING "+domainColumns,
+		id, rootRedirectURL, notFoundURL,
+	))
+}
+
+func (r *PostgresRepository) MarkDomainVerified(ctx context.Context, id int) (*model.Domain, error) {
+	return scanDomain(r.db.QueryRow(ctx,
+		"UPDATE domains SET verified_at = COALESCE(verified_at, now()) WHERE id = $1 RETURNING "+domainColumns, id,
+	))
+}
+
+// DeleteDomain also deletes every link in the domain's namespace.
+func (r *PostgresRepository) DeleteDomain(ctx context.Context, id int) error {
+	tag, err := r.db.Exec(ctx, "DELETE FROM domains WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
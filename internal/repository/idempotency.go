@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"smolink/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrIdempotencyClaimLost is returned when a request finishes after its claim
+// on an idempotency key expired, so the key may belong to another request.
+var ErrIdempotencyClaimLost = errors.New("idempotency key claim lost")
+
+// Idempotency keys are stored by the hash of the caller's scope and key.
+func idempotencyKey(keyHash string) string {
+	return "idempotency:" + keyHash
+}
+
+// IdempotencyRecord is what an idempotency key already holds: the
+// fingerprint of the request that claimed it and, once that request has
+// finished, its response.
+type IdempotencyRecord struct {
+	Fingerprint string
+	Response    *model.IdempotentResponse
+}
+
+// claimIdempotencyKey stores the fingerprint ARGV[1] and claim token ARGV[2]
+// under KEYS[1] for ARGV[3] milliseconds unless the key exists, in which case
+// it returns the stored fingerprint, status and body.
+var claimIdempotencyKey = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return redis.call('HMGET', KEYS[1], 'fingerprint', 'status', 'body')
+end
+redis.call('HSET', KEYS[1], 'fingerprint', ARGV[1], 'token', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return false
+`)
+
+// saveIdempotentResponse stores the status ARGV[2] and body ARGV[3] under
+// KEYS[1] for ARGV[4] milliseconds if the key is still claimed with token
+// ARGV[1] and has no response yet.
+var saveIdempotentResponse = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'token') ~= ARGV[1] or redis.call('HEXISTS', KEYS[1], 'status') == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'status', ARGV[2], 'body', ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return 1
+`)
+
+// releaseIdempotencyKey deletes KEYS[1] if it is still claimed with token
+// ARGV[1] and has no response yet.
+var releaseIdempotencyKey = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'token') ~= ARGV[1] or redis.call('HEXISTS', KEYS[1], 'status') == 1 then
+	return 0
+end
+return redis.call('DEL', KEYS[1])
+`)
+
+// ClaimIdempotencyKey atomically claims a key for a request, holding it for
+// ttl under token. It returns nil when the key was claimed, or what the key
+// already holds, so concurrent duplicates never both run.
+func (r *RedisRepository) ClaimIdempotencyKey(ctx context.Context, keyHash, token, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	reply, err := claimIdempotencyKey.Run(ctx, r.client, []string{idempotencyKey(keyHash)}, fingerprint, token, ttl.Milliseconds()).Slice()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 3 {
+		return nil, fmt.Errorf("unexpected idempotency record: %v", reply)
+	}
+
+	record := &IdempotencyRecord{}
+	record.Fingerprint, _ = reply[0].(string)
+	if status, ok := reply[1].(string); ok {
+		code, err := strconv.Atoi(status)
+		if err != nil {
+			return nil, fmt.Errorf("invalid idempotency status %q", status)
+		}
+		body, _ := reply[2].(string)
+		record.Response = &model.IdempotentResponse{Status: code, Body: []byte(body)}
+	}
+	return record, nil
+}
+
+// SaveIdempotentResponse stores the response of the request holding the key
+// under token and keeps it for ttl. It returns ErrIdempotencyClaimLost if the
+// claim expired in the meantime.
+func (r *RedisRepository) SaveIdempotentResponse(ctx context.Context, keyHash, token string, response *model.IdempotentResponse, ttl time.Duration) error {
+	saved, err := saveIdempotentResponse.Run(ctx, r.client, []string{idempotencyKey(keyHash)}, token, response.Status, response.Body, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if saved == 0 {
+		return ErrIdempotencyClaimLost
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets a key claimed under token so the request can
+// be retried. It returns ErrIdempotencyClaimLost if the claim expired in the
+// meantime.
+func (r *RedisRepository) ReleaseIdempotencyKey(ctx context.Context, keyHash, token string) error {
+	released, err := releaseIdempotencyKey.Run(ctx, r.client, []string{idempotencyKey(keyHash)}, token).Int()
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		return ErrIdempotencyClaimLost
+	}
+	return nil
+}
@@ -2,11 +2,33 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"smolink/internal/model"
+	"time"
 
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrDuplicateShortCode is returned by CreateURL when the code is already taken
+// in the link's domain namespace.
+var ErrDuplicateShortCode = errors.New("short code already exists")
+
+// ErrInvalidActiveWindow is returned when a link would become active no
+// earlier than it stops being active.
+var ErrInvalidActiveWindow = errors.New("active window ends before it starts")
+
+// ErrDuplicateHostname is returned by CreateDomain for a registered hostname.
+var ErrDuplicateHostname = errors.New("hostname already registered")
+
+// ErrDuplicateEmail is returned by CreateUser for a registered email.
+var ErrDuplicateEmail = errors.New("email already registered")
+
+const urlColumns = "id, workspace_id, domain_id, short_code, original_url, click_count, status, expires_at, redirect_type, referrer_policy, forward_path, active_from, active_until, inactive_url, schedule, max_uses, use_count, require_signature, created_at"
+
 type PostgresRepository struct {
 	db *pgxpool.Pool
 }
@@ -19,20 +41,268 @@ func (r *PostgresRepository) DB() *pgxpool.Pool {
 	return r.db
 }
 
-func (r *PostgresRepository) CreateURL(ctx context.Context, url *model.URL) error {
-	_, err := r.db.Exec(ctx, "INSERT INTO urls (short_code, original_url) VALUES ($1, $2)", url.ShortCode, url.OriginalURL)
-	return err
+func (r *PostgresRepository) Ping(ctx context.Context) error {
+	return r.db.Ping(ctx)
 }
 
-func (r *PostgresRepository) GetURL(ctx context.Context, shortCode string) (*model.URL, error) {
+func scanURL(row pgx.Row) (*model.URL, error) {
 	var url model.URL
-	err := r.db.QueryRow(ctx, "SELECT id, short_code, original_url, click_count FROM urls WHERE short_code = $1", shortCode).Scan(&url.ID, &url.ShortCode, &url.OriginalURL, &url.ClickCount)
-	if err != nil {
+	if err := row.Scan(&url.ID, &url.WorkspaceID, &url.DomainID, &url.ShortCode, &url.OriginalURL, &url.ClickCount, &url.Status, &url.ExpiresAt, &url.RedirectType, &url.ReferrerPolicy, &url.ForwardPath, &url.ActiveFrom, &url.ActiveUntil, &url.InactiveURL, &url.Schedule, &url.MaxUses, &url.UseCount, &url.RequireSignature, &url.CreatedAt); err != nil {
 		return nil, err
 	}
 	return &url, nil
 }
 
+// CreateURL inserts a link together with its first revision, crediting actor.
+func (r *PostgresRepository) CreateURL(ctx context.Context, url *model.URL, actor string) error {
+	if url.RedirectType == 0 {
+		url.RedirectType = model.DefaultRedirectType
+	}
+	if url.Schedule == nil {
+		url.Schedule = []model.ScheduledDestination{}
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO urls (workspace_id, domain_id, short_code, original_url, expires_at, redirect_type, referrer_policy, forward_path, active_from, active_until, inactive_url, schedule, max_uses, require_signature)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING id, status, created_at`,
+		url.WorkspaceID, url.DomainID, url.ShortCode, url.OriginalURL, url.ExpiresAt, url.RedirectType, url.ReferrerPolicy, url.ForwardPath,
+		url.ActiveFrom, url.ActiveUntil, url.InactiveURL, url.Schedule, url.MaxUses, url.RequireSignature,
+	).Scan(&url.ID, &url.Status, &url.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicateShortCode
+	}
+	if isCheckViolation(err) {
+		return ErrInvalidActiveWindow
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := insertRevision(ctx, tx, url.ID, model.RevisionCreate, nil, actor); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// inNamespace returns a WHERE clause selecting a domain's namespace, nil being
+// the default one, and appends its parameter to args. The two forms match the
+// partial unique indexes on urls, which IS NOT DISTINCT FROM would not.
+func inNamespace(domainID *int, args ...any) (string, []any) {
+	if domainID == nil {
+		return "domain_id IS NULL", args
+	}
+	args = append(args, *domainID)
+	return fmt.Sprintf("domain_id = $%d", len(args)), args
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation
+}
+
+func isCheckViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.CheckViolation
+}
+
+// clearable splits an optional time update into whether to change the column
+// and its new value, a zero time clearing it.
+func clearable(t *time.Time) (bool, *time.Time) {
+	if t == nil || t.IsZero() {
+		return t != nil, nil
+	}
+	return true, t
+}
+
+// NextCodeSequence feeds the sequential short code generators.
+func (r *PostgresRepository) NextCodeSequence(ctx context.Context) (int64, error) {
+	var n int64
+	err := r.db.QueryRow(ctx, "SELECT nextval('url_code_seq')").Scan(&n)
+	return n, err
+}
+
+// CountCodesOfLength measures keyspace utilization for generated codes.
+func (r *PostgresRepository) CountCodesOfLength(ctx context.Context, length int) (int64, error) {
+	var n int64
+	err := r.db.QueryRow(ctx, "SELECT count(*) FROM urls WHERE length(short_code) = $1", length).Scan(&n)
+	return n, err
+}
+
+// ExistingShortCodes reports which of codes are already taken in a domain's
+// namespace, in one query. A nil domainID means the default namespace.
+func (r *PostgresRepository) ExistingShortCodes(ctx context.Context, domainID *int, codes []string) (map[string]bool, error) {
+	filter, args := inNamespace(domainID, codes)
+	rows, err := r.db.Query(ctx, "SELECT short_code FROM urls WHERE short_code = ANY($1) AND "+filter, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		taken[code] = true
+	}
+	return taken, rows.Err()
+}
+
+// inLink returns a WHERE clause selecting the link shortCode names in a
+// domain's namespace, provided it is in scope. shortCode is always $1.
+func inLink(scope WorkspaceScope, domainID *int, shortCode string, args ...any) (string, []any) {
+	namespace, args := inNamespace(domainID, append([]any{shortCode}, args...)...)
+	workspace, args := inWorkspace(scope, args...)
+	return "short_code = $1 AND " + namespace + " AND " + workspace, args
+}
+
+// GetURL looks a code up in a domain's namespace; nil is the default
+// namespace. Links outside scope are not found.
+func (r *PostgresRepository) GetURL(ctx context.Context, scope WorkspaceScope, domainID *int, shortCode string) (*model.URL, error) {
+	filter, args := inLink(scope, domainID, shortCode)
+	return scanURL(r.db.QueryRow(ctx, "SELECT "+urlColumns+" FROM urls WHERE "+filter, args...))
+}
+
+// FindReusableURL returns the oldest link of a workspace in a domain's
+// namespace whose destination is canonically the same as destination and
+// that sends every visitor there right now and until it expires: enabled,
+// inside its active window, unscheduled, with uses left and no signature
+// required. It returns pgx.ErrNoRows when there is none.
+func (r *PostgresRepository) FindReusableURL(ctx context.Context, workspaceID int, domainID *int, destination string) (*model.URL, error) {
+	namespace, args := inNamespace(domainID, destination, model.URLStatusActive, workspaceID)
+	return scanURL(r.db.QueryRow(ctx, `SELECT `+urlColumns+` FROM urls
+		WHERE canonical_url(original_url) = canonical_url($1) AND status = $2 AND workspace_id = $3 AND `+namespace+`
+		AND NOT require_signature AND schedule = '[]'::jsonb
+		AND (active_from IS NULL OR active_from <= now()) AND (active_until IS NULL OR active_until > now())
+		AND (expires_at IS NULL OR expires_at > now()) AND (max_uses IS NULL OR use_count < max_uses)
+		ORDER BY id LIMIT 1`, args...))
+}
+
+// ListURLs returns a page of links, newest first, and how many are in scope.
+// A positive before only lists links with smaller IDs, so pages stay stable
+// while links are being created.
+func (r *PostgresRepository) ListURLs(ctx context.Context, scope WorkspaceScope, limit, offset, before int) ([]model.URL, int, error) {
+	filter, args := inWorkspace(scope)
+	var total int
+	if err := r.db.QueryRow(ctx, "SELECT count(*) FROM urls WHERE "+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	filter, args = inWorkspace(scope, limit, offset)
+	if before > 0 {
+		args = append(args, before)
+		filter += fmt.Sprintf(" AND id < $%d", len(args))
+	}
+	rows, err := r.db.Query(ctx, "SELECT "+urlColumns+" FROM urls WHERE "+filter+" ORDER BY id DESC LIMIT $1 OFFSET $2", args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	urls := []model.URL{}
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		urls = append(urls, *url)
+	}
+	return urls, total, rows.Err()
+}
+
+// UpdateURL changes a link's settings and records the result as a revision
+// credited to actor.
+func (r *PostgresRepository) UpdateURL(ctx context.Context, scope WorkspaceScope, domainID *int, shortCode string, update model.LinkUpdate, actor string) (*model.URL, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	setFrom, activeFrom := clearable(update.ActiveFrom)
+	setUntil, activeUntil := clearable(update.ActiveUntil)
+	filter, args := inLink(scope, domainID, shortCode, update.OriginalURL, update.RedirectType, update.ReferrerPolicy, update.ForwardPath,
+		setFrom, activeFrom, setUntil, activeUntil, update.InactiveURL, update.Schedule, update.RequireSignature)
+	url, err := scanURL(tx.QueryRow(ctx, `UPDATE urls SET
+		original_url = COALESCE($2, original_url),
+		redirect_type = COALESCE($3, redirect_type),
+		referrer_policy = CASE WHEN $4::text IS NULL THEN referrer_policy ELSE NULLIF($4, '') END,
+		forward_path = COALESCE($5, forward_path),
+		active_from = CASE WHEN $6 THEN $7::timestamptz ELSE active_from END,
+		active_until = CASE WHEN $8 THEN $9::timestamptz ELSE active_until END,
+		inactive_url = CASE WHEN $10::text IS NULL THEN inactive_url ELSE NULLIF($10, '') END,
+		schedule = COALESCE($11, schedule),
+		require_signature = COALESCE($12, require_signature)
+		WHERE `+filter+" RETURNING "+urlColumns, args...))
+	if isCheckViolation(err) {
+		return nil, ErrInvalidActiveWindow
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insertRevision(ctx, tx, url.ID, model.RevisionUpdate, nil, actor); err != nil {
+		return nil, err
+	}
+	return url, tx.Commit(ctx)
+}
+
+// UpdateURLStatus enables or disables a link and records the result as a
+// revision credited to actor.
+func (r *PostgresRepository) UpdateURLStatus(ctx context.Context, scope WorkspaceScope, domainID *int, shortCode, status, actor string) (*model.URL, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	filter, args := inLink(scope, domainID, shortCode, status)
+	url, err := scanURL(tx.QueryRow(ctx, "UPDATE urls SET status = $2 WHERE "+filter+" RETURNING "+urlColumns, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insertRevision(ctx, tx, url.ID, model.RevisionStatus, nil, actor); err != nil {
+		return nil, err
+	}
+	return url, tx.Commit(ctx)
+}
+
+func (r *PostgresRepository) DeleteURL(ctx context.Context, scope WorkspaceScope, domainID *int, shortCode string) error {
+	filter, args := inLink(scope, domainID, shortCode)
+	tag, err := r.db.Exec(ctx, "DELETE FROM urls WHERE "+filter, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ConsumeUse takes one of a limited-use link's remaining uses, reporting false
+// once none are left. The conditional update makes concurrent visits on any
+// instance take distinct uses.
+func (r *PostgresRepository) ConsumeUse(ctx context.Context, urlID int) (bool, error) {
+	tag, err := r.db.Exec(ctx, "UPDATE urls SET use_count = use_count + 1 WHERE id = $1 AND use_count < max_uses", urlID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
 func (r *PostgresRepository) IncrementClickCount(ctx context.Context, urlID int) error {
 	_, err := r.db.Exec(ctx, "UPDATE urls SET click_count = click_count + 1 WHERE id = $1", urlID)
 	return err
@@ -42,3 +312,60 @@ func (r *PostgresRepository) LogAnalytics(ctx context.Context, analytics *model.
 	_, err := r.db.Exec(ctx, "INSERT INTO url_analytics (url_id, ip_address, user_agent) VALUES ($1, $2, $3)", analytics.URLID, analytics.IPAddress, analytics.UserAgent)
 	return err
 }
+
+// GetURLStats aggregates url_analytics for a link over the last `days` days.
+func (r *PostgresRepository) GetURLStats(ctx context.Context, url *model.URL, days int) (*model.URLStats, error) {
+	stats := &model.URLStats{
+		ShortCode:     url.ShortCode,
+		TotalClicks:   url.ClickCount,
+		DailyClicks:   []model.DailyClicks{},
+		TopUserAgents: []model.UserAgentCount{},
+	}
+
+	err := r.db.QueryRow(ctx,
+		"SELECT count(DISTINCT ip_address), max(accessed_at) FROM url_analytics WHERE url_id = $1",
+		url.ID,
+	).Scan(&stats.UniqueVisitors, &stats.LastAccessedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT to_char(date_trunc('day', accessed_at), 'YYYY-MM-DD'), count(*)
+		FROM url_analytics
+		WHERE url_id = $1 AND accessed_at >= now() - make_interval(days => $2)
+		GROUP BY 1 ORDER BY 1`, url.ID, days)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var day model.DailyClicks
+		if err := rows.Scan(&day.Date, &day.Clicks); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.DailyClicks = append(stats.DailyClicks, day)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.db.Query(ctx, `
+		SELECT coalesce(user_agent, ''), count(*)
+		FROM url_analytics
+		WHERE url_id = $1 AND accessed_at >= now() - make_interval(days => $2)
+		GROUP BY 1 ORDER BY 2 DESC LIMIT 5`, url.ID, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ua model.UserAgentCount
+		if err := rows.Scan(&ua.UserAgent, &ua.Clicks); err != nil {
+			return nil, err
+		}
+		stats.TopUserAgents = append(stats.TopUserAgents, ua)
+	}
+	return stats, rows.Err()
+}
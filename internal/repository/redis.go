@@ -2,11 +2,55 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"strconv"
+	"strings"
 	"time"
 
+	"smolink/internal/model"
+
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	// linkRecordVersion is bumped whenever the cached hash layout changes.
+	// Entries written with any other version are treated as misses.
+	linkRecordVersion = "8"
+
+	// linkGenerationTTL keeps a code's generation well past any cache fill
+	// that read it, so a fill never mistakes an expired generation for its own.
+	linkGenerationTTL = time.Hour
+
+	// ttlJitterFraction spreads expiries over +/-10% of the requested TTL so
+	// keys written together don't all expire together.
+	ttlJitterFraction = 0.1
+)
+
+// Hash fields of a cached link record. Kept short since every link carries them.
+const (
+	fieldVersion      = "v"
+	fieldNotFound     = "nf"
+	fieldID           = "id"
+	fieldWorkspace    = "ws"
+	fieldOriginalURL  = "dst"
+	fieldStatus       = "st"
+	fieldExpiresAt    = "exp"
+	fieldRedirectType = "rt"
+	fieldReferrer     = "rp"
+	fieldForwardPath  = "fw"
+	fieldActiveFrom   = "af"
+	fieldActiveUntil  = "au"
+	fieldInactiveURL  = "iu"
+	fieldSchedule     = "sc"
+	fieldMaxUses      = "mu"
+	fieldSigned       = "sg"
+)
+
+// ErrCachedNotFound is returned by GetLink when the code is negatively cached.
+var ErrCachedNotFound = errors.New("short code cached as not found")
+
 type RedisRepository struct {
 	client *redis.Client
 }
@@ -19,10 +63,233 @@ func (r *RedisRepository) Client() *redis.Client {
 	return r.client
 }
 
-func (r *RedisRepository) GetURL(ctx context.Context, shortCode string) (string, error) {
-	return r.client.Get(ctx, "url:"+shortCode).Result()
+func (r *RedisRepository) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func linkKey(shortCode string) string {
+	return "url:" + shortCode
+}
+
+// linkGenerationKey counts the writes to a code's cache entry, so fills of
+// what was read from Postgres before a write can tell they are stale.
+func linkGenerationKey(shortCode string) string {
+	return "urlgen:" + shortCode
+}
+
+// fillLink replaces the hash KEYS[1] with the field/value pairs from ARGV[3]
+// on, expiring in ARGV[2] milliseconds, if the generation KEYS[2] is still
+// ARGV[1].
+var fillLink = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '0') ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], unpack(ARGV, 3))
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// GetLink returns redis.Nil on a miss, including entries written by an older
+// schema version or in the pre-record string format.
+func (r *RedisRepository) GetLink(ctx context.Context, shortCode string) (*model.LinkRecord, error) {
+	fields, err := r.client.HGetAll(ctx, linkKey(shortCode)).Result()
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "WRONGTYPE") {
+			return nil, redis.Nil
+		}
+		return nil, err
+	}
+	if fields[fieldVersion] != linkRecordVersion {
+		return nil, redis.Nil
+	}
+	if fields[fieldNotFound] == "1" {
+		return nil, ErrCachedNotFound
+	}
+	return decodeLinkRecord(fields)
+}
+
+// SetLink caches a record just written to Postgres, making fills of anything
+// read before it stale.
+func (r *RedisRepository) SetLink(ctx context.Context, shortCode string, record *model.LinkRecord, expiry time.Duration) error {
+	return r.writeHash(ctx, shortCode, encodeLinkRecord(record), expiry)
+}
+
+// LinkGeneration returns the code's cache generation, to be read before the
+// link is loaded from Postgres and passed to FillLink or FillNotFound.
+func (r *RedisRepository) LinkGeneration(ctx context.Context, shortCode string) (int64, error) {
+	generation, err := r.client.Get(ctx, linkGenerationKey(shortCode)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return generation, err
+}
+
+// FillLink caches a record loaded from Postgres unless the code's entry was
+// written or deleted since generation was read, reporting whether it did.
+func (r *RedisRepository) FillLink(ctx context.Context, shortCode string, generation int64, record *model.LinkRecord, expiry time.Duration) (bool, error) {
+	return r.fillHash(ctx, shortCode, generation, encodeLinkRecord(record), expiry)
+}
+
+// FillNotFound negatively caches a code like FillLink. A later SetLink
+// overwrites it.
+func (r *RedisRepository) FillNotFound(ctx context.Context, shortCode string, generation int64, expiry time.Duration) (bool, error) {
+	return r.fillHash(ctx, shortCode, generation, map[string]interface{}{
+		fieldVersion:  linkRecordVersion,
+		fieldNotFound: "1",
+	}, expiry)
+}
+
+// DeleteLink drops the code's entry, making fills of anything read before it
+// stale.
+func (r *RedisRepository) DeleteLink(ctx context.Context, shortCode string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, linkKey(shortCode))
+		bumpGeneration(ctx, pipe, shortCode)
+		return nil
+	})
+	return err
+}
+
+// writeHash replaces the key atomically so stale fields from an older schema
+// (or an old string value) never survive.
+func (r *RedisRepository) writeHash(ctx context.Context, shortCode string, fields map[string]interface{}, expiry time.Duration) error {
+	key := linkKey(shortCode)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, fields)
+		pipe.PExpire(ctx, key, jitter(expiry))
+		bumpGeneration(ctx, pipe, shortCode)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisRepository) fillHash(ctx context.Context, shortCode string, generation int64, fields map[string]interface{}, expiry time.Duration) (bool, error) {
+	args := []interface{}{generation, jitter(expiry).Milliseconds()}
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+	filled, err := fillLink.Run(ctx, r.client, []string{linkKey(shortCode), linkGenerationKey(shortCode)}, args...).Int()
+	return filled == 1, err
+}
+
+func bumpGeneration(ctx context.Context, pipe redis.Pipeliner, shortCode string) {
+	pipe.Incr(ctx, linkGenerationKey(shortCode))
+	pipe.Expire(ctx, linkGenerationKey(shortCode), linkGenerationTTL)
+}
+
+func encodeLinkRecord(record *model.LinkRecord) map[string]interface{} {
+	schedule := ""
+	if len(record.Schedule) > 0 {
+		// Marshalling plain strings and times cannot fail
+		raw, _ := json.Marshal(record.Schedule)
+		schedule = string(raw)
+	}
+	return map[string]interface{}{
+		fieldVersion:      linkRecordVersion,
+		fieldID:           record.ID,
+		fieldWorkspace:    encodeOptionalInt(record.WorkspaceID),
+		fieldOriginalURL:  record.OriginalURL,
+		fieldStatus:       record.Status,
+		fieldExpiresAt:    encodeTime(record.ExpiresAt),
+		fieldRedirectType: record.RedirectType,
+		fieldReferrer:     record.ReferrerPolicy,
+		fieldForwardPath:  strconv.FormatBool(record.ForwardPath),
+		fieldActiveFrom:   encodeTime(record.ActiveFrom),
+		fieldActiveUntil:  encodeTime(record.ActiveUntil),
+		fieldInactiveURL:  record.InactiveURL,
+		fieldSchedule:     schedule,
+		fieldMaxUses:      record.MaxUses,
+		fieldSigned:       strconv.FormatBool(record.RequireSignature),
+	}
+}
+
+func encodeOptionalInt(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func encodeTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// decodeTime reports false for a malformed value; an empty one is a nil time.
+func decodeTime(raw string) (*time.Time, bool) {
+	if raw == "" {
+		return nil, true
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return nil, false
+	}
+	return &t, true
+}
+
+func decodeLinkRecord(fields map[string]string) (*model.LinkRecord, error) {
+	id, err := strconv.Atoi(fields[fieldID])
+	if err != nil {
+		return nil, redis.Nil
+	}
+	redirectType, err := strconv.Atoi(fields[fieldRedirectType])
+	if err != nil {
+		return nil, redis.Nil
+	}
+	maxUses, err := strconv.Atoi(fields[fieldMaxUses])
+	if err != nil {
+		return nil, redis.Nil
+	}
+	var workspaceID *int
+	if raw := fields[fieldWorkspace]; raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, redis.Nil
+		}
+		workspaceID = &id
+	}
+
+	record := &model.LinkRecord{
+		ID:             id,
+		WorkspaceID:    workspaceID,
+		OriginalURL:    fields[fieldOriginalURL],
+		Status:         fields[fieldStatus],
+		RedirectType:   redirectType,
+		ReferrerPolicy: fields[fieldReferrer],
+		ForwardPath:    fields[fieldForwardPath] == "true",
+		InactiveURL:    fields[fieldInactiveURL],
+		MaxUses:        maxUses,
+
+		RequireSignature: fields[fieldSigned] == "true",
+	}
+	times := map[string]**time.Time{
+		fieldExpiresAt:   &record.ExpiresAt,
+		fieldActiveFrom:  &record.ActiveFrom,
+		fieldActiveUntil: &record.ActiveUntil,
+	}
+	for field, target := range times {
+		t, ok := decodeTime(fields[field])
+		if !ok {
+			return nil, redis.Nil
+		}
+		*target = t
+	}
+	if raw := fields[fieldSchedule]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &record.Schedule); err != nil {
+			return nil, redis.Nil
+		}
+	}
+	return record, nil
 }
 
-func (r *RedisRepository) SetURL(ctx context.Context, shortCode, originalURL string, expiry time.Duration) error {
-	return r.client.Set(ctx, "url:"+shortCode, originalURL, expiry).Err()
+func jitter(ttl time.Duration) time.Duration {
+	spread := int64(float64(ttl) * ttlJitterFraction)
+	if spread <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Int64N(2*spread+1)-spread)
 }
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"smolink/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrRevisionNotFound is returned by RollbackURL for a revision the link never had.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// revisionSettings are the url columns a revision snapshots, in the same
+// order in both tables.
+const revisionSettings = "original_url, redirect_type, referrer_policy, forward_path, active_from, active_until, inactive_url, schedule, require_signature, max_uses, status"
+
+const revisionColumns = "revision, change, restored_from, changed_by, " + revisionSettings + ", created_at"
+
+func scanRevision(row pgx.Row) (*model.URLRevision, error) {
+	var rev model.URLRevision
+	if err := row.Scan(&rev.Revision, &rev.Change, &rev.RestoredFrom, &rev.ChangedBy, &rev.OriginalURL, &rev.RedirectType, &rev.ReferrerPolicy,
+		&rev.ForwardPath, &rev.ActiveFrom, &rev.ActiveUntil, &rev.InactiveURL, &rev.Schedule, &rev.RequireSignature, &rev.MaxUses, &rev.Status, &rev.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// insertRevision records the link's current settings as its next revision.
+// It runs in the transaction that changed the link, after the row lock on urls
+// is taken, so concurrent changes number their revisions one after another.
+func insertRevision(ctx context.Context, tx pgx.Tx, urlID int, change string, restoredFrom *int, actor string) error {
+	var changedBy *string
+	if actor != "" {
+		changedBy = &actor
+	}
+	_, err := tx.Exec(ctx, `INSERT INTO url_revisions (url_id, revision, change, restored_from, changed_by, `+revisionSettings+`)
+		SELECT id, (SELECT COALESCE(MAX(revision), 0) + 1 FROM url_revisions WHERE url_id = $1), $2, $3, $4, `+revisionSettings+`
+		FROM urls WHERE id = $1`, urlID, change, restoredFrom, changedBy)
+	return err
+}
+
+// ListRevisions returns a link's history, newest first.
+func (r *PostgresRepository) ListRevisions(ctx context.Context, urlID int) ([]model.URLRevision, error) {
+	rows, err := r.db.Query(ctx, "SELECT "+revisionColumns+" FROM url_revisions WHERE url_id = $1 ORDER BY revision DESC", urlID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []model.URLRevision{}
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *rev)
+	}
+	return revisions, rows.Err()
+}
+
+// RollbackURL restores the settings of one of a link's revisions and records
+// that as a new revision. It returns pgx.ErrNoRows for an unknown link and
+// ErrRevisionNotFound for an unknown revision.
+func (r *PostgresRepository) RollbackURL(ctx context.Context, scope WorkspaceScope, domainID *int, shortCode string, revision int, actor string) (*model.URL, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var urlID int
+	filter, args := inLink(scope, domainID, shortCode)
+	if err := tx.QueryRow(ctx, "SELECT id FROM urls WHERE "+filter+" FOR UPDATE", args...).Scan(&urlID); err != nil {
+		return nil, err
+	}
+
+	url, err := scanURL(tx.QueryRow(ctx, `UPDATE urls SET (`+revisionSettings+`) = (
+		SELECT `+revisionSettings+` FROM url_revisions WHERE url_id = $1 AND revision = $2)
+		WHERE id = $1 AND EXISTS (SELECT 1 FROM url_revisions WHERE url_id = $1 AND revision = $2)
+		RETURNING `+urlColumns, urlID, revision))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insertRevision(ctx, tx, urlID, model.RevisionRollback, &revision, actor); err != nil {
+		return nil, err
+	}
+	return url, tx.Commit(ctx)
+}
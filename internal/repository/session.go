@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Sessions and password reset tokens are keyed by the SHA-256 hash of the
+// token, so a Redis dump does not hand out working credentials.
+func sessionKey(tokenHash string) string {
+	return "session:" + tokenHash
+}
+
+// userSessionsKey indexes a user's sessions so they can all be revoked.
+func userSessionsKey(userID int) string {
+	return "user_sessions:" + strconv.Itoa(userID)
+}
+
+func passwordResetKey(tokenHash string) string {
+	return "pwreset:" + tokenHash
+}
+
+// CreateSession stores a session for the user that lasts for ttl.
+func (r *RedisRepository) CreateSession(ctx context.Context, tokenHash string, userID int, ttl time.Duration) error {
+	index := userSessionsKey(userID)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionKey(tokenHash), userID, ttl)
+		pipe.SAdd(ctx, index, tokenHash)
+		// Every session lasts ttl, so the newest keeps the index alive
+		// as long as any of them. Members whose session has expired are
+		// harmless: deleting a missing key is a no-op.
+		pipe.Expire(ctx, index, ttl)
+		return nil
+	})
+	return err
+}
+
+// GetSession returns the session's user ID, or redis.Nil once it has expired
+// or been revoked.
+func (r *RedisRepository) GetSession(ctx context.Context, tokenHash string) (int, error) {
+	return r.client.Get(ctx, sessionKey(tokenHash)).Int()
+}
+
+func (r *RedisRepository) DeleteSession(ctx context.Context, tokenHash string) error {
+	userID, err := r.GetSession(ctx, tokenHash)
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionKey(tokenHash))
+		pipe.SRem(ctx, userSessionsKey(userID), tokenHash)
+		return nil
+	})
+	return err
+}
+
+// DeleteUserSessions revokes every session the user has.
+func (r *RedisRepository) DeleteUserSessions(ctx context.Context, userID int) error {
+	index := userSessionsKey(userID)
+	hashes, err := r.client.SMembers(ctx, index).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{index}
+	for _, hash := range hashes {
+		keys = append(keys, sessionKey(hash))
+	}
+	return r.client.Del(ctx, keys...).Err()
+}
+
+func (r *RedisRepository) CreatePasswordReset(ctx context.Context, tokenHash string, userID int, ttl time.Duration) error {
+	return r.client.Set(ctx, passwordResetKey(tokenHash), userID, ttl).Err()
+}
+
+// ConsumePasswordReset returns the token's user ID and deletes it in the same
+// step, so a token works once. Unknown or expired tokens return redis.Nil.
+func (r *RedisRepository) ConsumePasswordReset(ctx context.Context, tokenHash string) (int, error) {
+	return r.client.GetDel(ctx, passwordResetKey(tokenHash)).Int()
+}
+
+func loginStateKey(state string) string {
+	return "oidc_state:" + state
+}
+
+// SaveLoginState keeps an in-flight single sign-on attempt until the identity
+// provider redirects back.
+func (r *RedisRepository) SaveLoginState(ctx context.Context, state string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, loginStateKey(state), value, ttl).Err()
+}
+
+// ConsumeLoginState returns and deletes the attempt, so each state is only
+// redeemed once. Unknown or expired states return redis.Nil.
+func (r *RedisRepository) ConsumeLoginState(ctx context.Context, state string) ([]byte, error) {
+	return r.client.GetDel(ctx, loginStateKey(state)).Bytes()
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"smolink/internal/cache"
+	"smolink/internal/model"
+)
+
+// invalidationChannel carries short codes whose local copies every instance
+// should drop.
+const invalidationChannel = "smolink:invalidate"
+
+// localEntry is either a link record or a negative entry (nil record).
+type localEntry struct {
+	record *model.LinkRecord
+}
+
+// TieredCache keeps a small in-process LRU in front of Redis. Local entries
+// live for at most localTTL, and changes are broadcast over Redis pub/sub so
+// other instances evict their copies without waiting for expiry.
+type TieredCache struct {
+	redis    *RedisRepository
+	local    *cache.LRU[string, localEntry]
+	localTTL time.Duration
+}
+
+func NewTieredCache(redis *RedisRepository, localSize int, localTTL time.Duration) *TieredCache {
+	return &TieredCache{
+		redis:    redis,
+		local:    cache.NewLRU[string, localEntry](localSize),
+		localTTL: localTTL,
+	}
+}
+
+func (c *TieredCache) GetLink(ctx context.Context, shortCode string) (*model.LinkRecord, error) {
+	if entry, ok := c.local.Get(shortCode); ok {
+		if entry.record == nil {
+			return nil, ErrCachedNotFound
+		}
+		return entry.record, nil
+	}
+
+	record, err := c.redis.GetLink(ctx, shortCode)
+	switch err {
+	case nil:
+		c.local.Set(shortCode, localEntry{record: record}, c.localTTL)
+	case ErrCachedNotFound:
+		c.local.Set(shortCode, localEntry{}, c.localTTL)
+	}
+	return record, err
+}
+
+// SetLink caches a record just written to Postgres in both tiers.
+func (c *TieredCache) SetLink(ctx context.Context, shortCode string, record *model.LinkRecord, expiry time.Duration) error {
+	c.local.Set(shortCode, localEntry{record: record}, min(expiry, c.localTTL))
+	return c.redis.SetLink(ctx, shortCode, record, expiry)
+}
+
+func (c *TieredCache) LinkGeneration(ctx context.Context, shortCode string) (int64, error) {
+	return c.redis.LinkGeneration(ctx, shortCode)
+}
+
+// FillLink caches a record loaded from Postgres in both tiers, unless the
+// code changed since generation was read.
+func (c *TieredCache) FillLink(ctx context.Context, shortCode string, generation int64, record *model.LinkRecord, expiry time.Duration) error {
+	filled, err := c.redis.FillLink(ctx, shortCode, generation, record, expiry)
+	if filled {
+		c.local.Set(shortCode, localEntry{record: record}, min(expiry, c.localTTL))
+	}
+	return err
+}
+
+// FillNotFound negatively caches a code like FillLink.
+func (c *TieredCache) FillNotFound(ctx context.Context, shortCode string, generation int64, expiry time.Duration) error {
+	filled, err := c.redis.FillNotFound(ctx, shortCode, generation, expiry)
+	if filled {
+		c.local.Set(shortCode, localEntry{}, min(expiry, c.localTTL))
+	}
+	return err
+}
+
+// DeleteLink removes the code from both tiers and tells other instances to
+// drop their local copies.
+func (c *TieredCache) DeleteLink(ctx context.Context, shortCode string) error {
+	c.local.Delete(shortCode)
+	if err := c.redis.DeleteLink(ctx, shortCode); err != nil {
+		return err
+	}
+	return c.Invalidate(ctx, shortCode)
+}
+
+// Invalidate only broadcasts an eviction, leaving the Redis entry in place.
+func (c *TieredCache) Invalidate(ctx context.Context, shortCode string) error {
+	c.local.Delete(shortCode)
+	return c.redis.client.Publish(ctx, invalidationChannel, shortCode).Err()
+}
+
+// PurgeLocal empties the in-process tier.
+func (c *TieredCache) PurgeLocal() {
+	c.local.Purge()
+}
+
+// Listen evicts local entries as invalidations arrive, until ctx is done.
+// go-redis resubscribes after reconnects; anything missed in between is
+// bounded by localTTL.
+func (c *TieredCache) Listen(ctx context.Context) {
+	sub := c.redis.client.Subscribe(ctx, invalidationChannel)
+	defer sub.Close()
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				log.Print("cache invalidation subscription closed")
+				return
+			}
+			c.local.Delete(msg.Payload)
+		}
+	}
+}
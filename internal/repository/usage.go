@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrUsageNotLoaded is returned by ReserveUsage while a counter has not been
+// loaded into Redis for the period yet.
+var ErrUsageNotLoaded = errors.New("usage counter not loaded")
+
+// ErrUsageExceeded is returned by ReserveUsage when the reservation would take
+// a counter over its limit.
+var ErrUsageExceeded = errors.New("usage limit exceeded")
+
+// dirtyUsageKey lists the counters changed since they were last saved to
+// Postgres.
+const dirtyUsageKey = "usage:dirty"
+
+// UsageKey names a workspace's counter of metric in period.
+type UsageKey struct {
+	WorkspaceID int
+	Period      string
+	Metric      string
+}
+
+func (k UsageKey) String() string {
+	return fmt.Sprintf("usage:%d:%s:%s", k.WorkspaceID, k.Period, k.Metric)
+}
+
+func parseUsageKey(raw string) (UsageKey, bool) {
+	parts := strings.Split(raw, ":")
+	if len(parts) != 4 || parts[0] != "usage" {
+		return UsageKey{}, false
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return UsageKey{}, false
+	}
+	return UsageKey{WorkspaceID: id, Period: parts[2], Metric: parts[3]}, true
+}
+
+// reserveUsage adds ARGV[1] to the counter KEYS[1] unless that would exceed
+// the limit ARGV[2], 0 meaning none, and marks it dirty in KEYS[2]. It
+// returns -2 when the counter is missing so the caller can load it first,
+// and -1 when the limit would be exceeded.
+var reserveUsage = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -2
+end
+local used = redis.call('INCRBY', KEYS[1], ARGV[1])
+local limit = tonumber(ARGV[2])
+if limit > 0 and used > limit then
+	redis.call('DECRBY', KEYS[1], ARGV[1])
+	return -1
+end
+redis.call('SADD', KEYS[2], KEYS[1])
+return used
+`)
+
+// ReserveUsage atomically takes n from a counter's remaining limit, so
+// concurrent requests on any instance cannot overshoot it together.
+func (r *RedisRepository) ReserveUsage(ctx context.Context, key UsageKey, n, limit int64) (int64, error) {
+	used, err := reserveUsage.Run(ctx, r.client, []string{key.String(), dirtyUsageKey}, n, limit).Int64()
+	if err != nil {
+		return 0, err
+	}
+	switch used {
+	case -2:
+		return 0, ErrUsageNotLoaded
+	case -1:
+		return 0, ErrUsageExceeded
+	}
+	return used, nil
+}
+
+// releaseUsage takes up to ARGV[1] off the counter KEYS[1], never below 0,
+// and marks it dirty in KEYS[2] if it changed. Missing counters are left
+// alone: the uses were never counted, or the counter is reloaded from Postgres.
+var releaseUsage = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local released = math.min(tonumber(redis.call('GET', KEYS[1])), tonumber(ARGV[1]))
+if released <= 0 then
+	return 0
+end
+redis.call('DECRBY', KEYS[1], released)
+redis.call('SADD', KEYS[2], KEYS[1])
+return released
+`)
+
+// ReleaseUsage gives back n reserved by a request that then failed.
+func (r *RedisRepository) ReleaseUsage(ctx context.Context, key UsageKey, n int64) error {
+	return releaseUsage.Run(ctx, r.client, []string{key.String(), dirtyUsageKey}, n).Err()
+}
+
+// LoadUsage starts a counter at used unless another instance already did.
+// It expires after ttl, once its period is long over.
+func (r *RedisRepository) LoadUsage(ctx context.Context, key UsageKey, used int64, ttl time.Duration) error {
+	return r.client.SetNX(ctx, key.String(), used, ttl).Err()
+}
+
+// GetUsage returns the counters that are loaded, keyed like keys.
+func (r *RedisRepository) GetUsage(ctx context.Context, keys []UsageKey) (map[UsageKey]int64, error) {
+	raw := make([]string, len(keys))
+	for i, key := range keys {
+		raw[i] = key.String()
+	}
+	values, err := r.client.MGet(ctx, raw...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[UsageKey]int64, len(keys))
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if used, err := strconv.ParseInt(s, 10, 64); err == nil {
+			usage[keys[i]] = used
+		}
+	}
+	return usage, nil
+}
+
+// TakeDirtyUsage returns the counters changed since the last call. Counters
+// that change while it runs are marked dirty again and show up next time.
+func (r *RedisRepository) TakeDirtyUsage(ctx context.Context) (map[UsageKey]int64, error) {
+	members, err := r.client.SMembers(ctx, dirtyUsageKey).Result()
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+	if err := r.client.SRem(ctx, dirtyUsageKey, members).Err(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]UsageKey, 0, len(members))
+	for _, member := range members {
+		if key, ok := parseUsageKey(member); ok {
+			keys = append(keys, key)
+		}
+	}
+	return r.GetUsage(ctx, keys)
+}
+
+// MarkUsageDirty queues counters to be saved again, e.g. after a failed save.
+func (r *RedisRepository) MarkUsageDirty(ctx context.Context, keys ...UsageKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(keys))
+	for i, key := range keys {
+		members[i] = key.String()
+	}
+	return r.client.SAdd(ctx, dirtyUsageKey, members...).Err()
+}
+
+// SaveUsage records a counter's value in Postgres; period is its first day.
+// It returns pgx.ErrNoRows when the workspace no longer exists.
+func (r *PostgresRepository) SaveUsage(ctx context.Context, workspaceID int, period time.Time, metric string, used int64) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO workspace_usage (workspace_id, period, metric, used) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (workspace_id, period, metric) DO UPDATE SET used = EXCLUDED.used, updated_at = now()`,
+		workspaceID, period, metric, used)
+	if isForeignKeyViolation(err) {
+		return pgx.ErrNoRows
+	}
+	return err
+}
+
+// GetSavedUsage returns a workspace's saved counters for period by metric.
+func (r *PostgresRepository) GetSavedUsage(ctx context.Context, workspaceID int, period time.Time) (map[string]int64, error) {
+	rows, err := r.db.Query(ctx, "SELECT metric, used FROM workspace_usage WHERE workspace_id = $1 AND period = $2", workspaceID, period)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make(map[string]int64)
+	for rows.Next() {
+		var metric string
+		var used int64
+		if err := rows.Scan(&metric, &used); err != nil {
+			return nil, err
+		}
+		usage[metric] = used
+	}
+	return usage, rows.Err()
+}
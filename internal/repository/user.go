@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"smolink/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const userColumns = "id, email, name, password_hash, created_at"
+
+func scanUser(row pgx.Row) (*model.User, error) {
+	var u model.User
+	if err := row.Scan(&u.ID, &u.Email, &u.Name, &u.PasswordHash, &u.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// CreateUser returns ErrDuplicateEmail when the email is registered.
+func (r *PostgresRepository) CreateUser(ctx context.Context, user *model.User) error {
+	err := r.db.QueryRow(ctx,
+		"INSERT INTO users (email, name, password_hash) VALUES ($1, $2, $3) RETURNING id, created_at",
+		user.Email, user.Name, user.PasswordHash,
+	).Scan(&user.ID, &user.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicateEmail
+	}
+	return err
+}
+
+func (r *PostgresRepository) GetUser(ctx context.Context, id int) (*model.User, error) {
+	return scanUser(r.db.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id))
+}
+
+func (r *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return scanUser(r.db.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1", email))
+}
+
+func (r *PostgresRepository) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	tag, err := r.db.Exec(ctx, "UPDATE users SET password_hash = $2 WHERE id = $1", userID, passwordHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// SetMembership adds the user to the workspace or changes their role there. It
+// returns pgx.ErrNoRows when the user or workspace does not exist.
+func (r *PostgresRepository) SetMembership(ctx context.Context, membership *model.Membership) error {
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO memberships (user_id, workspace_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, workspace_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING created_at`,
+		membership.UserID, membership.WorkspaceID, membership.Role,
+	).Scan(&membership.CreatedAt)
+	if isForeignKeyViolation(err) {
+		return pgx.ErrNoRows
+	}
+	return err
+}
+
+func (r *PostgresRepository) GetMembership(ctx context.Context, userID, workspaceID int) (*model.Membership, error) {
+	var m model.Membership
+	err := r.db.QueryRow(ctx,
+		"SELECT user_id, workspace_id, role, created_at FROM memberships WHERE user_id = $1 AND workspace_id = $2",
+		userID, workspaceID,
+	).Scan(&m.UserID, &m.WorkspaceID, &m.Role, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListMemberships returns the user's memberships, oldest workspace first.
+func (r *PostgresRepository) ListMemberships(ctx context.Context, userID int) ([]model.Membership, error) {
+	return r.queryMemberships(ctx, `
+		SELECT m.user_id, m.workspace_id, m.role, u.email, m.created_at
+		FROM memberships m JOIN users u ON u.id = m.user_id
+		WHERE m.user_id = $1 ORDER BY m.workspace_id`, userID)
+}
+
+func (r *PostgresRepository) ListWorkspaceMembers(ctx context.Context, workspaceID int) ([]model.Membership, error) {
+	return r.queryMemberships(ctx, `
+		SELECT m.user_id, m.workspace_id, m.role, u.email, m.created_at
+		FROM memberships m JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = $1 ORDER BY m.user_id`, workspaceID)
+}
+
+func (r *PostgresRepository) queryMemberships(ctx context.Context, query string, args ...any) ([]model.Membership, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []model.Membership{}
+	for rows.Next() {
+		var m model.Membership
+		if err := rows.Scan(&m.UserID, &m.WorkspaceID, &m.Role, &m.Email, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, rows.Err()
+}
+
+func (r *PostgresRepository) DeleteMembership(ctx context.Context, userID, workspaceID int) error {
+	tag, err := r.db.Exec(ctx, "DELETE FROM memberships WHERE user_id = $1 AND workspace_id = $2", userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// GetUserByIdentity finds the user linked to an identity provider's subject.
+func (r *PostgresRepository) GetUserByIdentity(ctx context.Context, issuer, subject string) (*model.User, error) {
+	return scanUser(r.db.QueryRow(ctx, `
+		SELECT u.id, u.email, u.name, u.password_hash, u.created_at
+		FROM users u JOIN user_identities i ON i.user_id = u.id
+		WHERE i.issuer = $1 AND i.subject = $2`, issuer, subject))
+}
+
+func (r *PostgresRepository) LinkIdentity(ctx context.Context, userID int, issuer, subject string) error {
+	_, err := r.db.Exec(ctx,
+		"INSERT INTO user_identities (issuer, subject, user_id) VALUES ($1, $2, $3) ON CONFLICT (issuer, subject) DO NOTHING",
+		issuer, subject, userID)
+	return err
+}
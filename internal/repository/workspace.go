@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"smolink/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const workspaceColumns = "id, name, code_length, redirect_type, quota_links_created, quota_api_requests, quota_clicks_recorded, created_at"
+
+// WorkspaceScope limits queries to the rows of one workspace, a nil ID
+// selecting rows that belong to no workspace. All lifts the limit for the
+// admin token and for redirects, which serve every workspace's links.
+type WorkspaceScope struct {
+	All bool
+	ID  *int
+}
+
+// AllWorkspaces is the scope of queries that may touch any workspace's rows.
+var AllWorkspaces = WorkspaceScope{All: true}
+
+// inWorkspace returns a WHERE clause selecting a scope's rows and appends its
+// parameter to args, like inNamespace.
+func inWorkspace(scope WorkspaceScope, args ...any) (string, []any) {
+	switch {
+	case scope.All:
+		return "TRUE", args
+	case scope.ID == nil:
+		return "workspace_id IS NULL", args
+	}
+	args = append(args, *scope.ID)
+	return fmt.Sprintf("workspace_id = $%d", len(args)), args
+}
+
+func scanWorkspace(row pgx.Row) (*model.Workspace, error) {
+	var w model.Workspace
+	if err := row.Scan(&w.ID, &w.Name, &w.CodeLength, &w.RedirectType,
+		&w.Quotas.LinksCreated, &w.Quotas.APIRequests, &w.Quotas.ClicksRecorded, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r *PostgresRepository) CreateWorkspace(ctx context.Context, workspace *model.Workspace) error {
+	return r.db.QueryRow(ctx,
+		"INSERT INTO workspaces (name, code_length, redirect_type) VALUES ($1, $2, $3) RETURNING id, created_at",
+		workspace.Name, workspace.CodeLength, workspace.RedirectType,
+	).Scan(&workspace.ID, &workspace.CreatedAt)
+}
+
+func (r *PostgresRepository) GetWorkspace(ctx context.Context, id int) (*model.Workspace, error) {
+	return scanWorkspace(r.db.QueryRow(ctx, "SELECT "+workspaceColumns+" FROM workspaces WHERE id = $1", id))
+}
+
+func (r *PostgresRepository) ListWorkspaces(ctx context.Context) ([]model.Workspace, error) {
+	rows, err := r.db.Query(ctx, "SELECT "+workspaceColumns+" FROM workspaces ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []model.Workspace{}
+	for rows.Next() {
+		workspace, err := scanWorkspace(rows)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, *workspace)
+	}
+	return workspaces, rows.Err()
+}
+
+// UpdateWorkspace applies update, a zero setting clearing it.
+func (r *PostgresRepository) UpdateWorkspace(ctx context.Context, id int, update model.WorkspaceUpdate) (*model.Workspace, error) {
+	return scanWorkspace(r.db.QueryRow(ctx, `UPDATE workspaces SET
+		name = COALESCE($2, name),
+		code_length = CASE WHEN $3::int IS NULL THEN code_length ELSE NULLIF($3, 0) END,
+		redirect_type = CASE WHEN $4::int IS NULL THEN redirect_type ELSE NULLIF($4, 0) END
+		WHERE id = $1 RETURNING `+workspaceColumns,
+		id, update.Name, update.CodeLength, update.RedirectType,
+	))
+}
+
+// SetWorkspaceQuotas replaces a workspace's quotas, nil ones falling back to
+// the instance defaults.
+func (r *PostgresRepository) SetWorkspaceQuotas(ctx context.Context, id int, quotas model.Quotas) (*model.Workspace, error) {
+	return scanWorkspace(r.db.QueryRow(ctx,
+		"UPDATE workspaces SET quota_links_created = $2, quota_api_requests = $3, quota_clicks_recorded = $4 WHERE id = $1 RETURNING "+workspaceColumns,
+		id, quotas.LinksCreated, quotas.APIRequests, quotas.ClicksRecorded,
+	))
+}
@@ -1,37 +1,169 @@
 package routes
 
 import (
-	"net/http"
+	"strings"
+
+	"smolink/internal/auth"
 	"smolink/internal/controller"
+	"smolink/internal/model"
+	"smolink/internal/service"
+	"smolink/pkg/metrics"
 	"smolink/pkg/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 const (
-	APIPrefix       = "/api/v1"
-	ShortenURLPath  = "/links"
-	HealthCheckPath = "/health"
+	APIPrefix        = "/api/v1"
+	RedirectPath     = "/:code"
+	ForwardPath      = RedirectPath + "/*rest"
+	ShortenURLPath   = "/links"
+	HealthCheckPath  = "/health"
+	LivenessPath     = HealthCheckPath + "/live"
+	ReadinessPath    = HealthCheckPath + "/ready"
+	AdminPrefix      = "/admin"
+	APIKeysPath      = "/api-keys"
+	CodesPath        = "/codes"
+	AvailabilityPath = "/availability"
+	WorkspacesPath   = "/workspaces"
+	DomainsPath      = "/domains"
+	MetricsPath      = "/metrics"
+	AuthPath         = "/auth"
+	UsersPath        = "/users"
+	MembersPath      = "/members"
+	UsagePath        = "/usage"
+	QuotasPath       = "/quotas"
 )
 
-func SetupUrlRoutes(router *gin.Engine, urlController *controller.URLController) {
+func SetupUrlRoutes(router *gin.Engine, urlController *controller.URLController, authenticator *auth.Authenticator, usageService *service.UsageService) {
+	meter := auth.MeterRequests(usageService)
+
+	// Static routes take precedence, and ReservedWords keeps custom codes
+	// from shadowing them.
+	router.GET("/", urlController.Home)
+	router.GET(RedirectPath, urlController.ResolveURL)
+	router.HEAD(RedirectPath, urlController.ResolveURL)
+	router.GET(ForwardPath, urlController.ResolveURL)
+	router.HEAD(ForwardPath, urlController.ResolveURL)
+
 	urlGroup := router.Group(APIPrefix)
 	{
-		urlGroup.POST(ShortenURLPath, urlController.ShortenURL)
+		// Anonymous callers may shorten into the default namespace; custom
+		// domains need a key or session for the owning workspace.
+		urlGroup.POST(ShortenURLPath, authenticator.OptionalAuth(), auth.RequireRoleIfAuthenticated(model.RoleEditor), meter, urlController.ShortenURL)
 		urlGroup.GET(ShortenURLPath+"/:code", urlController.ResolveURL)
+		urlGroup.HEAD(ShortenURLPath+"/:code", urlController.ResolveURL)
+		urlGroup.GET(CodesPath+"/:code"+AvailabilityPath, authenticator.OptionalAuth(), meter, urlController.CheckAvailability)
+	}
+}
+
+func SetupHealthRoutes(router *gin.Engine, healthController *controller.HealthController) {
+	router.GET(HealthCheckPath, healthController.Ready)
+	router.GET(LivenessPath, healthController.Live)
+	router.GET(ReadinessPath, healthController.Ready)
+}
+
+func SetupAuthRoutes(router *gin.Engine, userController *controller.UserController, authenticator *auth.Authenticator) {
+	authGroup := router.Group(APIPrefix + AuthPath)
+	{
+		authGroup.POST("/login", userController.Login)
+		authGroup.POST("/logout", authenticator.RequireAuth(), userController.Logout)
+		authGroup.GET("/me", authenticator.RequireAuth(), userController.Me)
+		authGroup.POST("/password/forgot", userController.ForgotPassword)
+		authGroup.POST("/password/reset", userController.ResetPassword)
+		authGroup.GET("/oidc/login", userController.SSOLogin)
+		authGroup.GET("/oidc/callback", userController.SSOCallback)
+	}
+}
+
+// SetupUsageRoutes reports usage without metering it, so callers can still
+// see why they are over quota.
+func SetupUsageRoutes(router *gin.Engine, usageController *controller.UsageController, authenticator *auth.Authenticator) {
+	router.GET(APIPrefix+UsagePath, authenticator.RequireAuth(), auth.RequireRole(model.RoleViewer), usageController.GetUsage)
+}
+
+// SetupAdminRoutes gates every route on the caller's role in their workspace:
+// viewers read, editors change links, admins manage keys, domains and members.
+func SetupAdminRoutes(router *gin.Engine, adminController *controller.AdminController, domainController *controller.DomainController, userController *controller.UserController, usageController *controller.UsageController, authenticator *auth.Authenticator, usageService *service.UsageService) {
+	viewer := auth.RequireRole(model.RoleViewer)
+	editor := auth.RequireRole(model.RoleEditor)
+	admin := auth.RequireRole(model.RoleAdmin)
+
+	adminGroup := router.Group(APIPrefix+AdminPrefix, authenticator.RequireAuth(), auth.MeterRequests(usageService))
+	{
+		adminGroup.GET(ShortenURLPath, viewer, adminController.ListLinks)
+		adminGroup.GET(ShortenURLPath+"/:code", viewer, adminController.GetLink)
+		adminGroup.PATCH(ShortenURLPath+"/:code", editor, adminController.UpdateLink)
+		adminGroup.DELETE(ShortenURLPath+"/:code", editor, adminController.DeleteLink)
+		adminGroup.POST(ShortenURLPath+"/:code/disable", editor, adminController.DisableLink)
+		adminGroup.POST(ShortenURLPath+"/:code/enable", editor, adminController.EnableLink)
+		adminGroup.GET(ShortenURLPath+"/:code/stats", viewer, adminController.GetLinkStats)
+		adminGroup.GET(ShortenURLPath+"/:code/history", viewer, adminController.GetLinkHistory)
+		adminGroup.POST(ShortenURLPath+"/:code/sign", editor, adminController.SignLink)
+		adminGroup.POST(ShortenURLPath+"/:code/rollback/:revision", editor, adminController.RollbackLink)
+		adminGroup.GET(CodesPath, viewer, adminController.GetCodeStats)
+
+		adminGroup.GET(APIKeysPath, admin, adminController.ListAPIKeys)
+		adminGroup.POST(APIKeysPath, admin, adminController.CreateAPIKey)
+		adminGroup.DELETE(APIKeysPath+"/:id", admin, adminController.RevokeAPIKey)
+
+		adminGroup.GET(WorkspacesPath, auth.RequireAdmin(), domainController.ListWorkspaces)
+		adminGroup.POST(WorkspacesPath, auth.RequireAdmin(), domainController.CreateWorkspace)
+		adminGroup.GET(WorkspacesPath+"/:id", viewer, domainController.GetWorkspace)
+		adminGroup.PATCH(WorkspacesPath+"/:id", admin, domainController.UpdateWorkspace)
+		adminGroup.GET(WorkspacesPath+"/:id"+MembersPath, admin, userController.ListMembers)
+		adminGroup.PUT(WorkspacesPath+"/:id"+MembersPath+"/:userId", admin, userController.SetMember)
+		adminGroup.DELETE(WorkspacesPath+"/:id"+MembersPath+"/:userId", admin, userController.RemoveMember)
+		adminGroup.PUT(WorkspacesPath+"/:id"+QuotasPath, auth.RequireAdmin(), usageController.SetQuotas)
+
+		adminGroup.POST(UsersPath, auth.RequireAdmin(), userController.CreateUser)
+
+		adminGroup.GET(DomainsPath, viewer, domainController.ListDomains)
+		adminGroup.POST(DomainsPath, admin, domainController.CreateDomain)
+		adminGroup.GET(DomainsPath+"/:id", viewer, domainController.GetDomain)
+		adminGroup.PATCH(DomainsPath+"/:id", admin, domainController.UpdateDomain)
+		adminGroup.DELETE(DomainsPath+"/:id", admin, domainController.DeleteDomain)
+		adminGroup.POST(DomainsPath+"/:id/verify", admin, domainController.VerifyDomain)
 	}
 }
 
-func SetupRoutes(router *gin.Engine, urlController *controller.URLController) {
+func SetupRoutes(
+	router *gin.Engine,
+	urlController *controller.URLController,
+	healthController *controller.HealthController,
+	adminController *controller.AdminController,
+	domainController *controller.DomainController,
+	userController *controller.UserController,
+	usageController *controller.UsageController,
+	authenticator *auth.Authenticator,
+	usageService *service.UsageService,
+	metricsRegistry *metrics.Registry,
+) {
 	router.Use(middleware.Logger())
 	router.Use(middleware.ErrorHandler())
 	router.Use(middleware.CORS())
 
-	router.GET(HealthCheckPath, func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "healthy",
-		})
-	})
+	SetupHealthRoutes(router, healthController)
+	router.GET(MetricsPath, metricsRegistry.Handler())
+	SetupUrlRoutes(router, urlController, authenticator, usageService)
+	SetupAuthRoutes(router, userController, authenticator)
+	SetupUsageRoutes(router, usageController, authenticator)
+	SetupAdminRoutes(router, adminController, domainController, userController, usageController, authenticator, usageService)
+}
 
-	SetupUrlRoutes(router, urlController)
+// ReservedWords returns every static path segment registered on the router,
+// so custom short codes can never shadow an existing route.
+func ReservedWords(router *gin.Engine) []string {
+	var words []string
+	seen := make(map[string]bool)
+	for _, route := range router.Routes() {
+		for _, segment := range strings.Split(route.Path, "/") {
+			if segment == "" || strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") || seen[segment] {
+				continue
+			}
+			seen[segment] = true
+			words = append(words, segment)
+		}
+	}
+	return words
 }
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/repository"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const apiKeyPrefix = "smk_"
+
+type APIKeyService struct {
+	repo *repository.PostgresRepository
+}
+
+func NewAPIKeyService(repo *repository.PostgresRepository) *APIKeyService {
+	return &APIKeyService{repo: repo}
+}
+
+// CreateKey generates a new key, optionally bound to a workspace. The plaintext
+// token is only returned here; the database keeps its SHA-256 hash.
+func (s *APIKeyService) CreateKey(ctx context.Context, name string, workspaceID *int) (*model.APIKey, string, error) {
+	token, err := newToken(apiKeyPrefix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &model.APIKey{
+		WorkspaceID: workspaceID,
+		Name:        name,
+		Prefix:      token[:len(apiKeyPrefix)+6],
+		KeyHash:     hashToken(token),
+	}
+	if err := s.repo.CreateAPIKey(ctx, key); err != nil {
+		return nil, "", fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return key, token, nil
+}
+
+// ListKeys lists the keys of the caller's workspace, or every key for admins.
+func (s *APIKeyService) ListKeys(ctx context.Context, access Access) ([]model.APIKey, error) {
+	keys, err := s.repo.ListAPIKeys(ctx, access.Scope())
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return keys, nil
+}
+
+func (s *APIKeyService) RevokeKey(ctx context.Context, access Access, id int) error {
+	err := s.repo.RevokeAPIKey(ctx, access.Scope(), id)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return nil
+}
+
+// Authenticate resolves a plaintext token to an active key.
+func (s *APIKeyService) Authenticate(ctx context.Context, token string) (*model.APIKey, error) {
+	key, err := s.repo.GetActiveAPIKeyByHash(ctx, hashToken(token))
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.ErrUnauthorized
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+
+	if err := s.repo.TouchAPIKey(ctx, key.ID); err != nil {
+		log.Printf("failed to update API key usage: %v", err)
+	}
+	return key, nil
+}
+
+// newToken returns a random bearer token that starts with prefix.
+func newToken(prefix string) (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken is how API keys, sessions and reset tokens are stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
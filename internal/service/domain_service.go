@@ -0,0 +1,394 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/repository"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	hostsLoadKey = "hosts"
+
+	// hostRetryDelay is how long a failed reload of the verified domains
+	// waits before the next attempt.
+	hostRetryDelay = 5 * time.Second
+)
+
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]{0,61}[a-z0-9]$`)
+
+// TXTResolver looks up DNS TXT records. *net.Resolver satisfies it; tests use
+// a stub so verification does not depend on real DNS.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Access describes whose resources a caller may use: admins may use every
+// workspace's, other callers only those of WorkspaceID. Role is the caller's role
+// in that workspace. Actor names the caller in link history and is empty for
+// anonymous callers.
+type Access struct {
+	Admin       bool
+	WorkspaceID *int
+	Role        string
+	Actor       string
+}
+
+func (a Access) CanUse(workspaceID int) bool {
+	return a.Admin || (a.WorkspaceID != nil && *a.WorkspaceID == workspaceID)
+}
+
+// Scope limits repository queries to what the caller may see: everything for
+// admins, otherwise their workspace, or the rows outside any workspace for
+// callers who have none.
+func (a Access) Scope() repository.WorkspaceScope {
+	if a.Admin {
+		return repository.AllWorkspaces
+	}
+	return repository.WorkspaceScope{ID: a.WorkspaceID}
+}
+
+// CreateDomainRequest registers a hostname. WorkspaceID is only honoured for
+// admins; everyone else registers domains for their own workspace.
+type CreateDomainRequest struct {
+	WorkspaceID     *int
+	Hostname        string
+	RootRedirectURL *string
+	NotFoundURL     *string
+}
+
+type DomainService struct {
+	repo     *repository.PostgresRepository
+	resolver TXTResolver
+
+	// hosts maps the hostnames of verified domains to them, reloaded as a
+	// whole once hostTTL passes so Host headers that match no domain never
+	// reach Postgres. Local changes bump hostsVersion, and lookups wait for
+	// a reload that includes them; other instances pick changes up with the
+	// next reload.
+	hostsMu       sync.Mutex
+	hosts         map[string]*model.Domain
+	hostsReloadAt time.Time
+	hostsVersion  int
+	hostsLoaded   int
+	hostLoads     singleflight.Group
+	hostTTL       time.Duration
+}
+
+func NewDomainService(repo *repository.PostgresRepository, resolver TXTResolver, hostTTL time.Duration) *DomainService {
+	return &DomainService{
+		repo:     repo,
+		resolver: resolver,
+		hostTTL:  hostTTL,
+	}
+}
+
+// UseResolver replaces the TXT resolver, e.g. with a stub in tests. It must
+// not be called while requests are being served.
+func (s *DomainService) UseResolver(resolver TXTResolver) {
+	s.resolver = resolver
+}
+
+// ForgetHosts makes the next Host header lookup reload the verified domains.
+func (s *DomainService) ForgetHosts() {
+	s.hostsMu.Lock()
+	s.hostsVersion++
+	s.hostsMu.Unlock()
+	// A reload already under way may have read the domains before the change
+	s.hostLoads.Forget(hostsLoadKey)
+}
+
+func (s *DomainService) CreateWorkspace(ctx context.Context, name string) (*model.Workspace, error) {
+	workspace := &model.Workspace{Name: name}
+	if err := s.repo.CreateWorkspace(ctx, workspace); err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	return workspace, nil
+}
+
+func (s *DomainService) ListWorkspaces(ctx context.Context) ([]model.Workspace, error) {
+	workspaces, err := s.repo.ListWorkspaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	return workspaces, nil
+}
+
+// CheckWorkspace makes sure a workspace exists before something is assigned to it.
+func (s *DomainService) CheckWorkspace(ctx context.Context, id int) error {
+	_, err := s.repo.GetWorkspace(ctx, id)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	return nil
+}
+
+// GetWorkspace hides other workspaces behind ErrWorkspaceNotFound.
+func (s *DomainService) GetWorkspace(ctx context.Context, access Access, id int) (*model.Workspace, error) {
+	if !access.CanUse(id) {
+		return nil, errors.ErrWorkspaceNotFound
+	}
+	workspace, err := s.repo.GetWorkspace(ctx, id)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	return workspace, nil
+}
+
+// UpdateWorkspace renames a workspace or changes the defaults of links
+// created in it.
+func (s *DomainService) UpdateWorkspace(ctx context.Context, access Access, id int, update model.WorkspaceUpdate) (*model.Workspace, error) {
+	if !access.CanUse(id) {
+		return nil, errors.ErrWorkspaceNotFound
+	}
+	if update.CodeLength != nil && *update.CodeLength != 0 &&
+		(*update.CodeLength < model.MinWorkspaceCodeLength || *update.CodeLength > model.MaxWorkspaceCodeLength) {
+		return nil, errors.ErrInvalidCodeLength
+	}
+	if update.RedirectType != nil && *update.RedirectType != 0 && !model.ValidRedirectType(*update.RedirectType) {
+		return nil, errors.ErrInvalidRedirect
+	}
+
+	workspace, err := s.repo.UpdateWorkspace(ctx, id, update)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	return workspace, nil
+}
+
+func (s *DomainService) CreateDomain(ctx context.Context, access Access, req CreateDomainRequest) (*model.Domain, error) {
+	workspaceID := access.WorkspaceID
+	if access.Admin {
+		workspaceID = req.WorkspaceID
+	}
+	if workspaceID == nil {
+		return nil, errors.ErrForbidden.WithDetails("domains belong to a workspace")
+	}
+	if err := s.CheckWorkspace(ctx, *workspaceID); err != nil {
+		return nil, err
+	}
+
+	hostname := normalizeHost(req.Hostname)
+	if len(hostname) > 253 || !hostnamePattern.MatchString(hostname) {
+		return nil, errors.ErrInvalidDomain
+	}
+	if err := validatePageURLs(req.RootRedirectURL, req.NotFoundURL); err != nil {
+		return nil, err
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+
+	domain := &model.Domain{
+		WorkspaceID:       *workspaceID,
+		Hostname:          hostname,
+		VerificationToken: "smolink-verification=" + hex.EncodeToString(token),
+		RootRedirectURL:   req.RootRedirectURL,
+		NotFoundURL:       req.NotFoundURL,
+	}
+	err := s.repo.CreateDomain(ctx, domain)
+	if stderrors.Is(err, repository.ErrDuplicateHostname) {
+		return nil, errors.ErrDomainTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	return domain, nil
+}
+
+func (s *DomainService) ListDomains(ctx context.Context, access Access) ([]model.Domain, error) {
+	domains, err := s.repo.ListDomains(ctx, access.Scope())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	return domains, nil
+}
+
+// GetDomain hides domains of other workspaces behind ErrDomainNotFound.
+func (s *DomainService) GetDomain(ctx context.Context, access Access, id int) (*model.Domain, error) {
+	domain, err := s.repo.GetDomain(ctx, access.Scope(), id)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.ErrDomainNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	return domain, nil
+}
+
+func (s *DomainService) UpdatePages(ctx context.Context, access Access, id int, rootRedirectURL, notFoundURL *string) (*model.Domain, error) {
+	if _, err := s.GetDomain(ctx, access, id); err != nil {
+		return nil, err
+	}
+	if err := validatePageURLs(rootRedirectURL, notFoundURL); err != nil {
+		return nil, err
+	}
+
+	domain, err := s.repo.UpdateDomainPages(ctx, id, rootRedirectURL, notFoundURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	s.ForgetHosts()
+	return domain, nil
+}
+
+// VerifyDomain looks for the domain's verification token in the TXT records
+// of its verification record name.
+func (s *DomainService) VerifyDomain(ctx context.Context, access Access, id int) (*model.Domain, error) {
+	domain, err := s.GetDomain(ctx, access, id)
+	if err != nil || domain.Verified() {
+		return domain, err
+	}
+
+	records, err := s.resolver.LookupTXT(ctx, domain.VerificationRecord())
+	if err != nil {
+		log.Printf("TXT lookup for %s failed: %v", domain.VerificationRecord(), err)
+	}
+	found := false
+	for _, record := range records {
+		if strings.TrimSpace(record) == domain.VerificationToken {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.ErrDomainUnverifiable.WithDetails(
+			fmt.Sprintf("add a TXT record %s with value %s", domain.VerificationRecord(), domain.VerificationToken))
+	}
+
+	domain, err = s.repo.MarkDomainVerified(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	s.ForgetHosts()
+	return domain, nil
+}
+
+func (s *DomainService) DeleteDomain(ctx context.Context, access Access, id int) error {
+	if _, err := s.GetDomain(ctx, access, id); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteDomain(ctx, id); err != nil {
+		return fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	s.ForgetHosts()
+	return nil
+}
+
+// ForHost maps a request's Host header to a verified domain. Unknown and
+// unverified hosts are served from the default namespace, for which it
+// returns nil. While the domains cannot be reloaded it keeps using the ones
+// it has, retrying after hostRetryDelay; it only fails, with ErrUnavailable,
+// if they never loaded.
+func (s *DomainService) ForHost(ctx context.Context, host string) (*model.Domain, error) {
+	s.hostsMu.Lock()
+	loaded, due, changed := s.hosts != nil, !time.Now().Before(s.hostsReloadAt), s.hostsLoaded != s.hostsVersion
+	s.hostsMu.Unlock()
+
+	if due || changed {
+		reload := s.hostLoads.DoChan(hostsLoadKey, func() (interface{}, error) {
+			return nil, s.reloadHosts(context.WithoutCancel(ctx))
+		})
+		// Expiry alone reloads in the background; without domains, or after
+		// a local change, the lookup needs the reload's result
+		if !loaded || changed {
+			if result := <-reload; result.Err != nil && !loaded {
+				return nil, result.Err
+			}
+		}
+	}
+
+	s.hostsMu.Lock()
+	defer s.hostsMu.Unlock()
+	return s.hosts[normalizeHost(host)], nil
+}
+
+func (s *DomainService) reloadHosts(ctx context.Context) error {
+	s.hostsMu.Lock()
+	version := s.hostsVersion
+	s.hostsMu.Unlock()
+
+	domains, err := s.repo.ListVerifiedDomains(ctx)
+
+	s.hostsMu.Lock()
+	defer s.hostsMu.Unlock()
+	if version < s.hostsLoaded {
+		// A reload started after this one already finished
+		return nil
+	}
+	// Lookups stop waiting for this version either way
+	s.hostsLoaded = version
+	if err != nil {
+		log.Printf("failed to load verified domains: %v", err)
+		s.hostsReloadAt = time.Now().Add(hostRetryDelay)
+		return fmt.Errorf("%w: %v", errors.ErrUnavailable, err)
+	}
+	s.hosts = make(map[string]*model.Domain, len(domains))
+	for i := range domains {
+		s.hosts[domains[i].Hostname] = &domains[i]
+	}
+	s.hostsReloadAt = time.Now().Add(s.hostTTL)
+	return nil
+}
+
+// Namespace returns the domain a caller names explicitly, or nil for the
+// default namespace when hostname is empty.
+func (s *DomainService) Namespace(ctx context.Context, access Access, hostname string) (*model.Domain, error) {
+	if hostname == "" {
+		return nil, nil
+	}
+
+	domain, err := s.repo.GetDomainByHostname(ctx, normalizeHost(hostname))
+	if stderrors.Is(err, pgx.ErrNoRows) || (err == nil && !access.CanUse(domain.WorkspaceID)) {
+		return nil, errors.ErrDomainNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInternal, err)
+	}
+	return domain, nil
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+func validatePageURLs(pages ...*string) error {
+	for _, page := range pages {
+		if page == nil {
+			continue
+		}
+		if u, err := url.ParseRequestURI(*page); err != nil || u.Host == "" {
+			return errors.ErrInvalidURL
+		}
+	}
+	return nil
+}
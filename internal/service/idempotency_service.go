@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"smolink/internal/config"
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/repository"
+)
+
+const (
+	// idempotencyLockTTL bounds how long an unfinished request holds its
+	// key, so one lost with its instance does not block retries for good.
+	idempotencyLockTTL = time.Minute
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyService lets clients retry requests safely: the first request
+// under a key runs and its response is kept, retries with the same body get
+// that response back, and reusing the key for another body is refused.
+type IdempotencyService struct {
+	store *repository.RedisRepository
+	ttl   time.Duration
+}
+
+func NewIdempotencyService(store *repository.RedisRepository, cfg *config.Config) *IdempotencyService {
+	return &IdempotencyService{store: store, ttl: cfg.IdempotencyKeyTTL}
+}
+
+// IdempotentRequest is a request made under an idempotency key. Replay is set
+// when the request already ran; otherwise the caller runs it and passes the
+// response to Finish.
+type IdempotentRequest struct {
+	Replay  *model.IdempotentResponse
+	keyHash string
+	// token identifies this request's claim, so a request that outlived it
+	// cannot finish a claim made by a retry.
+	token string
+}
+
+// Begin claims key within scope for request, whose JSON encoding is its
+// fingerprint. Without a key it returns nil and nothing is kept.
+func (s *IdempotencyService) Begin(ctx context.Context, scope, key string, request interface{}) (*IdempotentRequest, error) {
+	if key == "" {
+		return nil, nil
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, errors.ErrBadIdempotencyKey
+	}
+	raw, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	fingerprint := hashToken(string(raw))
+
+	token, err := newToken("")
+	if err != nil {
+		return nil, err
+	}
+
+	claim := &IdempotentRequest{keyHash: hashToken(scope + "\n" + key), token: token}
+	record, err := s.store.ClaimIdempotencyKey(ctx, claim.keyHash, claim.token, fingerprint, idempotencyLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	switch {
+	case record == nil:
+		return claim, nil
+	case record.Fingerprint != fingerprint:
+		return nil, errors.ErrIdempotencyReused
+	case record.Response == nil:
+		return nil, errors.ErrRequestInFlight
+	}
+	claim.Replay = record.Response
+	return claim, nil
+}
+
+// Finish keeps the response for retries. Server errors release the key
+// instead, so a retry runs the request again. Requests that outlived their
+// claim leave the key alone, as a retry may have claimed it since.
+func (s *IdempotencyService) Finish(ctx context.Context, claim *IdempotentRequest, status int, body []byte) {
+	if claim == nil || claim.Replay != nil {
+		return
+	}
+	var err error
+	if status >= http.StatusInternalServerError {
+		err = s.store.ReleaseIdempotencyKey(ctx, claim.keyHash, claim.token)
+	} else {
+		err = s.store.SaveIdempotentResponse(ctx, claim.keyHash, claim.token, &model.IdempotentResponse{Status: status, Body: body}, s.ttl)
+	}
+	if stderrors.Is(err, repository.ErrIdempotencyClaimLost) {
+		log.Printf("idempotent request finished after its claim expired; response not kept")
+		return
+	}
+	if err != nil {
+		log.Printf("failed to finish idempotent request: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"smolink/internal/config"
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/oidc"
+	"smolink/internal/repository"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// loginStateTTL is how long a user has to finish logging in at the identity
+// provider.
+const loginStateTTL = 10 * time.Minute
+
+// SSOService logs users in through an OpenID Connect provider, creating their
+// user on first login and keeping their roles in step with their groups.
+type SSOService struct {
+	provider *oidc.Provider
+	repo     *repository.PostgresRepository
+	sessions *repository.RedisRepository
+	users    *UserService
+
+	issuer      string
+	groupsClaim string
+	groupRoles  []model.GroupRole
+}
+
+// NewSSOService takes a nil provider when single sign-on is not configured.
+func NewSSOService(provider *oidc.Provider, repo *repository.PostgresRepository, sessions *repository.RedisRepository, users *UserService, cfg *config.Config) *SSOService {
+	return &SSOService{
+		provider:    provider,
+		repo:        repo,
+		sessions:    sessions,
+		users:       users,
+		issuer:      cfg.OIDCIssuer,
+		groupsClaim: cfg.OIDCGroupsClaim,
+		groupRoles:  cfg.OIDCGroupRoles,
+	}
+}
+
+// Begin starts a login and returns the provider URL to send the browser to.
+func (s *SSOService) Begin(ctx context.Context) (string, error) {
+	if s.provider == nil {
+		return "", errors.ErrSSODisabled
+	}
+
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		return "", fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	// Marshalling plain strings cannot fail
+	state, _ := json.Marshal(req)
+	if err := s.sessions.SaveLoginState(ctx, req.State, state, loginStateTTL); err != nil {
+		return "", fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+
+	authURL, err := s.provider.AuthCodeURL(ctx, req)
+	if err != nil {
+		log.Printf("single sign-on unavailable: %v", err)
+		return "", errors.ErrSSOUnavailable
+	}
+	return authURL, nil
+}
+
+// Complete redeems the code the provider redirected back with and starts a
+// session for the user it identifies.
+func (s *SSOService) Complete(ctx context.Context, state, code string) (*Session, error) {
+	if s.provider == nil {
+		return nil, errors.ErrSSODisabled
+	}
+
+	raw, err := s.sessions.ConsumeLoginState(ctx, state)
+	if stderrors.Is(err, redis.Nil) {
+		return nil, errors.ErrInvalidSSOState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	var req oidc.AuthRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return nil, errors.ErrInvalidSSOState
+	}
+
+	claims, err := s.provider.Exchange(ctx, code, &req)
+	if stderrors.Is(err, oidc.ErrInvalidToken) || stderrors.Is(err, oidc.ErrExchange) {
+		log.Printf("single sign-on rejected: %v", err)
+		return nil, errors.ErrSSOFailed
+	}
+	if err != nil {
+		log.Printf("single sign-on unavailable: %v", err)
+		return nil, errors.ErrSSOUnavailable
+	}
+
+	user, err := s.provision(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	s.syncMemberships(ctx, user.ID, claims.Strings(s.groupsClaim))
+	return s.users.StartSession(ctx, user)
+}
+
+// provision finds the user the identity belongs to. The first login links an
+// existing user with the same verified email, or creates one without a
+// password.
+func (s *SSOService) provision(ctx context.Context, claims *oidc.Claims) (*model.User, error) {
+	user, err := s.repo.GetUserByIdentity(ctx, s.issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+
+	email, err := normalizeEmail(claims.Email)
+	if err != nil || !claims.EmailVerified {
+		return nil, errors.ErrSSOFailed.WithDetails("The identity provider did not share a verified email address")
+	}
+
+	user, err = s.repo.GetUserByEmail(ctx, email)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		user = &model.User{Email: email, Name: claims.Name}
+		err = s.repo.CreateUser(ctx, user)
+		if stderrors.Is(err, repository.ErrDuplicateEmail) {
+			// A concurrent first login created the user
+			user, err = s.repo.GetUserByEmail(ctx, email)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+
+	if err := s.repo.LinkIdentity(ctx, user.ID, s.issuer, claims.Subject); err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return user, nil
+}
+
+// syncMemberships gives the user, in every workspace OIDC_GROUP_ROLES names,
+// the highest role any of their groups maps to, and removes them from those
+// workspaces when no group does. Owners and workspaces the mapping does not name
+// are managed by hand and left alone. Failures are logged so a misconfigured
+// mapping does not lock everyone out.
+func (s *SSOService) syncMemberships(ctx context.Context, userID int, groups []string) {
+	roles := make(map[int]string)
+	for _, grant := range s.groupRoles {
+		best, seen := roles[grant.WorkspaceID]
+		if !seen {
+			roles[grant.WorkspaceID] = ""
+		}
+		if !slices.Contains(groups, grant.Group) {
+			continue
+		}
+		if best == "" || model.RoleAtLeast(grant.Role, best) {
+			roles[grant.WorkspaceID] = grant.Role
+		}
+	}
+
+	for workspaceID, role := range roles {
+		current, err := s.repo.GetMembership(ctx, userID, workspaceID)
+		if err == nil && current.Role == model.RoleOwner {
+			continue
+		}
+		if role == "" {
+			err = s.repo.DeleteMembership(ctx, userID, workspaceID)
+			if stderrors.Is(err, pgx.ErrNoRows) {
+				err = nil
+			}
+		} else {
+			err = s.repo.SetMembership(ctx, &model.Membership{UserID: userID, WorkspaceID: workspaceID, Role: role})
+		}
+		if err != nil {
+			log.Printf("failed to sync membership of user %d in workspace %d: %v", userID, workspaceID, err)
+		}
+	}
+}
@@ -2,101 +2,784 @@ package service
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
+	"slices"
+	"smolink/internal/config"
 	"smolink/internal/errors"
 	"smolink/internal/model"
 	"smolink/internal/repository"
+	"smolink/internal/shortcode"
+	"smolink/internal/signing"
 	"smolink/pkg/utils"
+	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/sync/singleflight"
 )
 
+// maxGenerateAttempts bounds how many generated codes are tried before giving up.
+const maxGenerateAttempts = 5
+
 type URLService struct {
-	repo  *repository.PostgresRepository
-	cache *repository.RedisRepository
+	repo        *repository.PostgresRepository
+	cache       *repository.TieredCache
+	generators  *shortcode.Registry
+	validator   *shortcode.Validator
+	domains     *DomainService
+	cacheTTL    time.Duration
+	negativeTTL time.Duration
+
+	// signer is nil when signed links are not configured.
+	signer       *signing.KeySet
+	signedMaxTTL time.Duration
+
+	usage *UsageService
+
+	// lookups coalesces concurrent cache misses for the same code into a
+	// single Postgres query.
+	lookups singleflight.Group
+}
+
+func NewURLService(repo *repository.PostgresRepository, cache *repository.TieredCache, generators *shortcode.Registry, validator *shortcode.Validator, domains *DomainService, signer *signing.KeySet, usage *UsageService, cfg *config.Config) *URLService {
+	return &URLService{
+		repo:        repo,
+		cache:       cache,
+		generators:  generators,
+		validator:   validator,
+		domains:     domains,
+		cacheTTL:    cfg.CacheTTL,
+		negativeTTL: cfg.NegativeCacheTTL,
+
+		signer:       signer,
+		signedMaxTTL: cfg.SignedLinkMaxTTL,
+
+		usage: usage,
+	}
 }
 
-func NewURLService(repo *repository.PostgresRepository, cache *repository.RedisRepository) *URLService {
-	return &URLService{repo: repo, cache: cache}
+// ShortenRequest describes a link to create. Zero values mean "use the default",
+// which is the workspace's setting where it has one. Links on a custom Domain
+// need Access to the domain's workspace.
+type ShortenRequest struct {
+	URL        string
+	CustomCode string
+	Strategy   string
+	ExpiresAt  *time.Time
+	Domain     string
+	Access     Access
+
+	RedirectType   int
+	ReferrerPolicy string
+	ForwardPath    bool
+
+	// ActiveFrom and ActiveUntil bound when the link resolves; outside the
+	// window visitors go to InactiveURL, or get a 404 without one.
+	ActiveFrom  *time.Time
+	ActiveUntil *time.Time
+	InactiveURL string
+	Schedule    []model.ScheduledDestination
+
+	// MaxUses makes the link stop resolving after that many visits, sending
+	// later visitors to InactiveURL or answering 410; 0 means no limit.
+	MaxUses int
+
+	// RequireSignature only lets URLs issued by SignLink resolve the link.
+	RequireSignature bool
+
+	// ReuseExisting returns the workspace's oldest usable link to the same
+	// destination in the namespace, if any, instead of creating one. It
+	// cannot be combined with per-link settings, which a reused link would
+	// not have; custom codes and callers outside any workspace never reuse.
+	ReuseExisting bool
 }
 
-func (s *URLService) ShortenURL(ctx context.Context, originalURL, customCode string) (*model.URL, error) {
-	if _, err := url.ParseRequestURI(originalURL); err != nil {
-		return nil, errors.ErrInvalidURL
+// hasLinkSettings reports whether the request sets anything that changes how
+// its link behaves, beyond the destination and the shape of its code.
+func (req ShortenRequest) hasLinkSettings() bool {
+	return req.ExpiresAt != nil || req.RedirectType != 0 || req.ReferrerPolicy != "" || req.ForwardPath ||
+		req.ActiveFrom != nil || req.ActiveUntil != nil || req.InactiveURL != "" || len(req.Schedule) > 0 ||
+		req.MaxUses != 0 || req.RequireSignature
+}
+
+// LinkRef names a link: Code within Domain's namespace, or within the default
+// namespace when Domain is empty.
+type LinkRef struct {
+	Domain string
+	Code   string
+}
+
+// ShortenURL creates a link and reports true, or with ReuseExisting may return
+// an existing one and report false.
+func (s *URLService) ShortenURL(ctx context.Context, req ShortenRequest) (*model.URL, bool, error) {
+	if _, err := url.ParseRequestURI(req.URL); err != nil {
+		return nil, false, errors.ErrInvalidURL
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, false, errors.ErrInvalidExpiry
+	}
+	if req.RedirectType != 0 && !model.ValidRedirectType(req.RedirectType) {
+		return nil, false, errors.ErrInvalidRedirect
+	}
+	if req.ReferrerPolicy != "" && !model.ValidReferrerPolicy(req.ReferrerPolicy) {
+		return nil, false, errors.ErrInvalidReferrer
+	}
+	if err := validateSchedule(req.ActiveFrom, req.ActiveUntil, &req.InactiveURL, req.Schedule); err != nil {
+		return nil, false, err
+	}
+	if req.MaxUses < 0 {
+		return nil, false, errors.ErrInvalidMaxUses
+	}
+	if req.RequireSignature && s.signer == nil {
+		return nil, false, errors.ErrSigningDisabled
+	}
+	if req.ReuseExisting && req.hasLinkSettings() {
+		return nil, false, errors.ErrReuseWithSettings
 	}
 
-	var shortCode string
-	var err error
+	domain, err := s.domains.Namespace(ctx, req.Access, req.Domain)
+	if err != nil {
+		return nil, false, err
+	}
+	if domain != nil && !domain.Verified() {
+		return nil, false, errors.ErrDomainNotVerified
+	}
 
-	if customCode != "" {
-		if existingURL, _ := s.repo.GetURL(ctx, customCode); existingURL != nil {
-			return nil, errors.ErrCodeInUse
+	// Links belong to their domain's workspace, or else the caller's
+	workspaceID := req.Access.WorkspaceID
+	if domain != nil {
+		workspaceID = &domain.WorkspaceID
+	}
+	var settings model.Workspace
+	if workspaceID != nil {
+		workspace, err := s.repo.GetWorkspace(ctx, *workspaceID)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w %v", errors.ErrInternal, err)
 		}
-		shortCode = customCode
-	} else {
-		// Generate secure random code with retry logic
-		for i := 0; i < 3; i++ { // Try 3 times to generate unique code
-			shortCode, err = utils.GenerateShortCodeSecure(6)
+		settings = *workspace
+	}
+	if req.RedirectType == 0 && settings.RedirectType != nil {
+		req.RedirectType = *settings.RedirectType
+	}
+
+	urlModel := &model.URL{
+		WorkspaceID:  workspaceID,
+		OriginalURL:  req.URL,
+		ExpiresAt:    req.ExpiresAt,
+		RedirectType: req.RedirectType,
+		ForwardPath:  req.ForwardPath,
+		ActiveFrom:   req.ActiveFrom,
+		ActiveUntil:  req.ActiveUntil,
+		Schedule:     req.Schedule,
+	}
+	if req.ReferrerPolicy != "" {
+		urlModel.ReferrerPolicy = &req.ReferrerPolicy
+	}
+	if req.InactiveURL != "" {
+		urlModel.InactiveURL = &req.InactiveURL
+	}
+	if req.MaxUses > 0 {
+		urlModel.MaxUses = &req.MaxUses
+	}
+	urlModel.RequireSignature = req.RequireSignature
+	if domain != nil {
+		urlModel.DomainID = &domain.ID
+	}
+
+	if req.CustomCode != "" {
+		if err := s.validator.ValidateCustom(req.CustomCode); err != nil {
+			return nil, false, err
+		}
+	}
+	codeLength := 0
+	if settings.CodeLength != nil {
+		codeLength = *settings.CodeLength
+	}
+
+	// Links outside any workspace are shared by every caller without one,
+	// so only links a workspace owns are reused
+	if req.ReuseExisting && req.CustomCode == "" && workspaceID != nil {
+		existing, err := s.repo.FindReusableURL(ctx, *workspaceID, urlModel.DomainID, req.URL)
+		if err == nil {
+			return existing, false, nil
+		}
+		if !stderrors.Is(err, pgx.ErrNoRows) {
+			return nil, false, fmt.Errorf("%w %v", errors.ErrInternal, err)
+		}
+	}
+
+	if err := s.usage.Reserve(ctx, workspaceID, model.MetricLinksCreated, 1); err != nil {
+		return nil, false, err
+	}
+	if err := s.createLink(ctx, req, urlModel, codeLength); err != nil {
+		s.usage.Release(context.WithoutCancel(ctx), workspaceID, model.MetricLinksCreated, 1)
+		return nil, false, err
+	}
+	key := cacheKey(domain, urlModel.ShortCode)
+
+	// Other instances may still hold a local negative entry for this code
+	if err := s.cache.Invalidate(ctx, key); err != nil {
+		log.Printf("failed to broadcast cache invalidation: %v", err)
+	}
+	if err := s.cache.SetLink(ctx, key, urlModel.Record(), s.cacheTTL); err != nil {
+		log.Printf("failed to cache URL: %v", err)
+	}
+
+	return urlModel, true, nil
+}
+
+// createLink inserts the link under its custom code, or a generated one of
+// codeLength characters when that is set.
+func (s *URLService) createLink(ctx context.Context, req ShortenRequest, urlModel *model.URL, codeLength int) error {
+	// The short_code unique constraint is the only uniqueness check: checking
+	// first and inserting later races with concurrent requests.
+	if req.CustomCode != "" {
+		urlModel.ShortCode = req.CustomCode
+		err := s.repo.CreateURL(ctx, urlModel, req.Access.Actor)
+		if stderrors.Is(err, repository.ErrDuplicateShortCode) {
+			return errors.ErrCodeInUse
+		}
+		if err != nil {
+			return fmt.Errorf("%w %v", errors.ErrInternal, err)
+		}
+		return nil
+	}
+
+	generator, ok := s.generators.WithLength(req.Strategy, codeLength)
+	if !ok {
+		return errors.ErrInvalidStrategy.WithDetails(fmt.Sprintf("available strategies: %v", s.generators.Strategies()))
+	}
+	return s.createWithGeneratedCode(ctx, generator, urlModel, req.Access.Actor)
+}
+
+// createWithGeneratedCode inserts the link under a freshly generated code,
+// drawing a new one whenever the insert collides with an existing code or the
+// generator produced a reserved word or blocked term.
+// Adaptive generators are told about collisions and, if any attempt collided,
+// get another round of attempts when they could widen their keyspace. Codes
+// rejected as reserved or blocked are not collisions: a longer code would not
+// avoid them.
+func (s *URLService) createWithGeneratedCode(ctx context.Context, generator shortcode.CodeGenerator, urlModel *model.URL, actor string) error {
+	observer, adaptive := generator.(shortcode.CollisionObserver)
+
+	for {
+		collisions := 0
+		for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+			shortCode, err := generator.Generate(ctx)
 			if err != nil {
-				return nil, fmt.Errorf("%w: %v", errors.ErrInternal, err)
+				return fmt.Errorf("%w: %v", errors.ErrInternal, err)
+			}
+			if s.validator.IsReserved(shortCode) || s.validator.IsOffensive(shortCode) {
+				log.Printf("generated short code %s is reserved or blocked, retrying", shortCode)
+				continue
 			}
 
-			// Verify uniqueness
-			if existingURL, _ := s.repo.GetURL(ctx, shortCode); existingURL == nil {
-				break
+			urlModel.ShortCode = shortCode
+			err = s.repo.CreateURL(ctx, urlModel, actor)
+			if err == nil {
+				return nil
 			}
+			if !stderrors.Is(err, repository.ErrDuplicateShortCode) {
+				return fmt.Errorf("%w %v", errors.ErrInternal, err)
+			}
+
+			log.Printf("generated short code %s collided, retrying", shortCode)
+			collisions++
+			if adaptive {
+				observer.ObserveCollision()
+			}
+		}
+
+		if !adaptive || collisions == 0 || !observer.RetryBudgetExceeded() {
+			return fmt.Errorf("%w: no unique short code after %d attempts", errors.ErrInternal, maxGenerateAttempts)
 		}
 	}
+}
 
-	urlModel := &model.URL{
-		ShortCode:   shortCode,
-		OriginalURL: originalURL,
-		CreatedAt:   time.Now(),
+// AvailabilityRequest asks whether Code can be used as a custom code in
+// Domain's namespace, or the default one when Domain is empty. With
+// Suggest set, up to Limit available alternatives are derived from the code,
+// the destination's title and the destination URL.
+type AvailabilityRequest struct {
+	Code    string
+	Suggest bool
+	URL     string
+	Title   string
+	Limit   int
+	Domain  string
+	Access  Access
+}
+
+func (s *URLService) CheckAvailability(ctx context.Context, req AvailabilityRequest) (*model.CodeAvailability, error) {
+	domain, err := s.domains.Namespace(ctx, req.Access, req.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.CodeAvailability{Code: req.Code}
+	candidates := []string{}
+	if err := s.validator.ValidateCustom(req.Code); err != nil {
+		result.Reason = errors.ExtractAPIError(err).Code
+	} else {
+		candidates = append(candidates, req.Code)
 	}
 
-	if err := s.repo.CreateURL(ctx, urlModel); err != nil {
+	if req.Suggest {
+		for _, candidate := range shortcode.Suggest(req.Code, req.Title, destinationHints(req.URL)) {
+			if s.validator.ValidateCustom(candidate) == nil {
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return result, nil
+	}
+
+	// Codes are unique per namespace, not per workspace, so every link counts
+	taken, err := s.repo.ExistingShortCodes(ctx, domainID(domain), candidates)
+	if err != nil {
 		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
 	}
 
-	if err := s.cache.SetURL(ctx, shortCode, originalURL, 24*time.Hour); err != nil {
-		log.Printf("failed to cache URL: %v", err)
+	if result.Reason == "" {
+		result.Available = !taken[req.Code]
+		if !result.Available {
+			result.Reason = errors.ErrCodeInUse.Code
+		}
+		candidates = candidates[1:]
+	}
+	for _, candidate := range candidates {
+		if len(result.Suggestions) == req.Limit {
+			break
+		}
+		if !taken[candidate] {
+			result.Suggestions = append(result.Suggestions, candidate)
+		}
 	}
+	return result, nil
+}
 
-	return urlModel, nil
+// destinationHints keeps the meaningful parts of a destination for suggestions.
+func destinationHints(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname() + " " + u.Path
+}
+
+// CodeStats reports the state of the adaptive random code generator.
+func (s *URLService) CodeStats() shortcode.AdaptiveStats {
+	return s.generators.Random().Stats()
+}
+
+// ResolveRequest is one visit to a short link. Host selects the domain
+// namespace; Path and Query are whatever followed the code, forwarded to the
+// destination on links that allow it. SkipAnalytics resolves without counting
+// a click or taking one of a limited-use link's uses, as for HEAD.
+type ResolveRequest struct {
+	Host          string
+	Code          string
+	Path          string
+	Query         string
+	IP            string
+	UserAgent     string
+	SkipAnalytics bool
 }
 
-func (s *URLService) ResolveURL(ctx context.Context, shortCode, ip, userAgent string) (string, error) {
-	original, err := s.cache.GetURL(ctx, shortCode)
-	if err == nil {
+// ResolveURL returns the link record to redirect to, looking the code up in
+// the namespace of the domain serving the request. Status and expiry are
+// enforced from the cached record, so a cache hit never touches Postgres.
+func (s *URLService) ResolveURL(ctx context.Context, req ResolveRequest) (*model.LinkRecord, error) {
+	shortCode := req.Code
+	domain, err := s.domains.ForHost(ctx, req.Host)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey(domain, shortCode)
+
+	record, err := s.cache.GetLink(ctx, key)
+	switch {
+	case err == nil:
 		log.Print("Successfully fetched from Cache")
-		go s.recordAnalytics(ctx, shortCode, ip, userAgent)
-		return original, nil
+	case stderrors.Is(err, repository.ErrCachedNotFound):
+		return nil, errors.ErrShortCodeNotFound
+	default:
+		// Fallback to DB
+		log.Print("Did not find record from cache. Fetching from DB")
+		result, err, _ := s.lookups.Do(key, func() (interface{}, error) {
+			return s.loadLink(context.WithoutCancel(ctx), domain, shortCode)
+		})
+		if err != nil {
+			return nil, err
+		}
+		record = result.(*model.LinkRecord)
+		log.Print("Successfully fetched from DB")
+	}
+
+	if record.Status != model.URLStatusActive {
+		return nil, errors.ErrLinkDisabled
+	}
+	now := time.Now()
+	if record.Expired(now) {
+		return nil, errors.ErrLinkExpired
+	}
+	if record.RequireSignature {
+		if req.Query, err = s.verifySignature(key, req.Query, now); err != nil {
+			return nil, err
+		}
+	}
+	if !record.Active(now) {
+		return inactive(record, errors.ErrLinkNotActive)
+	}
+	if destination := record.Destination(now); destination != record.OriginalURL {
+		scheduled := *record
+		scheduled.OriginalURL = destination
+		record = &scheduled
+	}
+	if record, err = forward(record, req); err != nil {
+		return nil, err
+	}
+	if record.MaxUses > 0 && !req.SkipAnalytics {
+		consumed, err := s.repo.ConsumeUse(ctx, record.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+		}
+		if !consumed {
+			return inactive(record, errors.ErrLinkUsedUp)
+		}
 	}
 
-	// Fallback to DB
-	urlModel, err := s.repo.GetURL(ctx, shortCode)
-	log.Print("Did not find record from cache. Fetching from DB")
+	if !req.SkipAnalytics {
+		go s.recordAnalytics(context.WithoutCancel(ctx), record, req.IP, req.UserAgent)
+	}
+	return record, nil
+}
+
+// verifySignature checks a signed link's query string and returns it without
+// the signing parameters. Signatures cover the namespaced code, so they cannot
+// be replayed against the same code on another domain.
+func (s *URLService) verifySignature(name, rawQuery string, now time.Time) (string, error) {
+	query, err := url.ParseQuery(rawQuery)
 	if err != nil {
-		return "", errors.ErrShortCodeNotFound
+		return "", errors.ErrInvalidSignature
+	}
+	rest, err := s.signer.Verify(name, query, now)
+	if stderrors.Is(err, signing.ErrExpired) {
+		return "", errors.ErrSignatureExpired
 	}
+	if err != nil {
+		return "", errors.ErrInvalidSignature
+	}
+	return rest.Encode(), nil
+}
 
-	log.Print("Successfully fetched from DB")
-	_ = s.cache.SetURL(ctx, shortCode, urlModel.OriginalURL, 24*time.Hour)
-	go s.recordAnalytics(ctx, shortCode, ip, userAgent)
+// SignLink issues the query parameters of a URL that resolves a link requiring
+// signatures until expiresAt.
+func (s *URLService) SignLink(ctx context.Context, access Access, ref LinkRef, expiresAt time.Time) (url.Values, error) {
+	if s.signer == nil {
+		return nil, errors.ErrSigningDisabled
+	}
+	now := time.Now()
+	if !expiresAt.After(now) || expiresAt.Sub(now) > s.signedMaxTTL {
+		return nil, errors.ErrInvalidExpiry.WithDetails(fmt.Sprintf("signed URLs expire within %s", s.signedMaxTTL))
+	}
+
+	domain, err := s.domains.Namespace(ctx, access, ref.Domain)
+	if err != nil {
+		return nil, err
+	}
+	urlModel, err := s.repo.GetURL(ctx, access.Scope(), domainID(domain), ref.Code)
+	if err != nil {
+		return nil, notFoundOrInternal(err)
+	}
+	if !urlModel.RequireSignature {
+		return nil, errors.ErrLinkNotSigned
+	}
+	return s.signer.Sign(cacheKey(domain, ref.Code), expiresAt), nil
+}
+
+// inactive sends visitors of a link that cannot be used right now to its
+// inactive URL, or fails with reason without one. These visits are not clicks
+// on the link.
+func inactive(record *model.LinkRecord, reason error) (*model.LinkRecord, error) {
+	if record.InactiveURL == "" {
+		return nil, reason
+	}
+	return &model.LinkRecord{
+		ID:           record.ID,
+		OriginalURL:  record.InactiveURL,
+		Status:       record.Status,
+		RedirectType: http.StatusFound,
+	}, nil
+}
+
+// validateSchedule checks a link's activation window, inactive URL and
+// schedule, sorting the schedule by time. A window is only checked here when
+// both ends are given; the database checks the rest on update.
+func validateSchedule(activeFrom, activeUntil *time.Time, inactiveURL *string, schedule []model.ScheduledDestination) error {
+	if activeFrom != nil && activeUntil != nil && !activeFrom.IsZero() && !activeUntil.IsZero() && !activeFrom.Before(*activeUntil) {
+		return errors.ErrInvalidSchedule.WithDetails("activeFrom must be before activeUntil")
+	}
+	if inactiveURL != nil && *inactiveURL != "" {
+		if _, err := url.ParseRequestURI(*inactiveURL); err != nil {
+			return errors.ErrInvalidURL
+		}
+	}
+	if len(schedule) > model.MaxScheduledDestinations {
+		return errors.ErrInvalidSchedule.WithDetails(fmt.Sprintf("at most %d scheduled destinations", model.MaxScheduledDestinations))
+	}
+
+	slices.SortFunc(schedule, func(a, b model.ScheduledDestination) int { return a.At.Compare(b.At) })
+	for i, change := range schedule {
+		if _, err := url.ParseRequestURI(change.URL); err != nil {
+			return errors.ErrInvalidURL
+		}
+		if change.At.IsZero() || (i > 0 && change.At.Equal(schedule[i-1].At)) {
+			return errors.ErrInvalidSchedule.WithDetails("every scheduled destination needs its own time")
+		}
+	}
+	return nil
+}
+
+// forward returns a copy of record redirecting to the destination with the
+// request's path and query appended, leaving the cached record untouched.
+// Links without forwarding only answer at their bare code.
+func forward(record *model.LinkRecord, req ResolveRequest) (*model.LinkRecord, error) {
+	path := strings.TrimPrefix(req.Path, "/")
+	if !record.ForwardPath {
+		if path != "" {
+			return nil, errors.ErrShortCodeNotFound
+		}
+		return record, nil
+	}
+	if path == "" && req.Query == "" {
+		return record, nil
+	}
+
+	destination, err := utils.ForwardURL(record.OriginalURL, req.Path, req.Query)
+	if err != nil {
+		return nil, errors.ErrInvalidForward
+	}
+	forwarded := *record
+	forwarded.OriginalURL = destination
+	return &forwarded, nil
+}
+
+// loadLink reads a link from Postgres and refreshes the cache, caching unknown
+// codes negatively. Disabled and expired links are cached too so they are
+// rejected without a database round trip. The cache is only filled if no
+// change to the link was cached or evicted since the read began, so a change
+// racing the read is never overwritten with what it replaced.
+func (s *URLService) loadLink(ctx context.Context, domain *model.Domain, shortCode string) (*model.LinkRecord, error) {
+	key := cacheKey(domain, shortCode)
+	generation, genErr := s.cache.LinkGeneration(ctx, key)
+	if genErr != nil {
+		log.Printf("failed to read cache generation of %s: %v", key, genErr)
+	}
+
+	urlModel, err := s.repo.GetURL(ctx, repository.AllWorkspaces, domainID(domain), shortCode)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		if genErr == nil {
+			if err := s.cache.FillNotFound(ctx, key, generation, s.negativeTTL); err != nil {
+				log.Printf("failed to negatively cache %s: %v", shortCode, err)
+			}
+		}
+		return nil, errors.ErrShortCodeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+
+	record := urlModel.Record()
+	if genErr == nil {
+		_ = s.cache.FillLink(ctx, key, generation, record, s.cacheTTL)
+	}
+	return record, nil
+}
+
+func (s *URLService) GetURL(ctx context.Context, access Access, ref LinkRef) (*model.URL, error) {
+	domain, err := s.domains.Namespace(ctx, access, ref.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	urlModel, err := s.repo.GetURL(ctx, access.Scope(), domainID(domain), ref.Code)
+	if err != nil {
+		return nil, notFoundOrInternal(err)
+	}
+	return urlModel, nil
+}
+
+func (s *URLService) ListURLs(ctx context.Context, access Access, limit, offset, before int) ([]model.URL, int, error) {
+	urls, total, err := s.repo.ListURLs(ctx, access.Scope(), limit, offset, before)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return urls, total, nil
+}
+
+func (s *URLService) UpdateLink(ctx context.Context, access Access, ref LinkRef, update model.LinkUpdate) (*model.URL, error) {
+	if update.OriginalURL != nil {
+		if _, err := url.ParseRequestURI(*update.OriginalURL); err != nil {
+			return nil, errors.ErrInvalidURL
+		}
+	}
+	if update.RedirectType != nil && !model.ValidRedirectType(*update.RedirectType) {
+		return nil, errors.ErrInvalidRedirect
+	}
+	if update.ReferrerPolicy != nil && *update.ReferrerPolicy != "" && !model.ValidReferrerPolicy(*update.ReferrerPolicy) {
+		return nil, errors.ErrInvalidReferrer
+	}
+	var schedule []model.ScheduledDestination
+	if update.Schedule != nil {
+		if *update.Schedule == nil {
+			update.Schedule = &[]model.ScheduledDestination{}
+		}
+		schedule = *update.Schedule
+	}
+	if err := validateSchedule(update.ActiveFrom, update.ActiveUntil, update.InactiveURL, schedule); err != nil {
+		return nil, err
+	}
+	if update.RequireSignature != nil && *update.RequireSignature && s.signer == nil {
+		return nil, errors.ErrSigningDisabled
+	}
+
+	domain, err := s.domains.Namespace(ctx, access, ref.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	urlModel, err := s.repo.UpdateURL(ctx, access.Scope(), domainID(domain), ref.Code, update, access.Actor)
+	if stderrors.Is(err, repository.ErrInvalidActiveWindow) {
+		return nil, errors.ErrInvalidSchedule.WithDetails("activeFrom must be before activeUntil")
+	}
+	if err != nil {
+		return nil, notFoundOrInternal(err)
+	}
+	s.evict(ctx, cacheKey(domain, ref.Code))
+	return urlModel, nil
+}
+
+// History lists a link's revisions, newest first.
+func (s *URLService) History(ctx context.Context, access Access, ref LinkRef) ([]model.URLRevision, error) {
+	urlModel, err := s.GetURL(ctx, access, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := s.repo.ListRevisions(ctx, urlModel.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return revisions, nil
+}
+
+// Rollback restores a link's destination and settings from an earlier revision.
+func (s *URLService) Rollback(ctx context.Context, access Access, ref LinkRef, revision int) (*model.URL, error) {
+	domain, err := s.domains.Namespace(ctx, access, ref.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	urlModel, err := s.repo.RollbackURL(ctx, access.Scope(), domainID(domain), ref.Code, revision, access.Actor)
+	if stderrors.Is(err, repository.ErrRevisionNotFound) {
+		return nil, errors.ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, notFoundOrInternal(err)
+	}
+	s.evict(ctx, cacheKey(domain, ref.Code))
+	return urlModel, nil
+}
+
+func (s *URLService) SetStatus(ctx context.Context, access Access, ref LinkRef, status string) (*model.URL, error) {
+	domain, err := s.domains.Namespace(ctx, access, ref.Domain)
+	if err != nil {
+		return nil, err
+	}
 
-	return urlModel.OriginalURL, nil
+	urlModel, err := s.repo.UpdateURLStatus(ctx, access.Scope(), domainID(domain), ref.Code, status, access.Actor)
+	if err != nil {
+		return nil, notFoundOrInternal(err)
+	}
+	s.evict(ctx, cacheKey(domain, ref.Code))
+	return urlModel, nil
 }
 
-func (s *URLService) recordAnalytics(ctx context.Context, shortCode, ip, userAgent string) {
-	urlModel, err := s.repo.GetURL(ctx, shortCode)
+func (s *URLService) DeleteURL(ctx context.Context, access Access, ref LinkRef) error {
+	domain, err := s.domains.Namespace(ctx, access, ref.Domain)
 	if err != nil {
-		return
+		return err
+	}
+
+	if err := s.repo.DeleteURL(ctx, access.Scope(), domainID(domain), ref.Code); err != nil {
+		return notFoundOrInternal(err)
+	}
+	s.evict(ctx, cacheKey(domain, ref.Code))
+	return nil
+}
+
+func (s *URLService) GetStats(ctx context.Context, access Access, ref LinkRef, days int) (*model.URLStats, error) {
+	urlModel, err := s.GetURL(ctx, access, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.repo.GetURLStats(ctx, urlModel, days)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
 	}
+	return stats, nil
+}
+
+// evict drops a cached destination so changes take effect on the next redirect.
+func (s *URLService) evict(ctx context.Context, key string) {
+	if err := s.cache.DeleteLink(ctx, key); err != nil {
+		log.Printf("failed to evict cached URL %s: %v", key, err)
+	}
+}
 
-	_ = s.repo.IncrementClickCount(ctx, urlModel.ID)
+// cacheKey namespaces cached links by domain. Default-namespace links keep the
+// bare code so entries written before domains existed stay valid.
+func cacheKey(domain *model.Domain, shortCode string) string {
+	if domain == nil {
+		return shortCode
+	}
+	return domain.Hostname + "/" + shortCode
+}
+
+func domainID(domain *model.Domain) *int {
+	if domain == nil {
+		return nil
+	}
+	return &domain.ID
+}
+
+func notFoundOrInternal(err error) error {
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrShortCodeNotFound
+	}
+	return fmt.Errorf("%w %v", errors.ErrInternal, err)
+}
+
+// recordAnalytics counts a click unless the link's workspace has used up its
+// quota of recorded clicks; the visitor is redirected either way. Metering
+// failures do not stop the click from being recorded.
+func (s *URLService) recordAnalytics(ctx context.Context, record *model.LinkRecord, ip, userAgent string) {
+	if err := s.usage.Reserve(ctx, record.WorkspaceID, model.MetricClicksRecorded, 1); err != nil {
+		if errors.ExtractAPIError(err).Code == errors.ErrQuotaExceeded.Code {
+			return
+		}
+		log.Printf("failed to meter click on link %d: %v", record.ID, err)
+	}
+	_ = s.repo.IncrementClickCount(ctx, record.ID)
 	_ = s.repo.LogAnalytics(ctx, &model.URLAnalytics{
-		URLID:      urlModel.ID,
+		URLID:      record.ID,
 		IPAddress:  ip,
 		UserAgent:  userAgent,
 		AccessedAt: time.Now(),
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"time"
+
+	"smolink/internal/cache"
+	"smolink/internal/config"
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/repository"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// quotaCacheSize and quotaCacheTTL bound the in-process quota lookups;
+	// quota changes reach other instances once the TTL passes.
+	quotaCacheSize = 1024
+	quotaCacheTTL  = time.Minute
+
+	// usageCounterTTL keeps a month's counters in Redis well past its end,
+	// so the last increments are saved before they expire.
+	usageCounterTTL = 62 * 24 * time.Hour
+)
+
+// UsageService counts what workspaces use per month and enforces their
+// quotas. Counters live in Redis so every instance sees the same totals, and
+// are saved to Postgres by SaveLoop, from where they are reloaded when Redis
+// has lost them. Callers outside any workspace are not metered.
+type UsageService struct {
+	repo     *repository.PostgresRepository
+	counters *repository.RedisRepository
+	defaults model.Quotas
+	quotas   *cache.LRU[int, model.Quotas]
+	now      func() time.Time
+}
+
+func NewUsageService(repo *repository.PostgresRepository, counters *repository.RedisRepository, cfg *config.Config) *UsageService {
+	return &UsageService{
+		repo:     repo,
+		counters: counters,
+		defaults: cfg.DefaultQuotas(),
+		quotas:   cache.NewLRU[int, model.Quotas](quotaCacheSize),
+		now:      time.Now,
+	}
+}
+
+// ForgetQuotas drops every cached quota lookup.
+func (s *UsageService) ForgetQuotas() {
+	s.quotas.Purge()
+}
+
+// period returns the month now falls in and when it started.
+func (s *UsageService) period() (string, time.Time) {
+	now := s.now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start.Format(model.UsagePeriodLayout), start
+}
+
+// Reserve counts n uses of metric against the workspace's quota, failing
+// with ErrQuotaExceeded instead when they would exceed it. Metering fails
+// open: when the counters cannot be reached, the uses are allowed uncounted
+// and a warning is logged, so a Redis outage does not take the API down.
+func (s *UsageService) Reserve(ctx context.Context, workspaceID *int, metric string, n int64) error {
+	if workspaceID == nil || n <= 0 {
+		return nil
+	}
+	quotas, err := s.Quotas(ctx, *workspaceID)
+	if err != nil {
+		return err
+	}
+	var limit int64
+	if quota := quotas.Limit(metric); quota != nil {
+		limit = *quota
+	}
+
+	period, start := s.period()
+	key := repository.UsageKey{WorkspaceID: *workspaceID, Period: period, Metric: metric}
+	_, err = s.counters.ReserveUsage(ctx, key, n, limit)
+	if stderrors.Is(err, repository.ErrUsageNotLoaded) {
+		if err = s.load(ctx, key, start); err == nil {
+			_, err = s.counters.ReserveUsage(ctx, key, n, limit)
+		}
+	}
+	if stderrors.Is(err, repository.ErrUsageExceeded) {
+		return errors.ErrQuotaExceeded.WithDetails(fmt.Sprintf("the workspace's monthly %s quota of %d is used up", metric, limit))
+	}
+	if err != nil {
+		log.Printf("warning: allowing %d %s of workspace %d unmetered: %v", n, metric, *workspaceID, err)
+	}
+	return nil
+}
+
+// Release gives back uses reserved for something that then failed.
+func (s *UsageService) Release(ctx context.Context, workspaceID *int, metric string, n int64) {
+	if workspaceID == nil || n <= 0 {
+		return
+	}
+	period, _ := s.period()
+	key := repository.UsageKey{WorkspaceID: *workspaceID, Period: period, Metric: metric}
+	if err := s.counters.ReleaseUsage(ctx, key, n); err != nil {
+		log.Printf("failed to release %d %s of workspace %d: %v", n, metric, *workspaceID, err)
+	}
+}
+
+// load starts the period's counter from the value last saved to Postgres.
+func (s *UsageService) load(ctx context.Context, key repository.UsageKey, start time.Time) error {
+	saved, err := s.repo.GetSavedUsage(ctx, key.WorkspaceID, start)
+	if err != nil {
+		return err
+	}
+	return s.counters.LoadUsage(ctx, key, saved[key.Metric], usageCounterTTL)
+}
+
+// Quotas returns the workspace's quotas with the instance defaults filled in.
+func (s *UsageService) Quotas(ctx context.Context, workspaceID int) (model.Quotas, error) {
+	if quotas, ok := s.quotas.Get(workspaceID); ok {
+		return quotas, nil
+	}
+	workspace, err := s.repo.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return model.Quotas{}, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	quotas := workspace.Quotas.Or(s.defaults)
+	s.quotas.Set(workspaceID, quotas, quotaCacheTTL)
+	return quotas, nil
+}
+
+// SetQuotas replaces a workspace's quotas; nil ones use the instance defaults.
+func (s *UsageService) SetQuotas(ctx context.Context, workspaceID int, quotas model.Quotas) (*model.Workspace, error) {
+	for _, metric := range model.UsageMetrics {
+		if quota := quotas.Limit(metric); quota != nil && *quota <= 0 {
+			return nil, errors.ErrInvalidQuota
+		}
+	}
+
+	workspace, err := s.repo.SetWorkspaceQuotas(ctx, workspaceID, quotas)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	s.quotas.Delete(workspaceID)
+	return workspace, nil
+}
+
+// Usage reports how much of each quota a workspace used this month.
+func (s *UsageService) Usage(ctx context.Context, access Access, workspaceID int) (*model.Usage, error) {
+	if !access.CanUse(workspaceID) {
+		return nil, errors.ErrWorkspaceNotFound
+	}
+	quotas, err := s.Quotas(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	period, start := s.period()
+	keys := make([]repository.UsageKey, len(model.UsageMetrics))
+	for i, metric := range model.UsageMetrics {
+		keys[i] = repository.UsageKey{WorkspaceID: workspaceID, Period: period, Metric: metric}
+	}
+	live, err := s.counters.GetUsage(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	saved, err := s.repo.GetSavedUsage(ctx, workspaceID, start)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+
+	usage := &model.Usage{WorkspaceID: workspaceID, Period: period, ResetsAt: start.AddDate(0, 1, 0)}
+	for _, key := range keys {
+		used, ok := live[key]
+		if !ok {
+			used = saved[key.Metric]
+		}
+		usage.Metrics = append(usage.Metrics, model.MetricUsage{Metric: key.Metric, Used: used, Limit: quotas.Limit(key.Metric)})
+	}
+	return usage, nil
+}
+
+// Save copies the counters changed since the last save to Postgres.
+func (s *UsageService) Save(ctx context.Context) error {
+	dirty, err := s.counters.TakeDirtyUsage(ctx)
+	if err != nil {
+		return err
+	}
+
+	var failed []repository.UsageKey
+	for key, used := range dirty {
+		start, err := time.Parse(model.UsagePeriodLayout, key.Period)
+		if err != nil {
+			continue
+		}
+		err = s.repo.SaveUsage(ctx, key.WorkspaceID, start, key.Metric, used)
+		if stderrors.Is(err, pgx.ErrNoRows) {
+			// The workspace was deleted
+			continue
+		}
+		if err != nil {
+			log.Printf("failed to save usage %s: %v", key, err)
+			failed = append(failed, key)
+		}
+	}
+	return s.counters.MarkUsageDirty(ctx, failed...)
+}
+
+// SaveLoop saves changed counters every interval until ctx is done.
+func (s *UsageService) SaveLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.Save(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("failed to save usage counters: %v", err)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"log"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"smolink/internal/config"
+	"smolink/internal/errors"
+	"smolink/internal/mail"
+	"smolink/internal/model"
+	"smolink/internal/repository"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// SessionPrefix marks bearer tokens that are user sessions rather than
+	// API keys.
+	SessionPrefix = "sess_"
+
+	passwordResetPrefix = "pwr_"
+
+	minPasswordLength = 8
+	// bcrypt ignores everything past 72 bytes.
+	maxPasswordLength = 72
+	maxEmailLength    = 254
+)
+
+// dummyPasswordHash is compared against when a login names an unknown user,
+// so the response time does not reveal which emails are registered.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// CreateUserRequest registers a user, optionally adding them to a workspace.
+// Without a password the user sets one through the password reset flow.
+type CreateUserRequest struct {
+	Email       string
+	Name        string
+	Password    string
+	WorkspaceID *int
+	Role        string
+}
+
+// Session is a logged-in user's bearer token.
+type Session struct {
+	Token     string
+	ExpiresAt time.Time
+	User      *model.User
+}
+
+type UserService struct {
+	repo     *repository.PostgresRepository
+	sessions *repository.RedisRepository
+	mailer   mail.Mailer
+
+	sessionTTL time.Duration
+	resetTTL   time.Duration
+	resetURL   string
+}
+
+func NewUserService(repo *repository.PostgresRepository, sessions *repository.RedisRepository, mailer mail.Mailer, cfg *config.Config) *UserService {
+	return &UserService{
+		repo:       repo,
+		sessions:   sessions,
+		mailer:     mailer,
+		sessionTTL: cfg.SessionTTL,
+		resetTTL:   cfg.PasswordResetTTL,
+		resetURL:   cfg.PasswordResetURL,
+	}
+}
+
+// UseMailer replaces the mailer, e.g. with an in-memory one in tests. It must
+// not be called while requests are being served.
+func (s *UserService) UseMailer(mailer mail.Mailer) {
+	s.mailer = mailer
+}
+
+func (s *UserService) CreateUser(ctx context.Context, req CreateUserRequest) (*model.User, error) {
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if req.WorkspaceID != nil && !model.ValidRole(req.Role) {
+		return nil, errors.ErrInvalidRole
+	}
+
+	user := &model.User{Email: email, Name: strings.TrimSpace(req.Name)}
+	if req.Password != "" {
+		hash, err := hashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
+		user.PasswordHash = &hash
+	}
+
+	err = s.repo.CreateUser(ctx, user)
+	if stderrors.Is(err, repository.ErrDuplicateEmail) {
+		return nil, errors.ErrEmailTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+
+	if req.WorkspaceID != nil {
+		err := s.repo.SetMembership(ctx, &model.Membership{UserID: user.ID, WorkspaceID: *req.WorkspaceID, Role: req.Role})
+		if stderrors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.ErrWorkspaceNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+		}
+	}
+	return user, nil
+}
+
+// Login checks the password and starts a session lasting sessionTTL.
+func (s *UserService) Login(ctx context.Context, email, password string) (*Session, error) {
+	user, err := s.repo.GetUserByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil && !stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	if user == nil || user.PasswordHash == nil {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, errors.ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(*user.PasswordHash), []byte(password)) != nil {
+		return nil, errors.ErrInvalidCredentials
+	}
+
+	return s.StartSession(ctx, user)
+}
+
+// StartSession logs the user in for sessionTTL, however they authenticated.
+func (s *UserService) StartSession(ctx context.Context, user *model.User) (*Session, error) {
+	token, err := newToken(SessionPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessions.CreateSession(ctx, hashToken(token), user.ID, s.sessionTTL); err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return &Session{Token: token, ExpiresAt: time.Now().Add(s.sessionTTL), User: user}, nil
+}
+
+func (s *UserService) Logout(ctx context.Context, token string) error {
+	if err := s.sessions.DeleteSession(ctx, hashToken(token)); err != nil {
+		return fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return nil
+}
+
+// Authenticate resolves a session token to its user.
+func (s *UserService) Authenticate(ctx context.Context, token string) (*model.User, error) {
+	userID, err := s.sessions.GetSession(ctx, hashToken(token))
+	if stderrors.Is(err, redis.Nil) {
+		return nil, errors.ErrUnauthorized
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+
+	user, err := s.repo.GetUser(ctx, userID)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.ErrUnauthorized
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return user, nil
+}
+
+// Memberships lists the workspaces the user belongs to, oldest workspace first.
+func (s *UserService) Memberships(ctx context.Context, userID int) ([]model.Membership, error) {
+	memberships, err := s.repo.ListMemberships(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return memberships, nil
+}
+
+// RequestPasswordReset emails the user a single-use reset token. Unknown
+// emails are silently ignored so callers cannot probe for workspaces.
+func (s *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+
+	token, err := newToken(passwordResetPrefix)
+	if err != nil {
+		return err
+	}
+	if err := s.sessions.CreatePasswordReset(ctx, hashToken(token), user.ID, s.resetTTL); err != nil {
+		return fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+
+	if err := s.mailer.Send(ctx, s.resetMessage(user, token)); err != nil {
+		log.Printf("failed to send password reset email to user %d: %v", user.ID, err)
+	}
+	return nil
+}
+
+func (s *UserService) resetMessage(user *model.User, token string) mail.Message {
+	instructions := "Use this token to choose a new password: " + token
+	if link, err := url.Parse(s.resetURL); err == nil && s.resetURL != "" {
+		query := link.Query()
+		query.Set("token", token)
+		link.RawQuery = query.Encode()
+		instructions = "Choose a new password here: " + link.String()
+	}
+
+	return mail.Message{
+		To:      user.Email,
+		Subject: "Reset your smolink password",
+		Body: "Someone asked to reset the password for your smolink workspace.\n\n" +
+			instructions + "\n\n" +
+			"This expires at " + time.Now().Add(s.resetTTL).UTC().Format(time.RFC1123) + ". " +
+			"If you did not ask for it, you can ignore this email.\n",
+	}
+}
+
+// ResetPassword sets a new password with a reset token and revokes every
+// session the user had.
+func (s *UserService) ResetPassword(ctx context.Context, token, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	userID, err := s.sessions.ConsumePasswordReset(ctx, hashToken(token))
+	if stderrors.Is(err, redis.Nil) {
+		return errors.ErrInvalidResetToken
+	}
+	if err != nil {
+		return fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+
+	err = s.repo.UpdatePassword(ctx, userID, hash)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrInvalidResetToken
+	}
+	if err != nil {
+		return fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+
+	if err := s.sessions.DeleteUserSessions(ctx, userID); err != nil {
+		return fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return nil
+}
+
+// canManageMembers lets the admin token and workspace admins and owners manage
+// a workspace's members.
+func canManageMembers(access Access, workspaceID int) bool {
+	return access.Admin || (access.CanUse(workspaceID) && model.RoleAtLeast(access.Role, model.RoleAdmin))
+}
+
+func (s *UserService) ListMembers(ctx context.Context, access Access, workspaceID int) ([]model.Membership, error) {
+	if !canManageMembers(access, workspaceID) {
+		return nil, errors.ErrForbidden
+	}
+	members, err := s.repo.ListWorkspaceMembers(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return members, nil
+}
+
+// SetMember adds a user to the workspace or changes their role. Only owners may
+// grant the owner role or change an owner's membership.
+func (s *UserService) SetMember(ctx context.Context, access Access, workspaceID, userID int, role string) (*model.Membership, error) {
+	if !canManageMembers(access, workspaceID) {
+		return nil, errors.ErrForbidden
+	}
+	if !model.ValidRole(role) {
+		return nil, errors.ErrInvalidRole
+	}
+	if err := s.checkOwnerChange(ctx, access, workspaceID, userID, role); err != nil {
+		return nil, err
+	}
+
+	membership := &model.Membership{UserID: userID, WorkspaceID: workspaceID, Role: role}
+	err := s.repo.SetMembership(ctx, membership)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return membership, nil
+}
+
+func (s *UserService) RemoveMember(ctx context.Context, access Access, workspaceID, userID int) error {
+	if !canManageMembers(access, workspaceID) {
+		return errors.ErrForbidden
+	}
+	if err := s.checkOwnerChange(ctx, access, workspaceID, userID, ""); err != nil {
+		return err
+	}
+
+	err := s.repo.DeleteMembership(ctx, userID, workspaceID)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrMemberNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return nil
+}
+
+// checkOwnerChange stops non-owners from granting the owner role or changing
+// an existing owner's membership.
+func (s *UserService) checkOwnerChange(ctx context.Context, access Access, workspaceID, userID int, role string) error {
+	if access.Admin || access.Role == model.RoleOwner {
+		return nil
+	}
+	if role == model.RoleOwner {
+		return errors.ErrForbidden
+	}
+
+	current, err := s.repo.GetMembership(ctx, userID, workspaceID)
+	if stderrors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	if current.Role == model.RoleOwner {
+		return errors.ErrForbidden
+	}
+	return nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := netmail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > maxEmailLength {
+		return "", errors.ErrInvalidEmail
+	}
+	return email, nil
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return "", errors.ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("%w %v", errors.ErrInternal, err)
+	}
+	return string(hash), nil
+}
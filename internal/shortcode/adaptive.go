@@ -0,0 +1,144 @@
+package shortcode
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"smolink/pkg/utils"
+)
+
+// KeyspaceCounter reports how many stored codes have a given length.
+type KeyspaceCounter interface {
+	CountCodesOfLength(ctx context.Context, length int) (int64, error)
+}
+
+// CollisionObserver is implemented by generators that adapt to collisions.
+type CollisionObserver interface {
+	ObserveCollision()
+	// RetryBudgetExceeded reports that every attempt collided. It returns
+	// true if the generator changed and another round is worth trying.
+	RetryBudgetExceeded() bool
+}
+
+// AdaptiveStats is a point-in-time snapshot of an Adaptive generator.
+type AdaptiveStats struct {
+	Length       int     `json:"length"`
+	MaxLength    int     `json:"maxLength"`
+	Used         int64   `json:"used"`
+	KeyspaceSize float64 `json:"keyspaceSize"`
+	Utilization  float64 `json:"utilization"`
+	Threshold    float64 `json:"threshold"`
+	Collisions   int64   `json:"collisions"`
+	Growths      int64   `json:"growths"`
+}
+
+// Adaptive draws random codes and lengthens them as the keyspace for the
+// current length fills up, either because utilization crossed the threshold
+// or because a request exhausted its retry budget.
+type Adaptive struct {
+	alphabet  string
+	maxLength int
+	threshold float64
+	counter   KeyspaceCounter
+
+	length     atomic.Int64
+	collisions atomic.Int64
+	growths    atomic.Int64
+
+	mu   sync.Mutex
+	used int64
+}
+
+// NewAdaptive starts at length, which must not exceed maxLength.
+func NewAdaptive(alphabet string, length, maxLength int, threshold float64, counter KeyspaceCounter) *Adaptive {
+	g := &Adaptive{
+		alphabet:  alphabet,
+		maxLength: maxLength,
+		threshold: threshold,
+		counter:   counter,
+	}
+	g.length.Store(int64(length))
+	return g
+}
+
+func (g *Adaptive) Length() int {
+	return int(g.length.Load())
+}
+
+func (g *Adaptive) Generate(_ context.Context) (string, error) {
+	return utils.RandomString(g.alphabet, g.Length())
+}
+
+func (g *Adaptive) ObserveCollision() {
+	g.collisions.Add(1)
+}
+
+func (g *Adaptive) RetryBudgetExceeded() bool {
+	return g.grow("retry budget exceeded")
+}
+
+// Refresh recounts the codes of the current length and grows while the
+// keyspace is past the utilization threshold.
+func (g *Adaptive) Refresh(ctx context.Context) error {
+	for {
+		length := g.Length()
+		used, err := g.counter.CountCodesOfLength(ctx, length)
+		if err != nil {
+			return err
+		}
+
+		g.mu.Lock()
+		g.used = used
+		g.mu.Unlock()
+
+		if g.utilization(length, used) < g.threshold || !g.grow("keyspace utilization above threshold") {
+			return nil
+		}
+	}
+}
+
+func (g *Adaptive) Stats() AdaptiveStats {
+	g.mu.Lock()
+	used := g.used
+	g.mu.Unlock()
+
+	length := g.Length()
+	return AdaptiveStats{
+		Length:       length,
+		MaxLength:    g.maxLength,
+		Used:         used,
+		KeyspaceSize: g.keyspaceSize(length),
+		Utilization:  g.utilization(length, used),
+		Threshold:    g.threshold,
+		Collisions:   g.collisions.Load(),
+		Growths:      g.growths.Load(),
+	}
+}
+
+func (g *Adaptive) grow(reason string) bool {
+	for {
+		length := g.length.Load()
+		if int(length) >= g.maxLength {
+			return false
+		}
+		if g.length.CompareAndSwap(length, length+1) {
+			g.growths.Add(1)
+			g.mu.Lock()
+			g.used = 0
+			g.mu.Unlock()
+			log.Printf("short code length increased to %d: %s", length+1, reason)
+			return true
+		}
+	}
+}
+
+func (g *Adaptive) keyspaceSize(length int) float64 {
+	return math.Pow(float64(len([]rune(g.alphabet))), float64(length))
+}
+
+func (g *Adaptive) utilization(length int, used int64) float64 {
+	return float64(used) / g.keyspaceSize(length)
+}
@@ -0,0 +1,160 @@
+package shortcode
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand/v2"
+	"strings"
+
+	"smolink/pkg/utils"
+)
+
+const (
+	StrategyRandom        = "random"
+	StrategySequential    = "sequential"
+	StrategyObfuscated    = "obfuscated"
+	StrategyPronounceable = "pronounceable"
+)
+
+// CodeGenerator produces candidate short codes. Uniqueness is enforced by the
+// database, so a generator may return a code that is already taken.
+type CodeGenerator interface {
+	Generate(ctx context.Context) (string, error)
+}
+
+// Random draws codes of a fixed length from the alphabet.
+type Random struct {
+	Alphabet string
+	Length   int
+}
+
+func (g *Random) Generate(_ context.Context) (string, error) {
+	return utils.RandomString(g.Alphabet, g.Length)
+}
+
+// Sequence hands out monotonically increasing positive integers.
+type Sequence interface {
+	NextCodeSequence(ctx context.Context) (int64, error)
+}
+
+// Sequential encodes the next sequence value in the alphabet, yielding the
+// shortest possible codes at the cost of being guessable.
+type Sequential struct {
+	Sequence Sequence
+	Alphabet string
+}
+
+func (g *Sequential) Generate(ctx context.Context) (string, error) {
+	n, err := g.Sequence.NextCodeSequence(ctx)
+	if err != nil {
+		return "", err
+	}
+	return utils.EncodeBase(uint64(n), g.Alphabet), nil
+}
+
+// obfuscationPrime is coprime with every power of any alphabet size below it,
+// so multiplying by it permutes each fixed-length keyspace.
+const obfuscationPrime = 1_125_899_906_842_597
+
+// Obfuscated maps sequence values to codes of at least MinLength characters
+// through a salted bijection, so consecutive IDs don't produce adjacent codes.
+type Obfuscated struct {
+	sequence  Sequence
+	alphabet  []rune
+	minLength int
+	offset    uint64
+}
+
+func NewObfuscated(sequence Sequence, alphabet string, minLength int, salt string) *Obfuscated {
+	seed := sha256.Sum256([]byte(salt))
+	symbols := []rune(alphabet)
+	rand.New(rand.NewChaCha8(seed)).Shuffle(len(symbols), func(i, j int) {
+		symbols[i], symbols[j] = symbols[j], symbols[i]
+	})
+
+	var offset uint64
+	for _, b := range seed[:8] {
+		offset = offset<<8 | uint64(b)
+	}
+
+	return &Obfuscated{sequence: sequence, alphabet: symbols, minLength: minLength, offset: offset}
+}
+
+func (g *Obfuscated) Generate(ctx context.Context) (string, error) {
+	n, err := g.sequence.NextCodeSequence(ctx)
+	if err != nil {
+		return "", err
+	}
+	return g.Encode(uint64(n))
+}
+
+// Encode permutes n within the smallest keyspace alphabet^length (length >=
+// minLength) that contains it. Values in different keyspaces produce codes
+// of different lengths, so the mapping stays injective overall.
+func (g *Obfuscated) Encode(n uint64) (string, error) {
+	base := uint64(len(g.alphabet))
+	length, space := 0, uint64(1)
+	for length < g.minLength || n >= space {
+		hi, lo := bits.Mul64(space, base)
+		if hi != 0 {
+			return "", errors.New("sequence value exceeds the obfuscated keyspace")
+		}
+		space, length = lo, length+1
+	}
+
+	hi, lo := bits.Mul64(n, obfuscationPrime%space)
+	_, mixed := bits.Div64(hi, lo, space)
+	mixed = (mixed%space + g.offset%space) % space
+
+	out := make([]rune, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = g.alphabet[mixed%base]
+		mixed /= base
+	}
+	return string(out), nil
+}
+
+const (
+	consonants = "bdfghjklmnprstvz"
+	vowels     = "aeiou"
+)
+
+// Pronounceable builds codes from consonant-vowel syllables, e.g. "bakodute".
+type Pronounceable struct {
+	Syllables int
+}
+
+func (g *Pronounceable) Generate(_ context.Context) (string, error) {
+	var b strings.Builder
+	for i := 0; i < g.Syllables; i++ {
+		c, err := utils.RandomString(consonants, 1)
+		if err != nil {
+			return "", err
+		}
+		v, err := utils.RandomString(vowels, 1)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(c + v)
+	}
+	return b.String(), nil
+}
+
+// ValidateAlphabet rejects alphabets that would produce ambiguous codes.
+func ValidateAlphabet(alphabet string) error {
+	symbols := []rune(alphabet)
+	if len(symbols) < 2 {
+		return errors.New("alphabet must contain at least two characters")
+	}
+	seen := make(map[rune]bool, len(symbols))
+	for _, r := range symbols {
+		if seen[r] {
+			return fmt.Errorf("alphabet contains %q more than once", r)
+		}
+		seen[r] = true
+	}
+	return nil
+}
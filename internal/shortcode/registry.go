@@ -0,0 +1,116 @@
+package shortcode
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+type Options struct {
+	DefaultStrategy      string
+	Alphabet             string
+	Length               int
+	MaxLength            int
+	UtilizationThreshold float64
+	Salt                 string
+	Syllables            int
+}
+
+// Store is what the database-backed generators need from the repository.
+type Store interface {
+	Sequence
+	KeyspaceCounter
+}
+
+// Registry holds the available generators keyed by strategy name.
+type Registry struct {
+	generators      map[string]CodeGenerator
+	defaultStrategy string
+	alphabet        string
+	random          *Adaptive
+}
+
+func NewRegistry(opts Options, store Store) (*Registry, error) {
+	if err := ValidateAlphabet(opts.Alphabet); err != nil {
+		return nil, err
+	}
+	if opts.Length < 1 || opts.Length > opts.MaxLength {
+		return nil, fmt.Errorf("code length must lie within 1-%d (got %d)", opts.MaxLength, opts.Length)
+	}
+	if opts.Syllables < 1 {
+		return nil, fmt.Errorf("syllable count must be positive (got %d)", opts.Syllables)
+	}
+
+	random := NewAdaptive(opts.Alphabet, opts.Length, opts.MaxLength, opts.UtilizationThreshold, store)
+	r := &Registry{
+		generators: map[string]CodeGenerator{
+			StrategyRandom:        random,
+			StrategySequential:    &Sequential{Sequence: store, Alphabet: opts.Alphabet},
+			StrategyObfuscated:    NewObfuscated(store, opts.Alphabet, opts.Length, opts.Salt),
+			StrategyPronounceable: &Pronounceable{Syllables: opts.Syllables},
+		},
+		defaultStrategy: opts.DefaultStrategy,
+		alphabet:        opts.Alphabet,
+		random:          random,
+	}
+	if _, ok := r.generators[opts.DefaultStrategy]; !ok {
+		return nil, fmt.Errorf("unknown code strategy %q (available: %v)", opts.DefaultStrategy, r.Strategies())
+	}
+	return r, nil
+}
+
+// Get returns the generator for strategy, or the default one when strategy is empty.
+func (r *Registry) Get(strategy string) (CodeGenerator, bool) {
+	if strategy == "" {
+		strategy = r.defaultStrategy
+	}
+	g, ok := r.generators[strategy]
+	return g, ok
+}
+
+// WithLength is Get, except that random codes are drawn at a fixed length
+// instead of the adaptive one; 0 keeps the adaptive length.
+func (r *Registry) WithLength(strategy string, length int) (CodeGenerator, bool) {
+	g, ok := r.Get(strategy)
+	if ok && length > 0 && g == CodeGenerator(r.random) {
+		return &Random{Alphabet: r.alphabet, Length: length}, true
+	}
+	return g, ok
+}
+
+// Random returns the adaptive random generator so callers can refresh it and
+// report its state.
+func (r *Registry) Random() *Adaptive {
+	return r.random
+}
+
+func (r *Registry) Strategies() []string {
+	names := make([]string, 0, len(r.generators))
+	for name := range r.generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RefreshLoop periodically re-evaluates keyspace utilization until ctx is done.
+// The first refresh runs immediately so a restarted instance picks up the
+// length its predecessors grew to.
+func (r *Registry) RefreshLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.random.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("failed to refresh short code keyspace utilization: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package shortcode
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// suggestionSuffixes are appended to a taken code, after the numeric ones.
+var suggestionSuffixes = []string{"hq", "now", "app", "go", "get"}
+
+// maxPhraseWords bounds the hints that are joined or abbreviated whole.
+const maxPhraseWords = 4
+
+// stopWords carry no meaning in a vanity code.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "of": true, "for": true, "to": true, "in": true,
+	"www": true, "http": true, "https": true, "com": true, "org": true, "net": true, "io": true,
+	"co": true, "html": true, "htm": true, "php": true, "index": true,
+}
+
+// Suggest derives alternative vanity codes from a requested code and free-text
+// hints such as the page title or destination URL, most natural first. The
+// candidates are neither validated nor checked for availability.
+func Suggest(code string, hints ...string) []string {
+	seen := map[string]bool{code: true}
+	var candidates []string
+	add := func(candidate string) {
+		candidate = strings.Trim(candidate, "-_")
+		if candidate != "" && !seen[candidate] {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	codeWords := words(code)
+
+	// Word variants of the requested code
+	add(strings.Join(codeWords, ""))
+	add(strings.Join(codeWords, "-"))
+	if strings.HasSuffix(code, "s") {
+		add(strings.TrimSuffix(code, "s"))
+	} else {
+		add(code + "s")
+	}
+	add(initials(codeWords))
+
+	for _, hint := range hints {
+		hintWords := words(hint)
+
+		// Combinations with the hint and, for short phrases, the phrase itself
+		for _, word := range hintWords {
+			if !contains(codeWords, word) {
+				add(code + "-" + word)
+				add(word + "-" + code)
+			}
+		}
+		if len(hintWords) <= maxPhraseWords {
+			add(strings.Join(hintWords, "-"))
+			add(initials(hintWords))
+			add(code + "-" + initials(hintWords))
+		}
+	}
+
+	// Suffixes
+	for n := 1; n <= 9; n++ {
+		add(code + strconv.Itoa(n))
+	}
+	for _, suffix := range suggestionSuffixes {
+		add(code + "-" + suffix)
+	}
+	return candidates
+}
+
+// words splits s into lowercase alphanumeric words, dropping stop words.
+func words(s string) []string {
+	var result []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !stopWords[word] && !contains(result, word) {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+func initials(words []string) string {
+	if len(words) < 2 {
+		return ""
+	}
+	var b strings.Builder
+	for _, word := range words {
+		b.WriteString(word[:1])
+	}
+	return b.String()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
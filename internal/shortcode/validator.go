@@ -0,0 +1,123 @@
+package shortcode
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"smolink/internal/errors"
+)
+
+//go:embed blocklist.txt
+var defaultBlocklist string
+
+// leetReplacer undoes the substitutions people use to sneak words past filters.
+var leetReplacer = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "@", "a", "$", "s",
+)
+
+// minSubstringTerm is the shortest blocked term matched inside longer codes.
+// Shorter terms only match whole codes, otherwise "ass" would reject "class".
+const minSubstringTerm = 4
+
+type ValidatorOptions struct {
+	Charset      string
+	MinLength    int
+	MaxLength    int
+	Reserved     []string
+	BlockedTerms []string
+}
+
+// Validator decides which codes may be used. Custom codes must pass every
+// check; generated codes are only screened for offensive terms.
+type Validator struct {
+	charset   map[rune]bool
+	minLength int
+	maxLength int
+	reserved  map[string]bool
+	blocked   []string
+}
+
+func NewValidator(opts ValidatorOptions) *Validator {
+	v := &Validator{
+		charset:   make(map[rune]bool),
+		minLength: opts.MinLength,
+		maxLength: opts.MaxLength,
+		reserved:  make(map[string]bool),
+	}
+	for _, r := range opts.Charset {
+		v.charset[r] = true
+	}
+	v.Reserve(opts.Reserved...)
+
+	for _, line := range strings.Split(defaultBlocklist, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			v.blocked = append(v.blocked, line)
+		}
+	}
+	for _, term := range opts.BlockedTerms {
+		if term = strings.TrimSpace(term); term != "" {
+			v.blocked = append(v.blocked, normalize(term))
+		}
+	}
+	return v
+}
+
+// Reserve adds words that may never be used as custom codes. It must be
+// called before the validator is shared between goroutines.
+func (v *Validator) Reserve(words ...string) {
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			v.reserved[strings.ToLower(word)] = true
+		}
+	}
+}
+
+func (v *Validator) ValidateCustom(code string) error {
+	length := len([]rune(code))
+	if length < v.minLength {
+		return errors.ErrCodeTooShort.WithDetails(fmt.Sprintf("custom codes need at least %d characters", v.minLength))
+	}
+	if length > v.maxLength {
+		return errors.ErrCodeTooLong.WithDetails(fmt.Sprintf("custom codes may have at most %d characters", v.maxLength))
+	}
+	for _, r := range code {
+		if !v.charset[r] {
+			return errors.ErrCodeInvalidChars.WithDetails(fmt.Sprintf("%q is not allowed", r))
+		}
+	}
+	if v.IsReserved(code) {
+		return errors.ErrCodeReserved
+	}
+	if v.IsOffensive(code) {
+		return errors.ErrCodeOffensive
+	}
+	return nil
+}
+
+// IsReserved reports whether code would shadow a route or a configured word.
+func (v *Validator) IsReserved(code string) bool {
+	return v.reserved[strings.ToLower(code)]
+}
+
+// IsOffensive reports whether code contains a blocked term.
+func (v *Validator) IsOffensive(code string) bool {
+	normalized := normalize(code)
+	for _, term := range v.blocked {
+		if normalized == term || (len(term) >= minSubstringTerm && strings.Contains(normalized, term)) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize lowercases, reverses leetspeak and drops separators.
+func normalize(code string) string {
+	code = leetReplacer.Replace(strings.ToLower(code))
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r
+		}
+		return -1
+	}, code)
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS url_analytics_url_id_accessed_at_idx;
+ALTER TABLE urls DROP COLUMN IF EXISTS status;
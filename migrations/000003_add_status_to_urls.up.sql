@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'active';
+CREATE INDEX IF NOT EXISTS url_analytics_url_id_accessed_at_idx ON url_analytics (url_id, accessed_at);
@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_type SMALLINT NOT NULL DEFAULT 302;
@@ -0,0 +1 @@
+CREATE SEQUENCE IF NOT EXISTS url_code_seq START WITH 1;
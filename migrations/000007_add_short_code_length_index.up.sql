@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS urls_short_code_length_idx ON urls (length(short_code));
@@ -0,0 +1,10 @@
+-- Links on custom domains cannot be folded back into the single namespace
+DELETE FROM urls WHERE domain_id IS NOT NULL;
+DROP INDEX IF EXISTS urls_domain_short_code_key;
+DROP INDEX IF EXISTS urls_short_code_key;
+ALTER TABLE urls ADD CONSTRAINT urls_short_code_key UNIQUE (short_code);
+ALTER TABLE urls DROP COLUMN IF EXISTS domain_id;
+
+DROP TABLE IF EXISTS domains;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS account_id;
+DROP TABLE IF EXISTS accounts;
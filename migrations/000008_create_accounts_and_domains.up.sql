@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS accounts (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE api_keys ADD COLUMN account_id INTEGER REFERENCES accounts (id) ON DELETE CASCADE;
+
+CREATE TABLE IF NOT EXISTS domains (
+    id SERIAL PRIMARY KEY,
+    account_id INTEGER NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    hostname VARCHAR(253) UNIQUE NOT NULL,
+    verification_token VARCHAR(64) NOT NULL,
+    verified_at TIMESTAMPTZ,
+    root_redirect_url TEXT,
+    not_found_url TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Codes are unique per domain; links without a domain share the default namespace
+ALTER TABLE urls ADD COLUMN domain_id INTEGER REFERENCES domains (id) ON DELETE CASCADE;
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_short_code_key;
+CREATE UNIQUE INDEX IF NOT EXISTS urls_short_code_key ON urls (short_code) WHERE domain_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS urls_domain_short_code_key ON urls (domain_id, short_code) WHERE domain_id IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_redirect_type_check;
+ALTER TABLE urls DROP COLUMN IF EXISTS referrer_policy;
@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN referrer_policy VARCHAR(32);
+ALTER TABLE urls ADD CONSTRAINT urls_redirect_type_check CHECK (redirect_type IN (301, 302, 307, 308));
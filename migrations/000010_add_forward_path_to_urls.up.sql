@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN forward_path BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,5 @@
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_active_window_check;
+ALTER TABLE urls DROP COLUMN IF EXISTS schedule;
+ALTER TABLE urls DROP COLUMN IF EXISTS inactive_url;
+ALTER TABLE urls DROP COLUMN IF EXISTS active_until;
+ALTER TABLE urls DROP COLUMN IF EXISTS active_from;
@@ -0,0 +1,5 @@
+ALTER TABLE urls ADD COLUMN active_from TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN active_until TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN inactive_url TEXT;
+ALTER TABLE urls ADD COLUMN schedule JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE urls ADD CONSTRAINT urls_active_window_check CHECK (active_from IS NULL OR active_until IS NULL OR active_from < active_until);
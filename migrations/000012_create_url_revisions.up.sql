@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS url_revisions (
+    id SERIAL PRIMARY KEY,
+    url_id INTEGER NOT NULL REFERENCES urls (id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    change VARCHAR(16) NOT NULL,
+    restored_from INTEGER,
+    changed_by VARCHAR(128),
+    original_url TEXT NOT NULL,
+    redirect_type INTEGER NOT NULL,
+    referrer_policy VARCHAR(32),
+    forward_path BOOLEAN NOT NULL,
+    active_from TIMESTAMPTZ,
+    active_until TIMESTAMPTZ,
+    inactive_url TEXT,
+    schedule JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (url_id, revision)
+);
+
+-- Existing links start their history at their current settings
+INSERT INTO url_revisions (url_id, revision, change, original_url, redirect_type, referrer_policy, forward_path, active_from, active_until, inactive_url, schedule, created_at)
+SELECT id, 1, 'create', original_url, redirect_type, referrer_policy, forward_path, active_from, active_until, inactive_url, schedule, created_at
+FROM urls;
@@ -0,0 +1,2 @@
+ALTER TABLE urls DROP COLUMN IF EXISTS use_count;
+ALTER TABLE urls DROP COLUMN IF EXISTS max_uses;
@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN max_uses INTEGER CHECK (max_uses > 0);
+ALTER TABLE urls ADD COLUMN use_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE url_revisions DROP COLUMN IF EXISTS require_signature;
+ALTER TABLE urls DROP COLUMN IF EXISTS require_signature;
@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN require_signature BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE url_revisions ADD COLUMN require_signature BOOLEAN NOT NULL DEFAULT false;
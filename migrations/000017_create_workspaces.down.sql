@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS api_keys_workspace_id_idx;
+DROP INDEX IF EXISTS urls_workspace_id_idx;
+ALTER TABLE urls DROP COLUMN IF EXISTS workspace_id;
+
+ALTER INDEX IF EXISTS memberships_workspace_id_idx RENAME TO memberships_account_id_idx;
+ALTER TABLE memberships RENAME COLUMN workspace_id TO account_id;
+ALTER TABLE domains RENAME COLUMN workspace_id TO account_id;
+ALTER TABLE api_keys RENAME COLUMN workspace_id TO account_id;
+
+ALTER TABLE workspaces DROP COLUMN IF EXISTS redirect_type;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS code_length;
+ALTER TABLE workspaces RENAME TO accounts;
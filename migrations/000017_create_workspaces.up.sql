@@ -0,0 +1,15 @@
+-- Accounts become workspaces, which now also own links
+ALTER TABLE accounts RENAME TO workspaces;
+ALTER TABLE workspaces ADD COLUMN code_length INTEGER CHECK (code_length BETWEEN 4 AND 20);
+ALTER TABLE workspaces ADD COLUMN redirect_type INTEGER CHECK (redirect_type IN (301, 302, 307, 308));
+
+ALTER TABLE api_keys RENAME COLUMN account_id TO workspace_id;
+ALTER TABLE domains RENAME COLUMN account_id TO workspace_id;
+ALTER TABLE memberships RENAME COLUMN account_id TO workspace_id;
+ALTER INDEX IF EXISTS memberships_account_id_idx RENAME TO memberships_workspace_id_idx;
+
+-- Links outside any workspace keep a NULL workspace_id
+ALTER TABLE urls ADD COLUMN workspace_id INTEGER REFERENCES workspaces (id) ON DELETE CASCADE;
+UPDATE urls SET workspace_id = domains.workspace_id FROM domains WHERE urls.domain_id = domains.id;
+CREATE INDEX IF NOT EXISTS urls_workspace_id_idx ON urls (workspace_id, id);
+CREATE INDEX IF NOT EXISTS api_keys_workspace_id_idx ON api_keys (workspace_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS workspace_usage;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS quota_clicks_recorded;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS quota_api_requests;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS quota_links_created;
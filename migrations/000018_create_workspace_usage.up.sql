@@ -0,0 +1,14 @@
+-- Monthly quotas per workspace; NULL falls back to the instance default
+ALTER TABLE workspaces ADD COLUMN quota_links_created BIGINT CHECK (quota_links_created > 0);
+ALTER TABLE workspaces ADD COLUMN quota_api_requests BIGINT CHECK (quota_api_requests > 0);
+ALTER TABLE workspaces ADD COLUMN quota_clicks_recorded BIGINT CHECK (quota_clicks_recorded > 0);
+
+-- Usage is counted in Redis and periodically copied here
+CREATE TABLE IF NOT EXISTS workspace_usage (
+    workspace_id INTEGER NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    period DATE NOT NULL,
+    metric VARCHAR(32) NOT NULL,
+    used BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (workspace_id, period, metric)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS urls_canonical_url_idx;
+DROP FUNCTION IF EXISTS canonical_url(TEXT);
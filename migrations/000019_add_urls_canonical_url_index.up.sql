@@ -0,0 +1,37 @@
+-- canonical_url normalizes a destination so equivalent spellings compare
+-- equal: the scheme and authority are lowercased, default ports and empty
+-- query strings dropped, an empty path becomes "/", and query parameters are
+-- sorted by name, repeated ones keeping their order. Anything that is not an
+-- absolute URL is returned unchanged.
+CREATE OR REPLACE FUNCTION canonical_url(url TEXT) RETURNS TEXT
+LANGUAGE plpgsql IMMUTABLE PARALLEL SAFE AS $$
+DECLARE
+    parts TEXT[];
+    scheme TEXT;
+    authority TEXT;
+    query TEXT;
+BEGIN
+    parts := regexp_match(url, '^([A-Za-z][A-Za-z0-9+.-]*)://([^/?#]*)([^?#]*)(?:\?([^#]*))?(#.*)?$');
+    IF parts IS NULL THEN
+        RETURN url;
+    END IF;
+
+    scheme := lower(parts[1]);
+    authority := lower(parts[2]);
+    IF (scheme = 'http' AND authority LIKE '%:80') OR (scheme = 'https' AND authority LIKE '%:443') THEN
+        authority := regexp_replace(authority, ':[0-9]+$', '');
+    END IF;
+
+    SELECT string_agg(param, '&' ORDER BY split_part(param, '=', 1), ord)
+    INTO query
+    FROM regexp_split_to_table(COALESCE(parts[4], ''), '&') WITH ORDINALITY AS params (param, ord)
+    WHERE param <> '';
+
+    RETURN scheme || '://' || authority || COALESCE(NULLIF(parts[3], ''), '/')
+        || COALESCE('?' || query, '') || COALESCE(parts[5], '');
+END;
+$$;
+
+-- Looks up links by destination for reuseExisting. An expression index needs
+-- no backfill and follows every change to original_url.
+CREATE INDEX IF NOT EXISTS urls_canonical_url_idx ON urls USING HASH (canonical_url(original_url));
@@ -0,0 +1,2 @@
+ALTER TABLE url_revisions DROP COLUMN IF EXISTS status;
+ALTER TABLE url_revisions DROP COLUMN IF EXISTS max_uses;
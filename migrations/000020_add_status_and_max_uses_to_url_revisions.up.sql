@@ -0,0 +1,8 @@
+-- Revisions also snapshot the use limit and status. Neither was recorded
+-- before, so existing revisions take the link's current values: max_uses
+-- never changes after creation, and rollbacks then keep the current status.
+ALTER TABLE url_revisions ADD COLUMN max_uses INTEGER;
+ALTER TABLE url_revisions ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active';
+
+UPDATE url_revisions r SET max_uses = u.max_uses, status = u.status
+FROM urls u WHERE u.id = r.url_id;
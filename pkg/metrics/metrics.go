@@ -0,0 +1,68 @@
+// Package metrics exposes values in the Prometheus text exposition format.
+// Metrics are read through callbacks at scrape time, so callers keep owning
+// their state.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	TypeGauge   = "gauge"
+	TypeCounter = "counter"
+)
+
+type metric struct {
+	name  string
+	help  string
+	kind  string
+	value func() float64
+}
+
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+func (r *Registry) Gauge(name, help string, value func() float64) {
+	r.register(metric{name: name, help: help, kind: TypeGauge, value: value})
+}
+
+func (r *Registry) Counter(name, help string, value func() float64) {
+	r.register(metric{name: name, help: help, kind: TypeCounter, value: value})
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics[m.name] = m
+}
+
+// Handler serves every registered metric, sorted by name.
+func (r *Registry) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r.mu.RLock()
+		names := make([]string, 0, len(r.metrics))
+		for name := range r.metrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		for _, name := range names {
+			m := r.metrics[name]
+			fmt.Fprintf(c.Writer, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", m.name, m.help, m.name, m.kind, m.name, m.value())
+		}
+		r.mu.RUnlock()
+	}
+}
@@ -2,49 +2,58 @@ package utils
 
 import (
 	"crypto/rand"
-	"encoding/base64"
-	"strings"
-	"time"
-
-	mathrand "math/rand"
+	"errors"
 )
 
-var charset = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+// Base62Alphabet contains only characters that need no escaping in a URL path.
+const Base62Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
-func GenerateShortCode(length int) string {
-	r := mathrand.New(mathrand.NewSource(time.Now().UnixNano()))
+// RandomString returns a cryptographically random string drawn uniformly from
+// alphabet. Bytes that would bias the distribution are rejected and redrawn.
+func RandomString(alphabet string, length int) (string, error) {
+	symbols := []rune(alphabet)
+	if len(symbols) < 2 || len(symbols) > 256 {
+		return "", errors.New("alphabet must contain between 2 and 256 characters")
+	}
 
-	b := make([]rune, length)
-	for i := range b {
-		b[i] = charset[r.Intn(len(charset))]
+	// Largest multiple of the alphabet size that fits in a byte
+	limit := 256 - 256%len(symbols)
+	out := make([]rune, 0, length)
+	buf := make([]byte, length+length/2)
+
+	for len(out) < length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			out = append(out, symbols[int(b)%len(symbols)])
+			if len(out) == length {
+				break
+			}
+		}
 	}
 
-	return string(b)
+	return string(out), nil
 }
 
-func GenerateShortCodeSecure(length int) (string, error) {
-	// Calculate how many bytes we need
-	byteLength := (length * 6) / 8 // 6 bits per character in base64
-	if (length*6)%8 != 0 {
-		byteLength++
+// EncodeBase writes n in positional notation using alphabet as the digits.
+func EncodeBase(n uint64, alphabet string) string {
+	symbols := []rune(alphabet)
+	base := uint64(len(symbols))
+	if n == 0 {
+		return string(symbols[0])
 	}
 
-	// Generate random bytes
-	randomBytes := make([]byte, byteLength)
-	_, err := rand.Read(randomBytes)
-	if err != nil {
-		return "", err
+	var out []rune
+	for n > 0 {
+		out = append(out, symbols[n%base])
+		n /= base
 	}
-
-	// Encode to base64 and truncate to desired length
-	encoded := base64.URLEncoding.EncodeToString(randomBytes)
-	encoded = strings.ReplaceAll(encoded, "+", "")
-	encoded = strings.ReplaceAll(encoded, "/", "")
-	encoded = strings.ReplaceAll(encoded, "=", "")
-
-	if len(encoded) > length {
-		encoded = encoded[:length]
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
 	}
-
-	return encoded, nil
+	return string(out)
 }
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ErrUnsafePath is returned by ForwardURL for paths that try to climb out of
+// the destination's path.
+var ErrUnsafePath = errors.New("forwarded path is not allowed")
+
+// ForwardURL appends a decoded request path and raw query string to
+// destination. The destination's scheme, host and fragment are kept as they
+// are, "." and ".." segments are rejected, empty segments collapse, and query
+// parameters the destination already sets cannot be overridden.
+func ForwardURL(destination, path, rawQuery string) (string, error) {
+	target, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	if path != "" {
+		parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+		segments := make([]string, 0, len(parts))
+		for i, segment := range parts {
+			if segment == "." || segment == ".." || strings.ContainsRune(segment, '\\') {
+				return "", ErrUnsafePath
+			}
+			// Empty segments collapse, except a trailing slash
+			if segment != "" || i == len(parts)-1 {
+				segments = append(segments, url.PathEscape(segment))
+			}
+		}
+
+		// Build the escaped form ourselves so segments that contained an
+		// encoded slash stay in one piece.
+		base := strings.TrimSuffix(target.EscapedPath(), "/")
+		joined := base + "/" + strings.Join(segments, "/")
+		unescaped, err := url.PathUnescape(joined)
+		if err != nil {
+			return "", err
+		}
+		target.Path, target.RawPath = unescaped, joined
+	}
+
+	if rawQuery != "" {
+		extra, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return "", err
+		}
+		query := target.Query()
+		for key, values := range extra {
+			if _, taken := query[key]; !taken {
+				query[key] = values
+			}
+		}
+		target.RawQuery = query.Encode()
+	}
+
+	return target.String(), nil
+}
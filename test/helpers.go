@@ -13,8 +13,12 @@ import (
 )
 
 func (app *TestApp) ResetState() {
-	_, _ = app.PGRepo.DB().Exec(context.Background(), "TRUNCATE urls, url_analytics RESTART IDENTITY CASCADE")
+	_, _ = app.PGRepo.DB().Exec(context.Background(), "TRUNCATE urls, url_analytics, url_revisions, api_keys, domains, memberships, users, workspace_usage, workspaces RESTART IDENTITY CASCADE")
 	_ = app.RedisRepo.Client().FlushDB(context.Background()).Err()
+	app.URLCache.PurgeLocal()
+	app.DomainService.ForgetHosts()
+	app.UsageService.ForgetQuotas()
+	app.Mailer.Reset()
 }
 
 func CreateTestRequest(
@@ -56,3 +60,10 @@ func ParseResponse(t *testing.T, w *httptest.ResponseRecorder, dest interface{})
 	}
 	assert.NoError(t, err)
 }
+
+// StubResolver answers TXT lookups from a map instead of DNS.
+type StubResolver map[string][]string
+
+func (r StubResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	return r[name], nil
+}
@@ -0,0 +1,290 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/routes"
+	"smolink/test"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AdminControllerTestSuite struct {
+	suite.Suite
+	app *test.TestApp
+}
+
+func (suite *AdminControllerTestSuite) SetupSuite() {
+	suite.app = test.SetupTestApp()
+}
+
+func (suite *AdminControllerTestSuite) TearDownSuite() {
+	suite.app.Cleanup()
+}
+
+func (suite *AdminControllerTestSuite) SetupTest() {
+	suite.app.ResetState()
+}
+
+const (
+	adminLinksEndpoint   = routes.APIPrefix + routes.AdminPrefix + routes.ShortenURLPath
+	adminAPIKeysEndpoint = routes.APIPrefix + routes.AdminPrefix + routes.APIKeysPath
+)
+
+func (suite *AdminControllerTestSuite) TestAdminRoutes_RequireToken() {
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint, nil, "")
+	suite.Equal(http.StatusUnauthorized, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint, nil, "not-a-real-key")
+	suite.Equal(http.StatusUnauthorized, w.Code)
+
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrUnauthorized.Code, resp["code"])
+}
+
+func (suite *AdminControllerTestSuite) TestListLinks_Success() {
+	suite.Require().NoError(suite.app.SeedShortURL("golang", "https://golang.org"))
+	suite.Require().NoError(suite.app.SeedShortURL("gopher", "https://go.dev"))
+
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint+"?limit=1", nil, test.TestAdminToken)
+	suite.Equal(http.StatusOK, w.Code)
+
+	var resp struct {
+		Links []model.URL `json:"links"`
+		Total int         `json:"total"`
+	}
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(2, resp.Total)
+	suite.Require().Len(resp.Links, 1)
+	suite.Equal("gopher", resp.Links[0].ShortCode)
+}
+
+func (suite *AdminControllerTestSuite) TestDisableLink_StopsRedirects() {
+	shortCode := "golang"
+	suite.Require().NoError(suite.app.SeedShortURL(shortCode, "https://golang.org"))
+
+	// Warm the cache so disabling has to evict it
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+shortCode, nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, adminLinksEndpoint+"/"+shortCode+"/disable", nil, test.TestAdminToken)
+	suite.Equal(http.StatusOK, w.Code)
+
+	var link model.URL
+	test.ParseResponse(suite.T(), w, &link)
+	suite.Equal(model.URLStatusDisabled, link.Status)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+shortCode, nil, "")
+	suite.Equal(http.StatusGone, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, adminLinksEndpoint+"/"+shortCode+"/enable", nil, test.TestAdminToken)
+	suite.Equal(http.StatusOK, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+shortCode, nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+}
+
+func (suite *AdminControllerTestSuite) TestDeleteLink_Success() {
+	shortCode := "golang"
+	suite.Require().NoError(suite.app.SeedShortURL(shortCode, "https://golang.org"))
+
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodDelete, adminLinksEndpoint+"/"+shortCode, nil, test.TestAdminToken)
+	suite.Equal(http.StatusNoContent, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+shortCode, nil, "")
+	suite.Equal(http.StatusNotFound, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodDelete, adminLinksEndpoint+"/"+shortCode, nil, test.TestAdminToken)
+	suite.Equal(http.StatusNotFound, w.Code)
+}
+
+func (suite *AdminControllerTestSuite) TestLinkStats_CountsClicks() {
+	shortCode := "golang"
+	suite.Require().NoError(suite.app.SeedShortURL(shortCode, "https://golang.org"))
+
+	for i := 0; i < 3; i++ {
+		w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+shortCode, nil, "")
+		suite.Equal(http.StatusFound, w.Code)
+	}
+
+	suite.Eventually(func() bool {
+		w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint+"/"+shortCode+"/stats", nil, test.TestAdminToken)
+		var stats model.URLStats
+		test.ParseResponse(suite.T(), w, &stats)
+		return stats.TotalClicks == 3 && len(stats.DailyClicks) == 1
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func (suite *AdminControllerTestSuite) TestLinkStats_HeadRequestsAreNotCounted() {
+	shortCode := "golang"
+	suite.Require().NoError(suite.app.SeedShortURL(shortCode, "https://golang.org"))
+
+	for i := 0; i < 2; i++ {
+		w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodHead, "/"+shortCode, nil, "")
+		suite.Equal(http.StatusFound, w.Code)
+		suite.Equal("https://golang.org", w.Header().Get("Location"))
+	}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/"+shortCode, nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+
+	suite.Eventually(func() bool {
+		w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint+"/"+shortCode, nil, test.TestAdminToken)
+		var link model.URL
+		test.ParseResponse(suite.T(), w, &link)
+		return link.ClickCount == 1
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func (suite *AdminControllerTestSuite) TestUpdateLink_RedirectSettings() {
+	shortCode := "golang"
+	suite.Require().NoError(suite.app.SeedShortURL(shortCode, "https://golang.org"))
+
+	payload := map[string]interface{}{"redirectType": http.StatusTemporaryRedirect, "referrerPolicy": "origin"}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, adminLinksEndpoint+"/"+shortCode, payload, test.TestAdminToken)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/"+shortCode, nil, "")
+	suite.Equal(http.StatusTemporaryRedirect, w.Code)
+	suite.Equal("https://golang.org", w.Header().Get("Location"))
+	suite.Equal("origin", w.Header().Get("Referrer-Policy"))
+}
+
+func (suite *AdminControllerTestSuite) TestUpdateLink_ActiveWindow() {
+	shortCode := "golang"
+	endpoint := adminLinksEndpoint + "/" + shortCode
+	suite.Require().NoError(suite.app.SeedShortURL(shortCode, "https://golang.org"))
+
+	payload := map[string]interface{}{"activeUntil": time.Now().Add(-time.Minute).Format(time.RFC3339)}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, endpoint, payload, test.TestAdminToken)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/"+shortCode, nil, "")
+	suite.Equal(http.StatusNotFound, w.Code)
+
+	// A window starting after it ends is rejected by the database check
+	payload = map[string]interface{}{"activeFrom": time.Now().Format(time.RFC3339)}
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, endpoint, payload, test.TestAdminToken)
+	suite.Equal(http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrInvalidSchedule.Code, resp["code"])
+
+	payload = map[string]interface{}{"activeUntil": ""}
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, endpoint, payload, test.TestAdminToken)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var link model.URL
+	test.ParseResponse(suite.T(), w, &link)
+	suite.Nil(link.ActiveUntil)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/"+shortCode, nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+}
+
+func (suite *AdminControllerTestSuite) TestLinkHistoryAndRollback() {
+	payload := map[string]string{"url": "https://golang.org", "customCode": "golang"}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	endpoint := adminLinksEndpoint + "/golang"
+	for _, destination := range []string{"https://go.dev", "https://pkg.go.dev"} {
+		w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, endpoint, map[string]string{"url": destination}, test.TestAdminToken)
+		suite.Require().Equal(http.StatusOK, w.Code)
+	}
+
+	// Warm the cache so the rollback has to invalidate it
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/golang", nil, "")
+	suite.Equal("https://pkg.go.dev", w.Header().Get("Location"))
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, endpoint+"/rollback/1", nil, test.TestAdminToken)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/golang", nil, "")
+	suite.Equal("https://golang.org", w.Header().Get("Location"))
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, endpoint+"/history", nil, test.TestAdminToken)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var resp struct {
+		Revisions []model.URLRevision `json:"revisions"`
+	}
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Require().Len(resp.Revisions, 4)
+	latest := resp.Revisions[0]
+	suite.Equal(4, latest.Revision)
+	suite.Equal(model.RevisionRollback, latest.Change)
+	suite.Equal(1, *latest.RestoredFrom)
+	suite.Equal("admin", *latest.ChangedBy)
+	suite.Equal("https://golang.org", latest.OriginalURL)
+	suite.Equal("https://go.dev", resp.Revisions[2].OriginalURL)
+	suite.Equal(model.RevisionCreate, resp.Revisions[3].Change)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, endpoint+"/rollback/9", nil, test.TestAdminToken)
+	suite.Equal(http.StatusNotFound, w.Code)
+	var errResp map[string]string
+	test.ParseResponse(suite.T(), w, &errResp)
+	suite.Equal(errors.ErrRevisionNotFound.Code, errResp["code"])
+}
+
+func (suite *AdminControllerTestSuite) TestStatusChangesAreInHistory() {
+	payload := map[string]interface{}{"url": "https://golang.org", "customCode": "golang", "maxUses": 3}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	endpoint := adminLinksEndpoint + "/golang"
+	for _, action := range []string{"/disable", "/enable"} {
+		w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, endpoint+action, nil, test.TestAdminToken)
+		suite.Require().Equal(http.StatusOK, w.Code)
+	}
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, endpoint+"/history", nil, test.TestAdminToken)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var resp struct {
+		Revisions []model.URLRevision `json:"revisions"`
+	}
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Require().Len(resp.Revisions, 3)
+	for i, status := range []string{model.URLStatusActive, model.URLStatusDisabled, model.URLStatusActive} {
+		revision := resp.Revisions[len(resp.Revisions)-1-i]
+		suite.Equal(status, revision.Status)
+		suite.Require().NotNil(revision.MaxUses)
+		suite.Equal(3, *revision.MaxUses)
+	}
+	suite.Equal(model.RevisionStatus, resp.Revisions[0].Change)
+	suite.Equal("admin", *resp.Revisions[0].ChangedBy)
+
+	// Rolling back restores the status
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, endpoint+"/rollback/2", nil, test.TestAdminToken)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/golang", nil, "")
+	suite.Equal(http.StatusGone, w.Code)
+}
+
+func (suite *AdminControllerTestSuite) TestAPIKeyLifecycle() {
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, adminAPIKeysEndpoint, map[string]string{"name": "ops"}, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	var created struct {
+		Key   model.APIKey `json:"key"`
+		Token string       `json:"token"`
+	}
+	test.ParseResponse(suite.T(), w, &created)
+	suite.NotEmpty(created.Token)
+	suite.Equal("ops", created.Key.Name)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint, nil, created.Token)
+	suite.Equal(http.StatusOK, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodDelete, fmt.Sprintf("%s/%d", adminAPIKeysEndpoint, created.Key.ID), nil, test.TestAdminToken)
+	suite.Equal(http.StatusNoContent, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint, nil, created.Token)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func TestAdminControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(AdminControllerTestSuite))
+}
@@ -0,0 +1,323 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/repository"
+	"smolink/internal/routes"
+	"smolink/internal/service"
+	"smolink/test"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	workspacesEndpoint = routes.APIPrefix + routes.AdminPrefix + routes.WorkspacesPath
+	domainsEndpoint    = routes.APIPrefix + routes.AdminPrefix + routes.DomainsPath
+	apiKeysEndpoint    = routes.APIPrefix + routes.AdminPrefix + routes.APIKeysPath
+	brandHost          = "go.brand.test"
+)
+
+type DomainControllerTestSuite struct {
+	suite.Suite
+	app      *test.TestApp
+	resolver test.StubResolver
+}
+
+func (suite *DomainControllerTestSuite) SetupSuite() {
+	suite.app = test.SetupTestApp()
+}
+
+func (suite *DomainControllerTestSuite) TearDownSuite() {
+	suite.app.Cleanup()
+}
+
+func (suite *DomainControllerTestSuite) SetupTest() {
+	suite.app.ResetState()
+	suite.resolver = test.StubResolver{}
+	suite.app.DomainService.UseResolver(suite.resolver)
+}
+
+// createWorkspace returns the new workspace's ID and an API key bound to it.
+func (suite *DomainControllerTestSuite) createWorkspace(name string) (int, string) {
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, workspacesEndpoint, map[string]string{"name": name}, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var workspace model.Workspace
+	test.ParseResponse(suite.T(), w, &workspace)
+
+	payload := map[string]interface{}{"name": name + " key", "workspaceId": workspace.ID}
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, apiKeysEndpoint, payload, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var resp struct {
+		Token string `json:"token"`
+	}
+	test.ParseResponse(suite.T(), w, &resp)
+	return workspace.ID, resp.Token
+}
+
+func (suite *DomainControllerTestSuite) createVerifiedDomain(token string, payload map[string]interface{}) model.Domain {
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, domainsEndpoint, payload, token)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var domain model.Domain
+	test.ParseResponse(suite.T(), w, &domain)
+
+	suite.resolver[domain.VerificationRecord()] = []string{"unrelated", domain.VerificationToken}
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, domainsEndpoint+"/"+strconv.Itoa(domain.ID)+"/verify", nil, token)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	test.ParseResponse(suite.T(), w, &domain)
+	suite.Require().True(domain.Verified())
+	return domain
+}
+
+func (suite *DomainControllerTestSuite) requestOnHost(method, host, path string, body interface{}, token string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		suite.Require().NoError(json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Host = host
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	suite.app.Router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *DomainControllerTestSuite) TestVerificationNeedsTXTRecord() {
+	_, token := suite.createWorkspace("brand")
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, domainsEndpoint, map[string]string{"hostname": "Go.Brand.Test."}, token)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var domain model.Domain
+	test.ParseResponse(suite.T(), w, &domain)
+	suite.Equal(brandHost, domain.Hostname)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, domainsEndpoint+"/"+strconv.Itoa(domain.ID)+"/verify", nil, token)
+	suite.Equal(http.StatusUnprocessableEntity, w.Code)
+
+	// Links cannot be created on an unverified domain
+	payload := map[string]string{"url": "https://golang.org", "customCode": "launch", "domain": brandHost}
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, token)
+	suite.Equal(http.StatusConflict, w.Code)
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrDomainNotVerified.Code, resp["code"])
+}
+
+func (suite *DomainControllerTestSuite) TestCodesAreScopedPerDomain() {
+	_, token := suite.createWorkspace("brand")
+	suite.createVerifiedDomain(token, map[string]interface{}{"hostname": brandHost})
+	suite.Require().NoError(suite.app.SeedShortURL("launch", "https://golang.org"))
+
+	payload := map[string]string{"url": "https://brand.test/launch", "customCode": "launch", "domain": brandHost}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, token)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal("https://"+brandHost+"/launch", resp["shortUrl"])
+
+	w = suite.requestOnHost(http.MethodGet, brandHost+":443", "/launch", nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal("https://brand.test/launch", w.Header().Get("Location"))
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/launch", nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal("https://golang.org", w.Header().Get("Location"))
+}
+
+func (suite *DomainControllerTestSuite) TestUnknownHostsUseDefaultNamespace() {
+	_, token := suite.createWorkspace("brand")
+	suite.createVerifiedDomain(token, map[string]interface{}{"hostname": brandHost})
+
+	domain, err := suite.app.DomainService.ForHost(context.Background(), "unknown.brand.test")
+	suite.Require().NoError(err)
+	suite.Nil(domain)
+	domain, err = suite.app.DomainService.ForHost(context.Background(), "GO.Brand.Test:8080")
+	suite.Require().NoError(err)
+	suite.Require().NotNil(domain)
+	suite.Equal(brandHost, domain.Hostname)
+}
+
+func (suite *DomainControllerTestSuite) TestHostLookupFailureIsUnavailable() {
+	pool, err := pgxpool.New(context.Background(), os.Getenv("POSTGRES_DSN"))
+	suite.Require().NoError(err)
+	pool.Close()
+	domains := service.NewDomainService(repository.NewPostgresRepository(pool), suite.resolver, time.Minute)
+
+	_, err = domains.ForHost(context.Background(), brandHost)
+	suite.ErrorIs(err, errors.ErrUnavailable)
+}
+
+func (suite *DomainControllerTestSuite) TestHostLookupKeepsDomainsWhileDatabaseIsDown() {
+	_, token := suite.createWorkspace("brand")
+	suite.createVerifiedDomain(token, map[string]interface{}{"hostname": brandHost})
+
+	pool, err := pgxpool.New(context.Background(), os.Getenv("POSTGRES_DSN"))
+	suite.Require().NoError(err)
+	domains := service.NewDomainService(repository.NewPostgresRepository(pool), suite.resolver, time.Minute)
+	domain, err := domains.ForHost(context.Background(), brandHost)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(domain)
+
+	// Forgetting the hosts forces a reload, which now fails
+	pool.Close()
+	domains.ForgetHosts()
+	domain, err = domains.ForHost(context.Background(), brandHost)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(domain)
+	suite.Equal(brandHost, domain.Hostname)
+}
+
+func (suite *DomainControllerTestSuite) TestDomainPages() {
+	_, token := suite.createWorkspace("brand")
+	suite.createVerifiedDomain(token, map[string]interface{}{
+		"hostname":        brandHost,
+		"rootRedirectUrl": "https://brand.test",
+		"notFoundUrl":     "https://brand.test/404",
+	})
+
+	w := suite.requestOnHost(http.MethodGet, brandHost, "/", nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal("https://brand.test", w.Header().Get("Location"))
+
+	w = suite.requestOnHost(http.MethodGet, brandHost, "/missing", nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal("https://brand.test/404", w.Header().Get("Location"))
+
+	// The default namespace keeps its JSON 404
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/missing", nil, "")
+	suite.Equal(http.StatusNotFound, w.Code)
+}
+
+func (suite *DomainControllerTestSuite) TestDomainsAreOwnedByWorkspaces() {
+	_, token := suite.createWorkspace("brand")
+	_, otherToken := suite.createWorkspace("rival")
+	domain := suite.createVerifiedDomain(token, map[string]interface{}{"hostname": brandHost})
+
+	payload := map[string]string{"url": "https://golang.org", "domain": brandHost}
+	for _, caller := range []string{otherToken, ""} {
+		w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, caller)
+		suite.Equal(http.StatusNotFound, w.Code)
+		var resp map[string]string
+		test.ParseResponse(suite.T(), w, &resp)
+		suite.Equal(errors.ErrDomainNotFound.Code, resp["code"])
+	}
+
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, domainsEndpoint+"/"+strconv.Itoa(domain.ID), nil, otherToken)
+	suite.Equal(http.StatusNotFound, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, workspacesEndpoint, map[string]string{"name": "sneaky"}, token)
+	suite.Equal(http.StatusForbidden, w.Code)
+}
+
+func (suite *DomainControllerTestSuite) TestLinksAreIsolatedPerWorkspace() {
+	brandID, token := suite.createWorkspace("brand")
+	_, otherToken := suite.createWorkspace("rival")
+	suite.Require().NoError(suite.app.SeedWorkspaceURL(brandID, "launch", "https://brand.test/launch"))
+	suite.Require().NoError(suite.app.SeedShortURL("public", "https://golang.org"))
+
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint, nil, token)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var list struct {
+		Links []model.URL `json:"links"`
+		Total int         `json:"total"`
+	}
+	test.ParseResponse(suite.T(), w, &list)
+	suite.Equal(1, list.Total)
+	suite.Require().Len(list.Links, 1)
+	suite.Equal("launch", list.Links[0].ShortCode)
+
+	for _, path := range []string{"/launch", "/launch/stats", "/launch/history"} {
+		w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint+path, nil, otherToken)
+		suite.Equal(http.StatusNotFound, w.Code, path)
+	}
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodDelete, adminLinksEndpoint+"/launch", nil, otherToken)
+	suite.Equal(http.StatusNotFound, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint+"/public", nil, token)
+	suite.Equal(http.StatusNotFound, w.Code)
+
+	// Links made with the key belong to its workspace; redirects serve everyone's
+	payload := map[string]string{"url": "https://brand.test/new", "customCode": "new"}
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, token)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint+"/new", nil, token)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var link model.URL
+	test.ParseResponse(suite.T(), w, &link)
+	suite.Require().NotNil(link.WorkspaceID)
+	suite.Equal(brandID, *link.WorkspaceID)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/launch", nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+
+	// Keys of other workspaces are invisible too
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, apiKeysEndpoint, nil, otherToken)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var keys struct {
+		Keys []model.APIKey `json:"keys"`
+	}
+	test.ParseResponse(suite.T(), w, &keys)
+	suite.Require().Len(keys.Keys, 1)
+	suite.Equal("rival key", keys.Keys[0].Name)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodDelete, apiKeysEndpoint+"/1", nil, otherToken)
+	suite.Equal(http.StatusNotFound, w.Code)
+}
+
+func (suite *DomainControllerTestSuite) TestWorkspaceSettingsApplyToNewLinks() {
+	brandID, token := suite.createWorkspace("brand")
+	_, otherToken := suite.createWorkspace("rival")
+	workspaceEndpoint := workspacesEndpoint + "/" + strconv.Itoa(brandID)
+
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, workspaceEndpoint, map[string]int{"codeLength": 12, "redirectType": 301}, otherToken)
+	suite.Equal(http.StatusNotFound, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, workspaceEndpoint, map[string]int{"codeLength": 2}, token)
+	suite.Equal(http.StatusBadRequest, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, workspaceEndpoint, map[string]int{"redirectType": 200}, token)
+	suite.Equal(http.StatusBadRequest, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, workspaceEndpoint, map[string]int{"codeLength": 12, "redirectType": 301}, token)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var workspace model.Workspace
+	test.ParseResponse(suite.T(), w, &workspace)
+	suite.Require().NotNil(workspace.CodeLength)
+	suite.Equal(12, *workspace.CodeLength)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, map[string]string{"url": "https://brand.test"}, token)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var created map[string]string
+	test.ParseResponse(suite.T(), w, &created)
+	suite.Len(created["shortCode"], 12)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/"+created["shortCode"], nil, "")
+	suite.Equal(http.StatusMovedPermanently, w.Code)
+
+	// Other workspaces keep the instance defaults
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, map[string]string{"url": "https://rival.test"}, otherToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	test.ParseResponse(suite.T(), w, &created)
+	suite.NotEqual(12, len(created["shortCode"]))
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/"+created["shortCode"], nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+
+	// Zero restores the defaults
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, workspaceEndpoint, map[string]int{"codeLength": 0}, token)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	workspace = model.Workspace{}
+	test.ParseResponse(suite.T(), w, &workspace)
+	suite.Nil(workspace.CodeLength)
+	suite.Require().NotNil(workspace.RedirectType)
+	suite.Equal(http.StatusMovedPermanently, *workspace.RedirectType)
+}
+
+func TestDomainControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(DomainControllerTestSuite))
+}
@@ -0,0 +1,54 @@
+package integration
+
+import (
+	"net/http"
+	"smolink/internal/health"
+	"smolink/internal/routes"
+	"smolink/test"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type HealthControllerTestSuite struct {
+	suite.Suite
+	app *test.TestApp
+}
+
+func (suite *HealthControllerTestSuite) SetupSuite() {
+	suite.app = test.SetupTestApp()
+}
+
+func (suite *HealthControllerTestSuite) TearDownSuite() {
+	suite.app.Cleanup()
+}
+
+func (suite *HealthControllerTestSuite) TestLiveness_Success() {
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, routes.LivenessPath, nil, "")
+
+	suite.Equal(http.StatusOK, w.Code)
+
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal("alive", resp["status"])
+}
+
+func (suite *HealthControllerTestSuite) TestReadiness_ReportsComponents() {
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, routes.ReadinessPath, nil, "")
+
+	suite.Equal(http.StatusOK, w.Code)
+
+	var resp health.Report
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(health.StatusHealthy, resp.Status)
+	suite.Require().Contains(resp.Components, "postgres")
+	suite.Require().Contains(resp.Components, "redis")
+	suite.Require().Contains(resp.Components, "migrations")
+	suite.Equal(health.ComponentUp, resp.Components["postgres"].Status)
+	suite.Equal(health.ComponentUp, resp.Components["redis"].Status)
+	suite.Equal(health.ComponentUp, resp.Components["migrations"].Status)
+}
+
+func TestHealthControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthControllerTestSuite))
+}
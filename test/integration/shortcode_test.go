@@ -0,0 +1,142 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"smolink/internal/config"
+	"smolink/internal/errors"
+	"smolink/internal/routes"
+	"smolink/internal/service"
+	"smolink/internal/shortcode"
+	"smolink/test"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ShortCodeTestSuite struct {
+	suite.Suite
+	app *test.TestApp
+}
+
+func (suite *ShortCodeTestSuite) SetupSuite() {
+	suite.app = test.SetupTestApp()
+}
+
+func (suite *ShortCodeTestSuite) TearDownSuite() {
+	suite.app.Cleanup()
+}
+
+func (suite *ShortCodeTestSuite) SetupTest() {
+	suite.app.ResetState()
+}
+
+func (suite *ShortCodeTestSuite) TestAdaptive_GrowsWhenKeyspaceIsSaturated() {
+	generator := shortcode.NewAdaptive("ab", 1, 3, 0.5, suite.app.PGRepo)
+	suite.Require().NoError(suite.app.SeedShortURL("a", "https://golang.org"))
+	suite.Require().NoError(suite.app.SeedShortURL("b", "https://go.dev"))
+	suite.Require().NoError(suite.app.SeedShortURL("ab", "https://pkg.go.dev"))
+
+	suite.Require().NoError(generator.Refresh(context.Background()))
+
+	stats := generator.Stats()
+	suite.Equal(2, stats.Length)
+	suite.Equal(int64(1), stats.Used)
+	suite.InDelta(0.25, stats.Utilization, 0.0001)
+	suite.Equal(int64(1), stats.Growths)
+
+	code, err := generator.Generate(context.Background())
+	suite.Require().NoError(err)
+	suite.Len(code, 2)
+}
+
+func (suite *ShortCodeTestSuite) TestAdaptive_StopsAtMaxLength() {
+	generator := shortcode.NewAdaptive("ab", 1, 2, 0.5, suite.app.PGRepo)
+
+	suite.True(generator.RetryBudgetExceeded())
+	suite.False(generator.RetryBudgetExceeded())
+	suite.Equal(2, generator.Length())
+}
+
+func (suite *ShortCodeTestSuite) TestAdaptive_DoesNotGrowOnReservedCodes() {
+	cfg, err := config.LoadConfig()
+	suite.Require().NoError(err)
+	generators, err := shortcode.NewRegistry(shortcode.Options{
+		DefaultStrategy: shortcode.StrategyRandom, Alphabet: "ab", Length: 1, MaxLength: 3, Syllables: 1,
+	}, suite.app.PGRepo)
+	suite.Require().NoError(err)
+	// Every code the generator can draw is reserved, so nothing ever collides
+	validator := shortcode.NewValidator(shortcode.ValidatorOptions{Reserved: []string{"a", "b"}})
+	urlService := service.NewURLService(suite.app.PGRepo, suite.app.URLCache, generators, validator, suite.app.DomainService, nil, suite.app.UsageService, cfg)
+
+	_, _, err = urlService.ShortenURL(context.Background(), service.ShortenRequest{URL: "https://golang.org"})
+	suite.ErrorIs(err, errors.ErrInternal)
+
+	stats := generators.Random().Stats()
+	suite.Equal(1, stats.Length)
+	suite.Equal(int64(0), stats.Growths)
+	suite.Equal(int64(0), stats.Collisions)
+}
+
+func (suite *ShortCodeTestSuite) TestConfig_RejectsCodesLongerThanTheColumn() {
+	tests := []map[string]string{
+		{"CODE_LENGTH": "21"},
+		{"CODE_LENGTH": "13"},
+		{"CODE_LENGTH": "8", "CODE_MAX_LENGTH": "6"},
+		{"CODE_LENGTH": "0"},
+	}
+	for _, env := range tests {
+		suite.Run(fmt.Sprint(env), func() {
+			for key, value := range env {
+				suite.T().Setenv(key, value)
+			}
+			_, err := config.LoadConfig()
+			suite.Error(err)
+		})
+	}
+}
+
+func (suite *ShortCodeTestSuite) TestConfig_RejectsTooManySyllables() {
+	for _, syllables := range []string{"0", "11"} {
+		suite.Run(syllables, func() {
+			suite.T().Setenv("CODE_SYLLABLES", syllables)
+			_, err := config.LoadConfig()
+			suite.Error(err)
+		})
+	}
+
+	suite.T().Setenv("CODE_SYLLABLES", "10")
+	_, err := config.LoadConfig()
+	suite.NoError(err)
+}
+
+func (suite *ShortCodeTestSuite) TestValidator_BlockedTerms() {
+	validator := shortcode.NewValidator(shortcode.ValidatorOptions{BlockedTerms: []string{"acme"}})
+
+	suite.True(validator.IsOffensive("P0RN"))
+	suite.True(validator.IsOffensive("x-$h1t_y"))
+	suite.True(validator.IsOffensive("4cm3"))
+	suite.True(validator.IsOffensive("ass"))
+	// Short terms only match whole codes
+	suite.False(validator.IsOffensive("classic"))
+	suite.False(validator.IsOffensive("golang"))
+}
+
+func (suite *ShortCodeTestSuite) TestCodeStatsAreExposed() {
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, routes.APIPrefix+routes.AdminPrefix+routes.CodesPath, nil, test.TestAdminToken)
+	suite.Equal(http.StatusOK, w.Code)
+
+	var stats shortcode.AdaptiveStats
+	test.ParseResponse(suite.T(), w, &stats)
+	suite.Equal(6, stats.Length)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, routes.MetricsPath, nil, "")
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Contains(w.Body.String(), "smolink_shortcode_length 6")
+	suite.Contains(w.Body.String(), "smolink_shortcode_keyspace_utilization")
+}
+
+func TestShortCodeTestSuite(t *testing.T) {
+	suite.Run(t, new(ShortCodeTestSuite))
+}
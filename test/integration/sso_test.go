@@ -0,0 +1,164 @@
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"smolink/internal/auth"
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/test"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const ssoLoginEndpoint = authEndpoint + "/oidc/login"
+
+type SSOTestSuite struct {
+	suite.Suite
+	app         *test.TestApp
+	workspaceID int
+}
+
+func (suite *SSOTestSuite) SetupSuite() {
+	suite.app = test.SetupTestApp()
+}
+
+func (suite *SSOTestSuite) TearDownSuite() {
+	suite.app.Cleanup()
+}
+
+// SetupTest creates workspace 1, which the test app's OIDC_GROUP_ROLES maps
+// groups into.
+func (suite *SSOTestSuite) SetupTest() {
+	suite.app.ResetState()
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, workspacesEndpoint, map[string]string{"name": "corp"}, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var workspace model.Workspace
+	test.ParseResponse(suite.T(), w, &workspace)
+	suite.Require().Equal(1, workspace.ID)
+	suite.workspaceID = workspace.ID
+}
+
+// beginLogin returns the provider's authorization URL.
+func (suite *SSOTestSuite) beginLogin() string {
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, ssoLoginEndpoint, nil, "")
+	suite.Require().Equal(http.StatusFound, w.Code)
+	return w.Header().Get("Location")
+}
+
+// authorize logs in at the provider and returns the callback path and query.
+func (suite *SSOTestSuite) authorize(authURL string, identity test.OIDCIdentity) string {
+	suite.app.OIDC.LoginAs(identity)
+	callback, err := suite.app.OIDC.Authorize(authURL)
+	suite.Require().NoError(err)
+	return callback.RequestURI()
+}
+
+func (suite *SSOTestSuite) callback(path string) *httptest.ResponseRecorder {
+	return test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, path, nil, "")
+}
+
+func (suite *SSOTestSuite) login(identity test.OIDCIdentity) (model.User, auth.Principal) {
+	w := suite.callback(suite.authorize(suite.beginLogin(), identity))
+	suite.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+	var session struct {
+		Token string     `json:"token"`
+		User  model.User `json:"user"`
+	}
+	test.ParseResponse(suite.T(), w, &session)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, authEndpoint+"/me", nil, session.Token)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var me struct {
+		Principal auth.Principal `json:"principal"`
+	}
+	test.ParseResponse(suite.T(), w, &me)
+	return session.User, me.Principal
+}
+
+func (suite *SSOTestSuite) TestLoginProvisionsUserAndMapsGroups() {
+	identity := test.OIDCIdentity{
+		Subject:       "00u-ada",
+		Email:         "Ada@Corp.test",
+		EmailVerified: true,
+		Name:          "Ada",
+		Groups:        []string{"staff", "smolink-editors"},
+	}
+
+	user, principal := suite.login(identity)
+	suite.Equal("ada@corp.test", user.Email)
+	suite.Equal("Ada", user.Name)
+	suite.Equal(auth.PrincipalUser, principal.Kind)
+	suite.Require().NotNil(principal.WorkspaceID)
+	suite.Equal(suite.workspaceID, *principal.WorkspaceID)
+	suite.Equal(model.RoleEditor, principal.Role)
+
+	// Later logins reuse the user and follow group changes
+	identity.Groups = []string{"staff"}
+	again, principal := suite.login(identity)
+	suite.Equal(user.ID, again.ID)
+	suite.Equal(model.RoleViewer, principal.Role)
+
+	identity.Groups = nil
+	_, principal = suite.login(identity)
+	suite.Nil(principal.WorkspaceID)
+	suite.Empty(principal.Role)
+
+	// SSO users have no password to log in with
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, authEndpoint+"/login",
+		map[string]string{"email": "ada@corp.test", "password": "anything-at-all"}, "")
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (suite *SSOTestSuite) TestLinksExistingUserByVerifiedEmail() {
+	existing, _, err := suite.app.SeedUser("grace@corp.test", "grace-password", suite.workspaceID, model.RoleOwner)
+	suite.Require().NoError(err)
+
+	// Group sync never demotes owners
+	user, principal := suite.login(test.OIDCIdentity{Subject: "00u-grace", Email: "grace@corp.test", EmailVerified: true})
+	suite.Equal(existing.ID, user.ID)
+	suite.Equal(model.RoleOwner, principal.Role)
+
+	w := suite.callback(suite.authorize(suite.beginLogin(), test.OIDCIdentity{Subject: "00u-mallory", Email: "grace@corp.test", EmailVerified: false, Groups: []string{"smolink-admins"}}))
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrSSOFailed.Code, resp["code"])
+}
+
+func (suite *SSOTestSuite) TestCallbackNeedsItsOwnState() {
+	identity := test.OIDCIdentity{Subject: "00u-ada", Email: "ada@corp.test", EmailVerified: true}
+
+	w := suite.callback(authEndpoint + "/oidc/callback?state=forged&code=whatever")
+	suite.Equal(http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrInvalidSSOState.Code, resp["code"])
+
+	// A state is redeemed once
+	callback := suite.authorize(suite.beginLogin(), identity)
+	suite.Equal(http.StatusOK, suite.callback(callback).Code)
+	suite.Equal(http.StatusBadRequest, suite.callback(callback).Code)
+
+	// A code issued to one attempt fails PKCE under another attempt's state
+	first, err := url.Parse(suite.authorize(suite.beginLogin(), identity))
+	suite.Require().NoError(err)
+	second, err := url.Parse(suite.authorize(suite.beginLogin(), identity))
+	suite.Require().NoError(err)
+	query := first.Query()
+	query.Set("state", second.Query().Get("state"))
+	first.RawQuery = query.Encode()
+	w = suite.callback(first.RequestURI())
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrSSOFailed.Code, resp["code"])
+
+	w = suite.callback(authEndpoint + "/oidc/callback?error=access_denied")
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func TestSSOTestSuite(t *testing.T) {
+	suite.Run(t, new(SSOTestSuite))
+}
@@ -0,0 +1,123 @@
+package integration
+
+import (
+	"context"
+	"smolink/internal/model"
+	"smolink/internal/repository"
+	"smolink/test"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/suite"
+)
+
+type TieredCacheTestSuite struct {
+	suite.Suite
+	app *test.TestApp
+}
+
+func (suite *TieredCacheTestSuite) SetupSuite() {
+	suite.app = test.SetupTestApp()
+}
+
+func (suite *TieredCacheTestSuite) TearDownSuite() {
+	suite.app.Cleanup()
+}
+
+func (suite *TieredCacheTestSuite) SetupTest() {
+	suite.app.ResetState()
+}
+
+var record = &model.LinkRecord{
+	ID:           1,
+	OriginalURL:  "https://golang.org",
+	Status:       model.URLStatusActive,
+	RedirectType: model.DefaultRedirectType,
+}
+
+func (suite *TieredCacheTestSuite) TestLocalTierServesWithoutRedis() {
+	ctx := context.Background()
+	suite.Require().NoError(suite.app.URLCache.SetLink(ctx, "golang", record, time.Hour))
+
+	// Removing the key behind the cache's back leaves the local copy serving
+	suite.Require().NoError(suite.app.RedisRepo.DeleteLink(ctx, "golang"))
+
+	cached, err := suite.app.URLCache.GetLink(ctx, "golang")
+	suite.Require().NoError(err)
+	suite.Equal(record, cached)
+}
+
+func (suite *TieredCacheTestSuite) TestDeleteURL_EvictsOtherInstances() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A second instance sharing the same Redis
+	other := repository.NewTieredCache(suite.app.RedisRepo, 100, time.Minute)
+	go other.Listen(ctx)
+
+	suite.Require().NoError(suite.app.URLCache.SetLink(ctx, "golang", record, time.Hour))
+	cached, err := other.GetLink(ctx, "golang")
+	suite.Require().NoError(err)
+	suite.Equal(record.OriginalURL, cached.OriginalURL)
+
+	suite.Eventually(func() bool {
+		if err := suite.app.URLCache.DeleteLink(ctx, "golang"); err != nil {
+			return false
+		}
+		_, err := other.GetLink(ctx, "golang")
+		return err == redis.Nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func (suite *TieredCacheTestSuite) TestFillsDoNotOverwriteLaterWrites() {
+	ctx := context.Background()
+
+	// A fill with nothing written since its read lands
+	generation, err := suite.app.URLCache.LinkGeneration(ctx, "golang")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.app.URLCache.FillLink(ctx, "golang", generation, record, time.Hour))
+	cached, err := suite.app.URLCache.GetLink(ctx, "golang")
+	suite.Require().NoError(err)
+	suite.Equal(record, cached)
+
+	// The link is disabled and evicted while another read is in flight
+	generation, err = suite.app.URLCache.LinkGeneration(ctx, "golang")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.app.URLCache.DeleteLink(ctx, "golang"))
+	suite.Require().NoError(suite.app.URLCache.FillLink(ctx, "golang", generation, record, time.Hour))
+	_, err = suite.app.URLCache.GetLink(ctx, "golang")
+	suite.Equal(redis.Nil, err)
+
+	// A code read as unknown is created before the negative fill
+	generation, err = suite.app.URLCache.LinkGeneration(ctx, "fresh")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.app.URLCache.SetLink(ctx, "fresh", record, time.Hour))
+	suite.app.URLCache.PurgeLocal()
+	suite.Require().NoError(suite.app.URLCache.FillNotFound(ctx, "fresh", generation, time.Minute))
+	cached, err = suite.app.URLCache.GetLink(ctx, "fresh")
+	suite.Require().NoError(err)
+	suite.Equal(record, cached)
+}
+
+func (suite *TieredCacheTestSuite) TestTimesKeepSubsecondPrecision() {
+	ctx := context.Background()
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 999999000, time.UTC)
+	activeFrom := time.Date(2029, 6, 1, 0, 0, 0, 1000, time.FixedZone("CEST", 2*60*60))
+	timed := *record
+	timed.ExpiresAt = &expiresAt
+	timed.ActiveFrom = &activeFrom
+
+	suite.Require().NoError(suite.app.RedisRepo.SetLink(ctx, "timed", &timed, time.Hour))
+	cached, err := suite.app.RedisRepo.GetLink(ctx, "timed")
+	suite.Require().NoError(err)
+	suite.Require().NotNil(cached.ExpiresAt)
+	suite.Require().NotNil(cached.ActiveFrom)
+	suite.True(expiresAt.Equal(*cached.ExpiresAt), "expires at %s, want %s", cached.ExpiresAt, expiresAt)
+	suite.True(activeFrom.Equal(*cached.ActiveFrom), "active from %s, want %s", cached.ActiveFrom, activeFrom)
+	suite.Nil(cached.ActiveUntil)
+}
+
+func TestTieredCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(TieredCacheTestSuite))
+}
@@ -1,13 +1,28 @@
 package integration
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"smolink/internal/config"
+	"smolink/internal/controller"
 	"smolink/internal/errors"
+	"smolink/internal/model"
 	"smolink/internal/routes"
+	"smolink/internal/service"
+	"smolink/internal/shortcode"
+	"smolink/internal/signing"
 	"smolink/test"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -55,6 +70,7 @@ func (suite *URLControllerTestSuite) TestShortenURLWithCustomCode_Success() {
 	test.ParseResponse(suite.T(), w, &resp)
 	suite.Equal(originalURL, resp["originalUrl"])
 	suite.Equal(shortCode, resp["shortCode"])
+	suite.Equal(test.TestPublicBaseURL+"/"+shortCode, resp["shortUrl"])
 }
 
 func (suite *URLControllerTestSuite) TestShortenURLWithExistingCustomCode_Failure() {
@@ -87,6 +103,63 @@ func (suite *URLControllerTestSuite) TestShortenURLWithInvalidURL_Failure() {
 	suite.Equal(errors.ErrInvalidURL.Message, resp["message"])
 }
 
+func (suite *URLControllerTestSuite) TestShortenURLWithRejectedCustomCode_Failure() {
+	cases := map[string]*errors.APIError{
+		"ab":                        errors.ErrCodeTooShort,
+		"this-code-is-far-too-long": errors.ErrCodeTooLong,
+		"docs/api":                  errors.ErrCodeInvalidChars,
+		"gоlang":                    errors.ErrCodeInvalidChars, // Cyrillic "о"
+		"health":                    errors.ErrCodeReserved,
+		"Admin":                     errors.ErrCodeReserved,
+		"metrics":                   errors.ErrCodeReserved,
+		"sh1t-happens":              errors.ErrCodeOffensive,
+	}
+
+	for code, expected := range cases {
+		payload := map[string]string{"url": "https://golang.org", "customCode": code}
+		w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+
+		suite.Equal(expected.Status, w.Code, code)
+
+		var resp map[string]string
+		test.ParseResponse(suite.T(), w, &resp)
+		suite.Equal(expected.Code, resp["code"], code)
+	}
+}
+
+func (suite *URLControllerTestSuite) TestCodeAvailability() {
+	suite.Require().NoError(suite.app.SeedShortURL("launch", "https://golang.org"))
+	suite.Require().NoError(suite.app.SeedShortURL("launchs", "https://go.dev"))
+
+	var resp model.CodeAvailability
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, availabilityEndpoint("golang"), nil, "")
+	suite.Equal(http.StatusOK, w.Code)
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.True(resp.Available)
+	suite.Empty(resp.Suggestions)
+
+	resp = model.CodeAvailability{}
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, availabilityEndpoint("launch")+"?suggest=true&limit=3&title=Product+Launch", nil, "")
+	suite.Equal(http.StatusOK, w.Code)
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.False(resp.Available)
+	suite.Equal(errors.ErrCodeInUse.Code, resp.Reason)
+	suite.Equal([]string{"launch-product", "product-launch", "launch-pl"}, resp.Suggestions)
+}
+
+func (suite *URLControllerTestSuite) TestCodeAvailability_InvalidCode() {
+	var resp model.CodeAvailability
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, availabilityEndpoint("health"), nil, "")
+	suite.Equal(http.StatusOK, w.Code)
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.False(resp.Available)
+	suite.Equal(errors.ErrCodeReserved.Code, resp.Reason)
+}
+
+func availabilityEndpoint(code string) string {
+	return routes.APIPrefix + routes.CodesPath + "/" + code + routes.AvailabilityPath
+}
+
 func (suite *URLControllerTestSuite) TestShortenURL_InvalidPayload() {
 	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, nil, "")
 	suite.Equal(http.StatusBadRequest, w.Code)
@@ -107,6 +180,327 @@ func (suite *URLControllerTestSuite) TestResolveURL_Success() {
 	suite.Equal(originalURL, w.Header().Get("Location"))
 }
 
+func (suite *URLControllerTestSuite) TestResolveURL_AtRoot() {
+	shortCode, originalURL := "golang", "https://golang.org"
+	suite.Require().NoError(suite.app.SeedShortURL(shortCode, originalURL))
+
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/"+shortCode, nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal(originalURL, w.Header().Get("Location"))
+
+	// Static routes still win over the code parameter
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, routes.LivenessPath, nil, "")
+	suite.Equal(http.StatusOK, w.Code)
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_PermanentRedirectIsCacheable() {
+	payload := map[string]interface{}{
+		"url":            "https://golang.org",
+		"customCode":     "forever",
+		"redirectType":   http.StatusMovedPermanently,
+		"referrerPolicy": "no-referrer",
+	}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/forever", nil, "")
+	suite.Equal(http.StatusMovedPermanently, w.Code)
+	suite.Equal("public, max-age=86400", w.Header().Get("Cache-Control"))
+	suite.NotEmpty(w.Header().Get("Expires"))
+	suite.Equal("no-referrer", w.Header().Get("Referrer-Policy"))
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_PermanentRedirectCachedUntilExpiry() {
+	payload := map[string]interface{}{
+		"url":          "https://golang.org",
+		"customCode":   "shortlived",
+		"redirectType": http.StatusPermanentRedirect,
+		"expiresAt":    time.Now().Add(time.Hour).Format(time.RFC3339),
+	}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/shortlived", nil, "")
+	suite.Equal(http.StatusPermanentRedirect, w.Code)
+	maxAge, err := strconv.Atoi(strings.TrimPrefix(w.Header().Get("Cache-Control"), "public, max-age="))
+	suite.Require().NoError(err)
+	suite.InDelta(3600, maxAge, 5)
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_TemporaryRedirectIsNotCached() {
+	suite.Require().NoError(suite.app.SeedShortURL("golang", "https://golang.org"))
+
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/golang", nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal("private, no-cache", w.Header().Get("Cache-Control"))
+	suite.Empty(w.Header().Get("Referrer-Policy"))
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_ForwardsPathAndQuery() {
+	payload := map[string]interface{}{
+		"url":         "https://docs.example.com/base/?ref=smol",
+		"customCode":  "docs",
+		"forwardPath": true,
+	}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/docs/api/v2?x=1&ref=evil", nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal("https://docs.example.com/base/api/v2?ref=smol&x=1", w.Header().Get("Location"))
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/docs", nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal("https://docs.example.com/base/?ref=smol", w.Header().Get("Location"))
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/docs/a/%2e%2e/admin", nil, "")
+	suite.Equal(http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrInvalidForward.Code, resp["code"])
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_PathWithoutForwarding_Fail() {
+	suite.Require().NoError(suite.app.SeedShortURL("golang", "https://golang.org"))
+
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/golang/doc", nil, "")
+	suite.Equal(http.StatusNotFound, w.Code)
+
+	// A query string alone is ignored rather than forwarded
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/golang?utm_source=mail", nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal("https://golang.org", w.Header().Get("Location"))
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_OutsideActiveWindow() {
+	payload := map[string]interface{}{
+		"url":        "https://golang.org/launch",
+		"customCode": "launch",
+		"activeFrom": time.Now().Add(time.Hour).Format(time.RFC3339),
+	}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/launch", nil, "")
+	suite.Equal(http.StatusNotFound, w.Code)
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrLinkNotActive.Code, resp["code"])
+
+	payload = map[string]interface{}{
+		"url":         "https://golang.org/sale",
+		"customCode":  "sale",
+		"activeFrom":  time.Now().Add(-2 * time.Hour).Format(time.RFC3339),
+		"activeUntil": time.Now().Add(-time.Hour).Format(time.RFC3339),
+		"inactiveUrl": "https://golang.org/sale-over",
+	}
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/sale", nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal("https://golang.org/sale-over", w.Header().Get("Location"))
+	suite.Equal("private, no-cache", w.Header().Get("Cache-Control"))
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_ScheduledDestinations() {
+	payload := map[string]interface{}{
+		"url":          "https://golang.org/v1",
+		"customCode":   "release",
+		"redirectType": http.StatusMovedPermanently,
+		"schedule": []map[string]string{
+			{"url": "https://golang.org/v3", "at": time.Now().Add(time.Hour).Format(time.RFC3339)},
+			{"url": "https://golang.org/v2", "at": time.Now().Add(-time.Minute).Format(time.RFC3339)},
+		},
+	}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/release", nil, "")
+	suite.Equal(http.StatusMovedPermanently, w.Code)
+	suite.Equal("https://golang.org/v2", w.Header().Get("Location"))
+
+	// Browsers must come back when the next destination takes over
+	maxAge, err := strconv.Atoi(strings.TrimPrefix(w.Header().Get("Cache-Control"), "public, max-age="))
+	suite.Require().NoError(err)
+	suite.InDelta(3600, maxAge, 5)
+}
+
+func (suite *URLControllerTestSuite) TestShortenURL_InvalidSchedule_Failure() {
+	now := time.Now()
+	payloads := []map[string]interface{}{
+		{"url": "https://golang.org", "activeFrom": now.Add(time.Hour).Format(time.RFC3339), "activeUntil": now.Format(time.RFC3339)},
+		{"url": "https://golang.org", "schedule": []map[string]string{
+			{"url": "https://golang.org/a", "at": now.Format(time.RFC3339)},
+			{"url": "https://golang.org/b", "at": now.Format(time.RFC3339)},
+		}},
+	}
+	for _, payload := range payloads {
+		w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+		suite.Equal(http.StatusBadRequest, w.Code)
+		var resp map[string]string
+		test.ParseResponse(suite.T(), w, &resp)
+		suite.Equal(errors.ErrInvalidSchedule.Code, resp["code"])
+	}
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_SingleUseUnderConcurrency() {
+	payload := map[string]interface{}{
+		"url":          "https://golang.org/onboarding",
+		"customCode":   "welcome",
+		"redirectType": http.StatusMovedPermanently,
+		"maxUses":      1,
+	}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 20)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/welcome", nil, "")
+			codes[i] = w.Code
+			if w.Code == http.StatusMovedPermanently {
+				// Browsers must not replay a single-use redirect from cache
+				suite.Equal("private, no-cache", w.Header().Get("Cache-Control"))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	used := 0
+	for _, code := range codes {
+		if code == http.StatusMovedPermanently {
+			used++
+		} else {
+			suite.Equal(http.StatusGone, code)
+		}
+	}
+	suite.Equal(1, used)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/welcome", nil, "")
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrLinkUsedUp.Code, resp["code"])
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_HeadDoesNotUseLimitedLink() {
+	payload := map[string]interface{}{"url": "https://golang.org/onboarding", "customCode": "welcome", "maxUses": 1}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	// Link previews send HEAD first
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodHead, "/welcome", nil, "")
+	suite.Equal(http.StatusNoContent, w.Code)
+	suite.Empty(w.Header().Get("Location"))
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/welcome", nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal("https://golang.org/onboarding", w.Header().Get("Location"))
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/welcome", nil, "")
+	suite.Equal(http.StatusGone, w.Code)
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_UsedUpLinkFallback() {
+	payload := map[string]interface{}{
+		"url":         "https://golang.org/invite",
+		"customCode":  "invite",
+		"maxUses":     2,
+		"inactiveUrl": "https://golang.org/invite-used",
+	}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	for _, location := range []string{"https://golang.org/invite", "https://golang.org/invite", "https://golang.org/invite-used"} {
+		w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/invite", nil, "")
+		suite.Equal(http.StatusFound, w.Code)
+		suite.Equal(location, w.Header().Get("Location"))
+	}
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_SignedLinks() {
+	payload := map[string]interface{}{"url": "https://partner.example.com/report", "customCode": "report", "requireSignature": true}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/report", nil, "")
+	suite.Equal(http.StatusForbidden, w.Code)
+
+	signPayload := map[string]interface{}{"expiresAt": time.Now().Add(time.Hour).Format(time.RFC3339)}
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, routes.APIPrefix+routes.AdminPrefix+routes.ShortenURLPath+"/report/sign", signPayload, test.TestAdminToken)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var signed map[string]string
+	test.ParseResponse(suite.T(), w, &signed)
+	suite.Equal("current", signed["keyId"])
+	suite.Require().True(strings.HasPrefix(signed["url"], test.TestPublicBaseURL+"/report?"))
+	signedPath := strings.TrimPrefix(signed["url"], test.TestPublicBaseURL)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, signedPath, nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal("https://partner.example.com/report", w.Header().Get("Location"))
+
+	// Tampering with the expiry breaks the signature
+	tampered := strings.Replace(signedPath, "exp=", "exp=9", 1)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, tampered, nil, "")
+	suite.Equal(http.StatusForbidden, w.Code)
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrInvalidSignature.Code, resp["code"])
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_SignedPermanentLinkIsNotCached() {
+	payload := map[string]interface{}{"url": "https://partner.example.com/report", "customCode": "report", "requireSignature": true, "redirectType": http.StatusMovedPermanently}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	signer, err := signing.NewKeySet(test.TestSigningKeys, "current")
+	suite.Require().NoError(err)
+	query := signer.Sign("report", time.Now().Add(time.Hour))
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/report?"+query.Encode(), nil, "")
+	suite.Equal(http.StatusMovedPermanently, w.Code)
+	suite.Equal("private, no-cache", w.Header().Get("Cache-Control"))
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_SignedLinkKeyRotation() {
+	payload := map[string]interface{}{"url": "https://partner.example.com/report", "customCode": "report", "requireSignature": true}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	// URLs signed before the rotation keep working while their key is listed
+	previous, err := signing.NewKeySet(test.TestSigningKeys, "previous")
+	suite.Require().NoError(err)
+	query := previous.Sign("report", time.Now().Add(time.Hour))
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/report?"+query.Encode(), nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+
+	query = previous.Sign("report", time.Now().Add(-time.Minute))
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/report?"+query.Encode(), nil, "")
+	suite.Equal(http.StatusGone, w.Code)
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrSignatureExpired.Code, resp["code"])
+
+	// Keys that are no longer configured are rejected
+	retired, err := signing.NewKeySet(map[string]string{"retired": "retired-test-signing-key"}, "retired")
+	suite.Require().NoError(err)
+	query = retired.Sign("report", time.Now().Add(time.Hour))
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, "/report?"+query.Encode(), nil, "")
+	suite.Equal(http.StatusForbidden, w.Code)
+}
+
+func (suite *URLControllerTestSuite) TestShortenURL_InvalidRedirectType_Failure() {
+	payload := map[string]interface{}{"url": "https://golang.org", "redirectType": http.StatusSeeOther}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Equal(http.StatusBadRequest, w.Code)
+
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrInvalidRedirect.Code, resp["code"])
+}
+
 func (suite *URLControllerTestSuite) TestResolveURL_ShortCodeDoesNotExist_Fail() {
 	code := "shortCodeThatDoesNotExist"
 	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+code, nil, "")
@@ -118,6 +512,441 @@ func (suite *URLControllerTestSuite) TestResolveURL_ShortCodeDoesNotExist_Fail()
 	suite.Equal(errors.ErrShortCodeNotFound.Message, resp["message"])
 }
 
+func (suite *URLControllerTestSuite) TestResolveURL_UnknownCodeIsNegativelyCached() {
+	code := "notyet"
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+code, nil, "")
+	suite.Equal(http.StatusNotFound, w.Code)
+
+	// Written behind the cache's back, so the negative entry still wins
+	suite.Require().NoError(suite.app.SeedShortURL(code, "https://golang.org"))
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+code, nil, "")
+	suite.Equal(http.StatusNotFound, w.Code)
+
+	ttl, err := suite.app.RedisRepo.Client().TTL(context.Background(), "url:"+code).Result()
+	suite.Require().NoError(err)
+	suite.Positive(ttl)
+	suite.LessOrEqual(ttl, 2*time.Minute)
+}
+
+func (suite *URLControllerTestSuite) TestShortenURL_OverridesNegativeCacheEntry() {
+	code := "later"
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+code, nil, "")
+	suite.Equal(http.StatusNotFound, w.Code)
+
+	payload := map[string]string{"url": "https://golang.org", "customCode": code}
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Equal(http.StatusCreated, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+code, nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_ConcurrentCacheMisses() {
+	shortCode, originalURL := "viral", "https://golang.org"
+	suite.Require().NoError(suite.app.SeedShortURL(shortCode, originalURL))
+
+	var wg sync.WaitGroup
+	codes := make([]int, 50)
+	locations := make([]string, 50)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+shortCode, nil, "")
+			codes[i], locations[i] = w.Code, w.Header().Get("Location")
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range codes {
+		suite.Equal(http.StatusFound, codes[i])
+		suite.Equal(originalURL, locations[i])
+	}
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_ExpiredLinkFromCache() {
+	shortCode := "brief"
+	payload := map[string]interface{}{
+		"url":        "https://golang.org",
+		"customCode": shortCode,
+		"expiresAt":  time.Now().Add(1500 * time.Millisecond).Format(time.RFC3339Nano),
+	}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+shortCode, nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+
+	time.Sleep(2 * time.Second)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+shortCode, nil, "")
+	suite.Equal(http.StatusGone, w.Code)
+
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrLinkExpired.Code, resp["code"])
+}
+
+func (suite *URLControllerTestSuite) TestShortenURL_ExpiryInPast_Failure() {
+	payload := map[string]interface{}{
+		"url":       "https://golang.org",
+		"expiresAt": time.Now().Add(-time.Hour).Format(time.RFC3339),
+	}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Equal(http.StatusBadRequest, w.Code)
+
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrInvalidExpiry.Code, resp["code"])
+}
+
+func (suite *URLControllerTestSuite) TestResolveURL_IgnoresOutdatedCacheEntries() {
+	ctx := context.Background()
+	shortCode, originalURL := "golang", "https://golang.org"
+	suite.Require().NoError(suite.app.SeedShortURL(shortCode, originalURL))
+
+	// Pre-record string format
+	suite.Require().NoError(suite.app.RedisRepo.Client().Set(ctx, "url:"+shortCode, "https://stale.example", 0).Err())
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+shortCode, nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal(originalURL, w.Header().Get("Location"))
+
+	// Record written by a different schema version
+	suite.app.URLCache.PurgeLocal()
+	suite.Require().NoError(suite.app.RedisRepo.Client().Del(ctx, "url:"+shortCode).Err())
+	suite.Require().NoError(suite.app.RedisRepo.Client().HSet(ctx, "url:"+shortCode, "v", "0", "dst", "https://stale.example").Err())
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, shortenURLEndpoint+"/"+shortCode, nil, "")
+	suite.Equal(http.StatusFound, w.Code)
+	suite.Equal(originalURL, w.Header().Get("Location"))
+}
+
+func (suite *URLControllerTestSuite) TestShortenURL_ConcurrentSameCustomCode() {
+	const requests = 20
+	payload := map[string]string{"url": "https://golang.org", "customCode": "race"}
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	codes := make([]int, requests)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+			codes[i] = w.Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	created, conflicts := 0, 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+			conflicts++
+		}
+	}
+	suite.Equal(1, created)
+	suite.Equal(requests-1, conflicts)
+
+	var count int
+	err := suite.app.PGRepo.DB().QueryRow(context.Background(), "SELECT count(*) FROM urls WHERE short_code = 'race'").Scan(&count)
+	suite.Require().NoError(err)
+	suite.Equal(1, count)
+}
+
+func (suite *URLControllerTestSuite) TestShortenURL_Strategies() {
+	patterns := map[string]string{
+		shortcode.StrategyRandom:        `^[0-9a-zA-Z]{6}$`,
+		shortcode.StrategySequential:    `^[0-9a-zA-Z]+$`,
+		shortcode.StrategyObfuscated:    `^[0-9a-zA-Z]{6,}$`,
+		shortcode.StrategyPronounceable: `^([bdfghjklmnprstvz][aeiou]){4}$`,
+	}
+
+	for strategy, pattern := range patterns {
+		seen := map[string]bool{}
+		for i := 0; i < 3; i++ {
+			payload := map[string]string{"url": "https://golang.org", "strategy": strategy}
+			w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+			suite.Require().Equal(http.StatusCreated, w.Code, strategy)
+
+			var resp map[string]string
+			test.ParseResponse(suite.T(), w, &resp)
+			suite.Regexp(pattern, resp["shortCode"], strategy)
+			suite.False(seen[resp["shortCode"]], strategy)
+			seen[resp["shortCode"]] = true
+		}
+	}
+}
+
+func (suite *URLControllerTestSuite) TestShortenURL_UnknownStrategy_Failure() {
+	payload := map[string]string{"url": "https://golang.org", "strategy": "emoji"}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, "")
+	suite.Equal(http.StatusBadRequest, w.Code)
+
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrInvalidStrategy.Code, resp["code"])
+}
+
+func (suite *URLControllerTestSuite) TestShortenURL_ForwardedProtoNeedsTrustedProxy() {
+	cfg, err := config.LoadConfig()
+	suite.Require().NoError(err)
+	cfg.PublicBaseURL = ""
+
+	shorten := func(trustedProxies ...string) string {
+		cfg.TrustedProxies = trustedProxies
+		uc := controller.NewURLController(suite.app.URLService, suite.app.DomainService, service.NewIdempotencyService(suite.app.RedisRepo, cfg), cfg)
+		router := gin.New()
+		router.POST(shortenURLEndpoint, uc.ShortenURL)
+
+		body, err := json.Marshal(map[string]string{"url": "https://golang.org"})
+		suite.Require().NoError(err)
+		req := httptest.NewRequest(http.MethodPost, shortenURLEndpoint, bytes.NewReader(body))
+		req.RemoteAddr = "192.0.2.10:4321"
+		req.Host = "s.example.com"
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		suite.Require().Equal(http.StatusCreated, w.Code)
+
+		var resp map[string]string
+		test.ParseResponse(suite.T(), w, &resp)
+		return resp["shortUrl"]
+	}
+
+	suite.True(strings.HasPrefix(shorten(), "http://s.example.com/"))
+	suite.True(strings.HasPrefix(shorten("203.0.113.0/24"), "http://s.example.com/"))
+	suite.True(strings.HasPrefix(shorten("192.0.2.0/24"), "https://s.example.com/"))
+	suite.True(strings.HasPrefix(shorten("192.0.2.10"), "https://s.example.com/"))
+}
+
+// shortenWithKey shortens anonymously under an Idempotency-Key.
+func (suite *URLControllerTestSuite) shortenWithKey(key string, payload map[string]string) *httptest.ResponseRecorder {
+	body, err := json.Marshal(payload)
+	suite.Require().NoError(err)
+	req := httptest.NewRequest(http.MethodPost, shortenURLEndpoint, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(controller.IdempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	suite.app.Router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *URLControllerTestSuite) countURLs() int {
+	var count int
+	err := suite.app.PGRepo.DB().QueryRow(context.Background(), "SELECT count(*) FROM urls").Scan(&count)
+	suite.Require().NoError(err)
+	return count
+}
+
+func (suite *URLControllerTestSuite) TestShortenURL_IdempotencyKeyReplaysResponse() {
+	payload := map[string]string{"url": "https://golang.org"}
+	first := suite.shortenWithKey("retry-1", payload)
+	suite.Require().Equal(http.StatusCreated, first.Code)
+	suite.Empty(first.Header().Get(controller.IdempotentReplayedHeader))
+
+	retry := suite.shortenWithKey("retry-1", payload)
+	suite.Equal(http.StatusCreated, retry.Code)
+	suite.Equal("true", retry.Header().Get(controller.IdempotentReplayedHeader))
+	suite.JSONEq(first.Body.String(), retry.Body.String())
+	suite.Equal(1, suite.countURLs())
+
+	// Another key creates another link
+	w := suite.shortenWithKey("retry-2", payload)
+	suite.Equal(http.StatusCreated, w.Code)
+	suite.Equal(2, suite.countURLs())
+
+	w = suite.shortenWithKey("retry-1", map[string]string{"url": "https://go.dev"})
+	suite.Equal(http.StatusUnprocessableEntity, w.Code)
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrIdempotencyReused.Code, resp["code"])
+
+	// Client errors are replayed too
+	payload = map[string]string{"url": "https://golang.org", "strategy": "emoji"}
+	suite.Equal(http.StatusBadRequest, suite.shortenWithKey("retry-3", payload).Code)
+	w = suite.shortenWithKey("retry-3", payload)
+	suite.Equal(http.StatusBadRequest, w.Code)
+	suite.Equal("true", w.Header().Get(controller.IdempotentReplayedHeader))
+}
+
+func (suite *URLControllerTestSuite) TestShortenURL_ConcurrentIdempotencyKey() {
+	const requests = 20
+	payload := map[string]string{"url": "https://golang.org"}
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	responses := make([]*httptest.ResponseRecorder, requests)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			responses[i] = suite.shortenWithKey("concurrent", payload)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	// Duplicates arriving while the first is in flight get 409, later ones
+	// its response; only one link is ever created.
+	codes := map[string]bool{}
+	for _, w := range responses {
+		switch w.Code {
+		case http.StatusCreated:
+			var resp map[string]string
+			test.ParseResponse(suite.T(), w, &resp)
+			codes[resp["shortCode"]] = true
+		case http.StatusConflict:
+			var resp map[string]string
+			test.ParseResponse(suite.T(), w, &resp)
+			suite.Equal(errors.ErrRequestInFlight.Code, resp["code"])
+		default:
+			suite.Failf("unexpected status", "%d: %s", w.Code, w.Body.String())
+		}
+	}
+	suite.Len(codes, 1)
+	suite.Equal(1, suite.countURLs())
+
+	w := suite.shortenWithKey("concurrent", payload)
+	suite.Equal(http.StatusCreated, w.Code)
+	suite.Equal(1, suite.countURLs())
+}
+
+func (suite *URLControllerTestSuite) TestIdempotency_LateRequestDoesNotFinishRetry() {
+	cfg, err := config.LoadConfig()
+	suite.Require().NoError(err)
+	idempotency := service.NewIdempotencyService(suite.app.RedisRepo, cfg)
+	ctx := context.Background()
+	payload := map[string]string{"url": "https://golang.org"}
+
+	// The first request's claim is gone by the time it finishes, here
+	// because it released the key; a retry has claimed it since.
+	late, err := idempotency.Begin(ctx, "anonymous", "late", payload)
+	suite.Require().NoError(err)
+	idempotency.Finish(ctx, late, http.StatusInternalServerError, nil)
+	retry, err := idempotency.Begin(ctx, "anonymous", "late", payload)
+	suite.Require().NoError(err)
+	suite.Require().Nil(retry.Replay)
+
+	idempotency.Finish(ctx, late, http.StatusInternalServerError, nil)
+	_, err = idempotency.Begin(ctx, "anonymous", "late", payload)
+	suite.ErrorIs(err, errors.ErrRequestInFlight)
+
+	idempotency.Finish(ctx, late, http.StatusCreated, []byte(`{"shortCode":"late"}`))
+	idempotency.Finish(ctx, retry, http.StatusCreated, []byte(`{"shortCode":"retry"}`))
+	replay, err := idempotency.Begin(ctx, "anonymous", "late", payload)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(replay.Replay)
+	suite.JSONEq(`{"shortCode":"retry"}`, string(replay.Replay.Body))
+}
+
+// workspaceKey creates a workspace and returns an API key bound to it.
+func (suite *URLControllerTestSuite) workspaceKey(name string) string {
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, workspacesEndpoint, map[string]string{"name": name}, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var workspace model.Workspace
+	test.ParseResponse(suite.T(), w, &workspace)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, apiKeysEndpoint, map[string]interface{}{"name": name, "workspaceId": workspace.ID}, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var key map[string]interface{}
+	test.ParseResponse(suite.T(), w, &key)
+	return key["token"].(string)
+}
+
+func (suite *URLControllerTestSuite) TestShortenURL_ReuseExisting() {
+	shorten := func(payload map[string]interface{}, token string) (int, string) {
+		w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, token)
+		var resp map[string]string
+		test.ParseResponse(suite.T(), w, &resp)
+		return w.Code, resp["shortCode"]
+	}
+	reuse := func(url, token string) (int, string) {
+		return shorten(map[string]interface{}{"url": url, "reuseExisting": true}, token)
+	}
+	token, rivalToken := suite.workspaceKey("brand"), suite.workspaceKey("rival")
+
+	status, code := shorten(map[string]interface{}{"url": "https://Example.com:443/docs?b=2&a=1"}, token)
+	suite.Require().Equal(http.StatusCreated, status)
+
+	// The same destination spelled differently is reused
+	status, reused := reuse("https://example.com/docs?a=1&b=2", token)
+	suite.Equal(http.StatusOK, status)
+	suite.Equal(code, reused)
+
+	status, other := reuse("https://example.com/docs?a=1&b=3", token)
+	suite.Equal(http.StatusCreated, status)
+	suite.NotEqual(code, other)
+	status, other = shorten(map[string]interface{}{"url": "https://example.com/docs?a=1&b=2"}, token)
+	suite.Equal(http.StatusCreated, status)
+	suite.NotEqual(code, other)
+
+	// Other workspaces never get the link, and links outside any workspace
+	// are never reused
+	status, _ = reuse("https://example.com/docs?a=1&b=2", rivalToken)
+	suite.Equal(http.StatusCreated, status)
+	for i := 0; i < 2; i++ {
+		status, _ = reuse("https://example.com/docs?a=1&b=2", test.TestAdminToken)
+		suite.Equal(http.StatusCreated, status)
+		status, _ = reuse("https://example.com/docs?a=1&b=2", "")
+		suite.Equal(http.StatusCreated, status)
+	}
+
+	// Links that do not send every visitor to the destination now are not
+	// reused
+	later := time.Now().Add(time.Hour).Format(time.RFC3339)
+	status, _ = shorten(map[string]interface{}{"url": "https://example.com/soon", "activeFrom": later}, token)
+	suite.Require().Equal(http.StatusCreated, status)
+	status, _ = shorten(map[string]interface{}{"url": "https://example.com/moving", "schedule": []map[string]string{{"url": "https://example.com/moved", "at": later}}}, token)
+	suite.Require().Equal(http.StatusCreated, status)
+	status, _ = reuse("https://example.com/soon", token)
+	suite.Equal(http.StatusCreated, status)
+	status, _ = reuse("https://example.com/moving", token)
+	suite.Equal(http.StatusCreated, status)
+
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, adminLinksEndpoint+"/"+code+"/disable", nil, token)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	status, reused = reuse("https://example.com/docs?b=2&a=1", token)
+	suite.Equal(http.StatusOK, status)
+	suite.Equal(other, reused)
+}
+
+func (suite *URLControllerTestSuite) TestShortenURL_ReuseExistingRejectsLinkSettings() {
+	token := suite.workspaceKey("brand")
+	settings := map[string]interface{}{
+		"expiresAt":        time.Now().Add(time.Hour).Format(time.RFC3339),
+		"redirectType":     http.StatusMovedPermanently,
+		"referrerPolicy":   "no-referrer",
+		"forwardPath":      true,
+		"activeFrom":       time.Now().Add(time.Hour).Format(time.RFC3339),
+		"activeUntil":      time.Now().Add(2 * time.Hour).Format(time.RFC3339),
+		"inactiveUrl":      "https://example.com/closed",
+		"schedule":         []map[string]string{{"url": "https://example.com/moved", "at": time.Now().Add(time.Hour).Format(time.RFC3339)}},
+		"maxUses":          1,
+		"requireSignature": true,
+	}
+	for name, value := range settings {
+		suite.Run(name, func() {
+			payload := map[string]interface{}{"url": "https://example.com/docs", "reuseExisting": true, name: value}
+			w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, token)
+			suite.Equal(http.StatusBadRequest, w.Code)
+			var resp map[string]string
+			test.ParseResponse(suite.T(), w, &resp)
+			suite.Equal(errors.ErrReuseWithSettings.Code, resp["code"])
+		})
+	}
+	suite.Zero(suite.countURLs())
+
+	// The code's shape is not a link setting
+	payload := map[string]interface{}{"url": "https://example.com/docs", "reuseExisting": true, "strategy": "pronounceable"}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, payload, token)
+	suite.Equal(http.StatusCreated, w.Code)
+}
+
 func TestURLControllerTestSuite(t *testing.T) {
 	suite.Run(t, new(URLControllerTestSuite))
 }
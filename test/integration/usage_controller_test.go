@@ -0,0 +1,203 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"smolink/internal/config"
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/repository"
+	"smolink/internal/routes"
+	"smolink/internal/service"
+	"smolink/test"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/suite"
+)
+
+const usageEndpoint = routes.APIPrefix + routes.UsagePath
+
+type UsageControllerTestSuite struct {
+	suite.Suite
+	app *test.TestApp
+}
+
+func (suite *UsageControllerTestSuite) SetupSuite() {
+	suite.app = test.SetupTestApp()
+}
+
+func (suite *UsageControllerTestSuite) TearDownSuite() {
+	suite.app.Cleanup()
+}
+
+func (suite *UsageControllerTestSuite) SetupTest() {
+	suite.app.ResetState()
+}
+
+// createWorkspace returns the new workspace's ID and an API key bound to it.
+func (suite *UsageControllerTestSuite) createWorkspace(name string) (int, string) {
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, workspacesEndpoint, map[string]string{"name": name}, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var workspace model.Workspace
+	test.ParseResponse(suite.T(), w, &workspace)
+
+	payload := map[string]interface{}{"name": name + " key", "workspaceId": workspace.ID}
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, apiKeysEndpoint, payload, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var resp struct {
+		Token string `json:"token"`
+	}
+	test.ParseResponse(suite.T(), w, &resp)
+	return workspace.ID, resp.Token
+}
+
+func (suite *UsageControllerTestSuite) setQuotas(workspaceID int, quotas map[string]int64) {
+	endpoint := workspacesEndpoint + "/" + strconv.Itoa(workspaceID) + routes.QuotasPath
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPut, endpoint, quotas, test.TestAdminToken)
+	suite.Require().Equal(http.StatusOK, w.Code)
+}
+
+func (suite *UsageControllerTestSuite) usage(token string) model.Usage {
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, usageEndpoint, nil, token)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var usage model.Usage
+	test.ParseResponse(suite.T(), w, &usage)
+	return usage
+}
+
+func metricUsage(usage model.Usage, metric string) model.MetricUsage {
+	for _, m := range usage.Metrics {
+		if m.Metric == metric {
+			return m
+		}
+	}
+	return model.MetricUsage{}
+}
+
+func (suite *UsageControllerTestSuite) TestMeteringFailsOpenWithoutRedis() {
+	cfg, err := config.LoadConfig()
+	suite.Require().NoError(err)
+	workspaceID, _ := suite.createWorkspace("brand")
+	suite.setQuotas(workspaceID, map[string]int64{"linksCreated": 1})
+
+	unreachable := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer unreachable.Close()
+	usage := service.NewUsageService(suite.app.PGRepo, repository.NewRedisRepository(unreachable), cfg)
+
+	for i := 0; i < 3; i++ {
+		suite.NoError(usage.Reserve(context.Background(), &workspaceID, model.MetricLinksCreated, 1))
+	}
+}
+
+func (suite *UsageControllerTestSuite) TestReleaseNeverUndercounts() {
+	ctx := context.Background()
+	counters := suite.app.RedisRepo
+	key := repository.UsageKey{WorkspaceID: 1, Period: "2026-01", Metric: model.MetricLinksCreated}
+
+	// Uses reserved while Redis was down, or before the counter expired
+	suite.Require().NoError(counters.ReleaseUsage(ctx, key, 1))
+	usage, err := counters.GetUsage(ctx, []repository.UsageKey{key})
+	suite.Require().NoError(err)
+	suite.Empty(usage)
+	dirty, err := counters.TakeDirtyUsage(ctx)
+	suite.Require().NoError(err)
+	suite.Empty(dirty)
+
+	suite.Require().NoError(counters.LoadUsage(ctx, key, 2, time.Hour))
+	suite.Require().NoError(counters.ReleaseUsage(ctx, key, 5))
+	dirty, err = counters.TakeDirtyUsage(ctx)
+	suite.Require().NoError(err)
+	suite.Equal(map[repository.UsageKey]int64{key: 0}, dirty)
+	ttl, err := counters.Client().TTL(ctx, key.String()).Result()
+	suite.Require().NoError(err)
+	suite.Greater(ttl, time.Duration(0))
+
+	suite.Require().NoError(counters.ReleaseUsage(ctx, key, 1))
+	dirty, err = counters.TakeDirtyUsage(ctx)
+	suite.Require().NoError(err)
+	suite.Empty(dirty)
+}
+
+func (suite *UsageControllerTestSuite) TestLinkQuotaIsEnforced() {
+	workspaceID, token := suite.createWorkspace("brand")
+	_, otherToken := suite.createWorkspace("rival")
+	suite.setQuotas(workspaceID, map[string]int64{"linksCreated": 1})
+
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, map[string]string{"url": "https://brand.test/1"}, token)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, map[string]string{"url": "https://brand.test/2"}, token)
+	suite.Equal(http.StatusForbidden, w.Code)
+	var apiErr errors.APIError
+	test.ParseResponse(suite.T(), w, &apiErr)
+	suite.Equal(errors.ErrQuotaExceeded.Code, apiErr.Code)
+
+	// Other workspaces and anonymous callers are not limited
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, map[string]string{"url": "https://rival.test"}, otherToken)
+	suite.Equal(http.StatusCreated, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, map[string]string{"url": "https://anon.test"}, "")
+	suite.Equal(http.StatusCreated, w.Code)
+
+	usage := suite.usage(token)
+	suite.Equal(workspaceID, usage.WorkspaceID)
+	links := metricUsage(usage, model.MetricLinksCreated)
+	suite.Equal(int64(1), links.Used)
+	suite.Require().NotNil(links.Limit)
+	suite.Equal(int64(1), *links.Limit)
+	suite.Nil(metricUsage(usage, model.MetricAPIRequests).Limit)
+	suite.Equal(int64(0), metricUsage(suite.usage(otherToken), model.MetricLinksCreated).Used)
+}
+
+func (suite *UsageControllerTestSuite) TestAPIRequestQuotaIsEnforced() {
+	workspaceID, token := suite.createWorkspace("brand")
+	suite.setQuotas(workspaceID, map[string]int64{"apiRequests": 2})
+
+	for i := 0; i < 2; i++ {
+		w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint, nil, token)
+		suite.Equal(http.StatusOK, w.Code)
+	}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint, nil, token)
+	suite.Equal(http.StatusForbidden, w.Code)
+
+	// Usage stays readable once the quota is used up
+	suite.Equal(int64(2), metricUsage(suite.usage(token), model.MetricAPIRequests).Used)
+}
+
+func (suite *UsageControllerTestSuite) TestUsageIsSavedToPostgres() {
+	workspaceID, token := suite.createWorkspace("brand")
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, map[string]string{"url": "https://brand.test"}, token)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	ctx := context.Background()
+	suite.Require().NoError(suite.app.UsageService.Save(ctx))
+	suite.Require().NoError(suite.app.RedisRepo.Client().FlushDB(ctx).Err())
+
+	// Counters lost from Redis are reloaded from the saved values
+	suite.Equal(int64(1), metricUsage(suite.usage(token), model.MetricLinksCreated).Used)
+	suite.setQuotas(workspaceID, map[string]int64{"linksCreated": 1})
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, map[string]string{"url": "https://brand.test/2"}, token)
+	suite.Equal(http.StatusForbidden, w.Code)
+}
+
+func (suite *UsageControllerTestSuite) TestQuotasAreValidated() {
+	workspaceID, token := suite.createWorkspace("brand")
+	endpoint := workspacesEndpoint + "/" + strconv.Itoa(workspaceID) + routes.QuotasPath
+
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPut, endpoint, map[string]int64{"linksCreated": 0}, test.TestAdminToken)
+	suite.Equal(http.StatusBadRequest, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPut, endpoint, map[string]int64{"linksCreated": 5}, token)
+	suite.Equal(http.StatusForbidden, w.Code)
+
+	// The admin token names the workspace
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, usageEndpoint, nil, test.TestAdminToken)
+	suite.Equal(http.StatusNotFound, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, usageEndpoint+"?workspace="+strconv.Itoa(workspaceID), nil, test.TestAdminToken)
+	suite.Equal(http.StatusOK, w.Code)
+}
+
+func TestUsageControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(UsageControllerTestSuite))
+}
@@ -0,0 +1,254 @@
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"smolink/internal/auth"
+	"smolink/internal/errors"
+	"smolink/internal/model"
+	"smolink/internal/routes"
+	"smolink/test"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	authEndpoint  = routes.APIPrefix + routes.AuthPath
+	usersEndpoint = routes.APIPrefix + routes.AdminPrefix + routes.UsersPath
+)
+
+var resetTokenPattern = regexp.MustCompile(`pwr_[A-Za-z0-9_-]+`)
+
+type UserControllerTestSuite struct {
+	suite.Suite
+	app *test.TestApp
+}
+
+func (suite *UserControllerTestSuite) SetupSuite() {
+	suite.app = test.SetupTestApp()
+}
+
+func (suite *UserControllerTestSuite) TearDownSuite() {
+	suite.app.Cleanup()
+}
+
+func (suite *UserControllerTestSuite) SetupTest() {
+	suite.app.ResetState()
+}
+
+func (suite *UserControllerTestSuite) createWorkspace(name string) int {
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, workspacesEndpoint, map[string]string{"name": name}, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var workspace model.Workspace
+	test.ParseResponse(suite.T(), w, &workspace)
+	return workspace.ID
+}
+
+func (suite *UserControllerTestSuite) login(email, password string) *httptest.ResponseRecorder {
+	return test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, authEndpoint+"/login",
+		map[string]string{"email": email, "password": password}, "")
+}
+
+func (suite *UserControllerTestSuite) me(token, workspaceHeader string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, authEndpoint+"/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if workspaceHeader != "" {
+		req.Header.Set(auth.WorkspaceHeader, workspaceHeader)
+	}
+	w := httptest.NewRecorder()
+	suite.app.Router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *UserControllerTestSuite) TestLoginAndLogout() {
+	workspaceID := suite.createWorkspace("acme")
+	payload := map[string]interface{}{"email": " Ada@Example.com ", "password": "correct horse", "workspaceId": workspaceID, "role": model.RoleEditor}
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, usersEndpoint, payload, test.TestAdminToken)
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var user model.User
+	test.ParseResponse(suite.T(), w, &user)
+	suite.Equal("ada@example.com", user.Email)
+	suite.NotContains(w.Body.String(), "correct horse")
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, usersEndpoint, payload, test.TestAdminToken)
+	suite.Equal(http.StatusConflict, w.Code)
+
+	for _, creds := range [][2]string{{"ada@example.com", "wrong password"}, {"bob@example.com", "correct horse"}} {
+		w = suite.login(creds[0], creds[1])
+		suite.Equal(http.StatusUnauthorized, w.Code)
+		var resp map[string]string
+		test.ParseResponse(suite.T(), w, &resp)
+		suite.Equal(errors.ErrInvalidCredentials.Code, resp["code"])
+	}
+
+	w = suite.login("ADA@example.com", "correct horse")
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var session struct {
+		Token string `json:"token"`
+	}
+	test.ParseResponse(suite.T(), w, &session)
+	suite.Require().NotEmpty(session.Token)
+
+	w = suite.me(session.Token, "")
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var me struct {
+		Principal   auth.Principal     `json:"principal"`
+		Memberships []model.Membership `json:"memberships"`
+	}
+	test.ParseResponse(suite.T(), w, &me)
+	suite.Equal(auth.PrincipalUser, me.Principal.Kind)
+	suite.Equal(model.RoleEditor, me.Principal.Role)
+	suite.Require().NotNil(me.Principal.WorkspaceID)
+	suite.Equal(workspaceID, *me.Principal.WorkspaceID)
+	suite.Len(me.Memberships, 1)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, authEndpoint+"/logout", nil, session.Token)
+	suite.Equal(http.StatusNoContent, w.Code)
+	w = suite.me(session.Token, "")
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (suite *UserControllerTestSuite) TestRolesAreEnforced() {
+	workspaceID := suite.createWorkspace("acme")
+	suite.Require().NoError(suite.app.SeedWorkspaceURL(workspaceID, "golang", "https://golang.org"))
+	_, viewer, err := suite.app.SeedUser("viewer@example.com", "viewer-password", workspaceID, model.RoleViewer)
+	suite.Require().NoError(err)
+	_, editor, err := suite.app.SeedUser("editor@example.com", "editor-password", workspaceID, model.RoleEditor)
+	suite.Require().NoError(err)
+	_, admin, err := suite.app.SeedUser("admin@example.com", "admin-password", workspaceID, model.RoleAdmin)
+	suite.Require().NoError(err)
+
+	patch := map[string]interface{}{"url": "https://go.dev"}
+
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint+"/golang", nil, viewer)
+	suite.Equal(http.StatusOK, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint+"/golang/stats", nil, viewer)
+	suite.Equal(http.StatusOK, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, adminLinksEndpoint+"/golang", patch, viewer)
+	suite.Equal(http.StatusForbidden, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, map[string]string{"url": "https://example.com"}, viewer)
+	suite.Equal(http.StatusForbidden, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, adminLinksEndpoint+"/golang", patch, editor)
+	suite.Equal(http.StatusOK, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, shortenURLEndpoint, map[string]string{"url": "https://example.com"}, editor)
+	suite.Equal(http.StatusCreated, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, adminAPIKeysEndpoint, map[string]string{"name": "ci"}, editor)
+	suite.Equal(http.StatusForbidden, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint+"/golang/history", nil, viewer)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var history struct {
+		Revisions []model.URLRevision `json:"revisions"`
+	}
+	test.ParseResponse(suite.T(), w, &history)
+	suite.Require().NotEmpty(history.Revisions)
+	suite.Require().NotNil(history.Revisions[0].ChangedBy)
+	suite.Equal("user:2", *history.Revisions[0].ChangedBy)
+
+	// Admins manage members, but only owners hand out ownership
+	membersEndpoint := workspacesEndpoint + "/" + strconv.Itoa(workspaceID) + routes.MembersPath
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, membersEndpoint, nil, editor)
+	suite.Equal(http.StatusForbidden, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, membersEndpoint, nil, admin)
+	suite.Require().Equal(http.StatusOK, w.Code)
+	var members struct {
+		Members []model.Membership `json:"members"`
+	}
+	test.ParseResponse(suite.T(), w, &members)
+	suite.Len(members.Members, 3)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPut, membersEndpoint+"/1", map[string]string{"role": model.RoleEditor}, admin)
+	suite.Equal(http.StatusOK, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPut, membersEndpoint+"/1", map[string]string{"role": model.RoleOwner}, admin)
+	suite.Equal(http.StatusForbidden, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPut, membersEndpoint+"/1", map[string]string{"role": "superuser"}, admin)
+	suite.Equal(http.StatusBadRequest, w.Code)
+
+	// Role changes apply to existing sessions on their next request
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPatch, adminLinksEndpoint+"/golang", patch, viewer)
+	suite.Equal(http.StatusOK, w.Code)
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodDelete, membersEndpoint+"/1", nil, admin)
+	suite.Equal(http.StatusNoContent, w.Code)
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodGet, adminLinksEndpoint+"/golang", nil, viewer)
+	suite.Equal(http.StatusForbidden, w.Code)
+}
+
+func (suite *UserControllerTestSuite) TestWorkspaceHeaderPicksMembership() {
+	first := suite.createWorkspace("first")
+	second := suite.createWorkspace("second")
+	other := suite.createWorkspace("other")
+	user, token, err := suite.app.SeedUser("multi@example.com", "multi-password", first, model.RoleViewer)
+	suite.Require().NoError(err)
+
+	membersEndpoint := workspacesEndpoint + "/" + strconv.Itoa(second) + routes.MembersPath + "/" + strconv.Itoa(user.ID)
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPut, membersEndpoint, map[string]string{"role": model.RoleOwner}, test.TestAdminToken)
+	suite.Require().Equal(http.StatusOK, w.Code)
+
+	var me struct {
+		Principal auth.Principal `json:"principal"`
+	}
+	w = suite.me(token, "")
+	suite.Require().Equal(http.StatusOK, w.Code)
+	test.ParseResponse(suite.T(), w, &me)
+	suite.Equal(first, *me.Principal.WorkspaceID)
+	suite.Equal(model.RoleViewer, me.Principal.Role)
+
+	w = suite.me(token, strconv.Itoa(second))
+	suite.Require().Equal(http.StatusOK, w.Code)
+	test.ParseResponse(suite.T(), w, &me)
+	suite.Equal(second, *me.Principal.WorkspaceID)
+	suite.Equal(model.RoleOwner, me.Principal.Role)
+
+	w = suite.me(token, strconv.Itoa(other))
+	suite.Equal(http.StatusForbidden, w.Code)
+}
+
+func (suite *UserControllerTestSuite) TestPasswordReset() {
+	workspaceID := suite.createWorkspace("acme")
+	_, token, err := suite.app.SeedUser("ada@example.com", "old-password", workspaceID, model.RoleViewer)
+	suite.Require().NoError(err)
+
+	// Unknown emails look the same to the caller but send nothing
+	w := test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, authEndpoint+"/password/forgot", map[string]string{"email": "nobody@example.com"}, "")
+	suite.Equal(http.StatusAccepted, w.Code)
+	suite.Empty(suite.app.Mailer.Messages())
+
+	w = test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, authEndpoint+"/password/forgot", map[string]string{"email": "ada@example.com"}, "")
+	suite.Equal(http.StatusAccepted, w.Code)
+	msg, ok := suite.app.Mailer.Last("ada@example.com")
+	suite.Require().True(ok)
+	resetToken := resetTokenPattern.FindString(msg.Body)
+	suite.Require().NotEmpty(resetToken)
+
+	reset := func(password string) *httptest.ResponseRecorder {
+		return test.CreateTestRequest(suite.T(), suite.app.Router, http.MethodPost, authEndpoint+"/password/reset",
+			map[string]string{"token": resetToken, "password": password}, "")
+	}
+
+	// A rejected password leaves the token usable
+	w = reset("short")
+	suite.Equal(http.StatusBadRequest, w.Code)
+
+	w = reset("new-password")
+	suite.Equal(http.StatusNoContent, w.Code)
+
+	w = reset("another-password")
+	suite.Equal(http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	test.ParseResponse(suite.T(), w, &resp)
+	suite.Equal(errors.ErrInvalidResetToken.Code, resp["code"])
+
+	// Resetting signs out every existing session
+	suite.Equal(http.StatusUnauthorized, suite.me(token, "").Code)
+	suite.Equal(http.StatusUnauthorized, suite.login("ada@example.com", "old-password").Code)
+	suite.Equal(http.StatusOK, suite.login("ada@example.com", "new-password").Code)
+}
+
+func TestUserControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(UserControllerTestSuite))
+}
@@ -0,0 +1,202 @@
+package test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Client credentials the test app uses with the mock identity provider.
+const (
+	TestOIDCClientID     = "smolink-test"
+	TestOIDCClientSecret = "smolink-test-secret"
+	testOIDCKeyID        = "test-key"
+)
+
+// OIDCIdentity is who the mock provider logs the next user in as.
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+type oidcGrant struct {
+	identity    OIDCIdentity
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// MockOIDCProvider is an OpenID provider that logs in whoever LoginAs names
+// without asking, and checks client credentials and PKCE like a real one.
+type MockOIDCProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	next   OIDCIdentity
+	grants map[string]oidcGrant
+}
+
+func NewMockOIDCProvider() *MockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic("OIDC key generation failed: " + err.Error())
+	}
+	p := &MockOIDCProvider{key: key, grants: make(map[string]oidcGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// LoginAs picks the identity the next authorization request succeeds as.
+func (p *MockOIDCProvider) LoginAs(identity OIDCIdentity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next = identity
+}
+
+// Authorize follows the authorization URL the app redirected to and returns
+// the callback URL the provider redirects back to.
+func (p *MockOIDCProvider) Authorize(authURL string) (*url.URL, error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return resp.Location()
+}
+
+func (p *MockOIDCProvider) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.URL,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/jwks",
+	})
+}
+
+func (p *MockOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != TestOIDCClientID || query.Get("response_type") != "code" ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.grants[code] = oidcGrant{
+		identity:    p.next,
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		redirectURI: query.Get("redirect_uri"),
+	}
+	p.mu.Unlock()
+
+	callback, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	values := callback.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	callback.RawQuery = values.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+func (p *MockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != TestOIDCClientID || secret != TestOIDCClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	grant, ok := p.grants[r.FormValue("code")]
+	delete(p.grants, r.FormValue("code"))
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || grant.redirectURI != r.FormValue("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"id_token":     p.idToken(grant),
+	})
+}
+
+func (p *MockOIDCProvider) idToken(grant oidcGrant) string {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": testOIDCKeyID, "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":            p.URL,
+		"sub":            grant.identity.Subject,
+		"aud":            TestOIDCClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          grant.nonce,
+		"email":          grant.identity.Email,
+		"email_verified": grant.identity.EmailVerified,
+		"name":           grant.identity.Name,
+		"groups":         grant.identity.Groups,
+	})
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic("OIDC token signing failed: " + err.Error())
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (p *MockOIDCProvider) jwks(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testOIDCKeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	raw := make([]byte, 16)
+	_, _ = rand.Read(raw)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
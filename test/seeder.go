@@ -3,13 +3,41 @@ package test
 import (
 	"context"
 	"smolink/internal/model"
-	"time"
+	"smolink/internal/service"
 )
 
 func (ta *TestApp) SeedShortURL(shortCode, originalURL string) error {
 	return ta.PGRepo.CreateURL(context.Background(), &model.URL{
 		ShortCode:   shortCode,
 		OriginalURL: originalURL,
-		CreatedAt:   time.Now(),
+	}, "")
+}
+
+// SeedWorkspaceURL creates a link in the default namespace owned by the workspace.
+func (ta *TestApp) SeedWorkspaceURL(workspaceID int, shortCode, originalURL string) error {
+	return ta.PGRepo.CreateURL(context.Background(), &model.URL{
+		WorkspaceID: &workspaceID,
+		ShortCode:   shortCode,
+		OriginalURL: originalURL,
+	}, "")
+}
+
+// SeedUser creates a user with the given role in the workspace and returns a
+// session token for them.
+func (ta *TestApp) SeedUser(email, password string, workspaceID int, role string) (*model.User, string, error) {
+	ctx := context.Background()
+	user, err := ta.UserService.CreateUser(ctx, service.CreateUserRequest{
+		Email:       email,
+		Password:    password,
+		WorkspaceID: &workspaceID,
+		Role:        role,
 	})
+	if err != nil {
+		return nil, "", err
+	}
+	session, err := ta.UserService.Login(ctx, email, password)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, session.Token, nil
 }